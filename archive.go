@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// archiveSource looks documents up by _id in the .bson files of a mongodump
+// output directory (<dir>/<db>/<collection>.bson) instead of a live cluster.
+// The first lookup in a namespace scans its file once, recording the offset
+// of every document by _id; documents are then read back from disk as needed,
+// so memory grows with the number of ids, not the size of the dump.
+type archiveSource struct {
+	dir  string
+	file string // when set, the single .bson file the archive consists of
+
+	mu      sync.Mutex
+	indexes map[string]*bsonFileIndex // by namespace
+}
+
+// bsonFileIndex maps the _id keys of a .bson file to document offsets
+type bsonFileIndex struct {
+	f       *os.File // nil when the namespace has no file
+	offsets map[string]int64
+}
+
+// newArchiveSource opens a mongodump directory, or a single .bson file whose
+// namespace is <parent dir>.<file name without .bson>
+func newArchiveSource(path string) (*archiveSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open dest archive: %w", err)
+	}
+	a := &archiveSource{dir: path, indexes: make(map[string]*bsonFileIndex)}
+	if !info.IsDir() {
+		if !strings.HasSuffix(path, ".bson") {
+			return nil, fmt.Errorf("dest archive %s is neither a directory nor a .bson file", path)
+		}
+		a.dir, a.file = filepath.Dir(filepath.Dir(path)), path
+	}
+	return a, nil
+}
+
+// path returns the .bson file of a namespace
+func (a *archiveSource) path(db, col string) string {
+	return filepath.Join(a.dir, db, col+".bson")
+}
+
+// index returns the index of a namespace, building it on first use
+func (a *archiveSource) index(db, col string) (*bsonFileIndex, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ns := db + "." + col
+	if idx, ok := a.indexes[ns]; ok {
+		return idx, nil
+	}
+
+	idx := &bsonFileIndex{offsets: make(map[string]int64)}
+	path := a.path(db, col)
+	if a.file != "" && path != a.file {
+		a.indexes[ns] = idx // namespace not in the archive
+		return idx, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		a.indexes[ns] = idx
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.build(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	idx.f = f
+	a.indexes[ns] = idx
+	return idx, nil
+}
+
+// build scans a .bson file, a plain concatenation of BSON documents
+func (idx *bsonFileIndex) build(f *os.File) error {
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		doc, err := bson.ReadDocument(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid document at offset %d: %w", offset, err)
+		}
+		if v, err := doc.LookupErr("_id"); err == nil {
+			idx.offsets[idKey("", v)] = offset
+		}
+		offset += int64(len(doc))
+	}
+}
+
+// read returns the document at offset
+func (idx *bsonFileIndex) read(offset int64) (bson.Raw, error) {
+	var size [4]byte
+	if _, err := idx.f.ReadAt(size[:], offset); err != nil {
+		return nil, err
+	}
+	doc := make([]byte, binary.LittleEndian.Uint32(size[:]))
+	if _, err := idx.f.ReadAt(doc, offset); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// archiveID returns the _id of an equality filter on _id
+func archiveID(filter interface{}) (interface{}, error) {
+	m, ok := filter.(bson.M)
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("dest archive supports only _id lookups")
+	}
+	id, ok := m["_id"]
+	if !ok {
+		return nil, fmt.Errorf("dest archive supports only _id lookups")
+	}
+	return id, nil
+}
+
+func (a *archiveSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	id, err := archiveID(filter)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := a.index(db, col)
+	if err != nil {
+		return nil, err
+	}
+	offset, ok := idx.offsets[idKey("", id)]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return idx.read(offset)
+}
+
+func (a *archiveSource) CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error) {
+	idx, err := a.index(db, col)
+	if err != nil {
+		return 0, err
+	}
+	if m, ok := filter.(bson.M); ok && len(m) == 0 {
+		n := int64(len(idx.offsets))
+		if limit > 0 && n > limit {
+			n = limit
+		}
+		return n, nil
+	}
+	id, err := archiveID(filter)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := idx.offsets[idKey("", id)]; ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// close closes the open .bson files
+func (a *archiveSource) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, idx := range a.indexes {
+		if idx.f != nil {
+			idx.f.Close()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestArchiveSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ids := []interface{}{primitive.NewObjectID(), "str-id", int32(7)}
+	var dump []byte
+	for i, id := range ids {
+		doc, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "n", Value: i}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump = append(dump, doc...)
+	}
+	path := filepath.Join(dir, "db", "col.bson")
+	if err := os.WriteFile(path, dump, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range []string{dir, path} {
+		a, err := newArchiveSource(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, id := range ids {
+			doc, err := a.FindOne(context.Background(), "db", "col", bson.M{"_id": id})
+			if err != nil {
+				t.Fatalf("%s: FindOne(%v): %v", root, id, err)
+			}
+			if n := doc.Lookup("n").Int32(); n != int32(i) {
+				t.Errorf("%s: FindOne(%v) returned document %d, want %d", root, id, n, i)
+			}
+		}
+		if _, err := a.FindOne(context.Background(), "db", "col", bson.M{"_id": primitive.NewObjectID()}); err != mongo.ErrNoDocuments {
+			t.Errorf("%s: unknown id: %v, want ErrNoDocuments", root, err)
+		}
+		if _, err := a.FindOne(context.Background(), "db", "other", bson.M{"_id": "str-id"}); err != mongo.ErrNoDocuments {
+			t.Errorf("%s: unknown namespace: %v, want ErrNoDocuments", root, err)
+		}
+		if _, err := a.FindOne(context.Background(), "db", "col", bson.M{"orderId": 1}); err == nil {
+			t.Errorf("%s: expected an error for a non-_id lookup", root)
+		}
+		a.close()
+	}
+}
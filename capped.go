@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// diffCapped compares the _ids a capped collection holds on each side, both
+// in natural order, which for a capped collection is insertion order. Ids on
+// both sides Match. The window of the two sides is the run of ids from the
+// oldest to the newest id they have in common: an id only one side has
+// inside it should be on both and is reported missing, while one outside it
+// aged out of the other side, or has not reached it yet, and is
+// OutsideCapWindow. Without any id in common there is no window, overlap is
+// false and every id is OutsideCapWindow.
+func diffCapped(src, dest []interface{}) (results []CheckResult, overlap bool) {
+	inSrc, inDest := idSet(src), idSet(dest)
+	srcFirst, srcLast := commonSpan(src, inDest)
+	destFirst, destLast := commonSpan(dest, inSrc)
+	overlap = srcFirst >= 0
+
+	side := func(ids []interface{}, other map[string]bool, first, last int, missing, name, otherName string) {
+		for i, id := range ids {
+			switch {
+			case other[idKey("", id)]:
+				// Recorded once, from the source side
+				if name == "source" {
+					results = append(results, CheckResult{ID: id, Status: StatusMatch})
+				}
+			case !overlap:
+				results = append(results, CheckResult{ID: id, Status: StatusOutsideCapWindow,
+					Details: fmt.Sprintf("Only the %s has it; the sides have no id in common, so no window to check it against", name)})
+			case i < first:
+				results = append(results, CheckResult{ID: id, Status: StatusOutsideCapWindow,
+					Details: fmt.Sprintf("Only the %s has it, older than every id both sides hold: aged out of the %s", name, otherName)})
+			case i > last:
+				results = append(results, CheckResult{ID: id, Status: StatusOutsideCapWindow,
+					Details: fmt.Sprintf("Only the %s has it, newer than every id both sides hold: not in the %s yet", name, otherName)})
+			default:
+				results = append(results, CheckResult{ID: id, Status: missing,
+					Details: fmt.Sprintf("Missing from the %s inside the window both sides hold", otherName)})
+			}
+		}
+	}
+	side(src, inDest, srcFirst, srcLast, StatusMissingInDest, "source", "dest")
+	side(dest, inSrc, destFirst, destLast, StatusMissingInSource, "dest", "source")
+	return results, overlap
+}
+
+// idSet returns the set of ids by idKey
+func idSet(ids []interface{}) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[idKey("", id)] = true
+	}
+	return set
+}
+
+// commonSpan returns the positions in ids of the first and last id in
+// other, or -1, -1
+func commonSpan(ids []interface{}, other map[string]bool) (first, last int) {
+	first, last = -1, -1
+	for i, id := range ids {
+		if other[idKey("", id)] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	return first, last
+}
+
+// RunCapped reconciles the capped collection namespace by diffing the _ids
+// both sides hold, see diffCapped, rather than looking its logged ids up:
+// those age out of a capped collection and would show as missing.
+func (c *Checker) RunCapped(ctx context.Context, namespace string, srcScan, destScan idScanner) error {
+	dbName, colName, err := splitNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	c.cappedRun = true
+	scan := func(s idScanner) ([]interface{}, error) {
+		var ids []interface{}
+		err := s.ScanIDs(ctx, dbName, colName, func(id interface{}) error {
+			ids = append(ids, id)
+			return nil
+		})
+		return ids, err
+	}
+	src, err := scan(srcScan)
+	if err != nil {
+		return fmt.Errorf("source scan of %s: %w", namespace, err)
+	}
+	dest, err := scan(destScan)
+	if err != nil {
+		return fmt.Errorf("dest scan of %s: %w", namespace, err)
+	}
+
+	results, overlap := diffCapped(src, dest)
+	if !overlap && len(results) > 0 {
+		c.Logger.Printf("WARNING: capped collection %s: source and dest have no _id in common; its %d ids are all reported OutsideCapWindow", namespace, len(results))
+	}
+	for _, res := range results {
+		if c.StopReason != "" {
+			break
+		}
+		c.finishCheck(0, namespace, res)
+	}
+	return nil
+}
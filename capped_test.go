@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiffCapped(t *testing.T) {
+	// The source rolled over past 1-2, dest past 1-3 and has not got 9 yet;
+	// 5 never reached dest and 7 was lost from the source
+	src := []interface{}{int32(3), int32(4), int32(5), int32(6), int32(8), int32(9)}
+	dest := []interface{}{int32(4), int32(6), int32(7), int32(8)}
+	results, overlap := diffCapped(src, dest)
+	if !overlap {
+		t.Fatal("overlap = false, want the window 4..8")
+	}
+	var got []string
+	for _, res := range results {
+		got = append(got, fmt.Sprintf("%v:%s", res.ID, res.Status))
+	}
+	want := "3:OutsideCapWindow,4:Match,5:MissingInDest,6:Match,8:Match,9:OutsideCapWindow,7:MissingInSource"
+	if strings.Join(got, ",") != want {
+		t.Errorf("diffCapped = %s\nwant %s", strings.Join(got, ","), want)
+	}
+	if !strings.Contains(results[0].Details, "aged out of the dest") || !strings.Contains(results[5].Details, "not in the dest yet") {
+		t.Errorf("details do not say why: %q, %q", results[0].Details, results[5].Details)
+	}
+
+	// Disjoint windows leave nothing to compare against
+	results, overlap = diffCapped([]interface{}{int32(1)}, []interface{}{int32(2)})
+	if overlap || len(results) != 2 || results[0].Status != StatusOutsideCapWindow || results[1].Status != StatusOutsideCapWindow {
+		t.Errorf("disjoint sides: overlap %v, results %+v", overlap, results)
+	}
+}
+
+func TestRunCapped(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	for _, id := range []int32{3, 4, 5, 6} {
+		src.insert("db.capped", bson.D{{Key: "_id", Value: id}})
+	}
+	for _, id := range []int32{4, 6, 7} {
+		dest.insert("db.capped", bson.D{{Key: "_id", Value: id}})
+	}
+
+	c := NewChecker(src, dest)
+	c.Capped = map[string]bool{"db.capped": true}
+	// Logged ids of the capped collection are left to RunCapped
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.capped", primitive.NewObjectID())))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.MatchedLines != 1 || c.StatsMap["db.capped"].TotalChecks != 0 {
+		t.Fatalf("logged capped id was checked: %+v", c.StatsMap["db.capped"])
+	}
+	if err := c.RunCapped(context.Background(), "db.capped", src, dest); err != nil {
+		t.Fatalf("RunCapped: %v", err)
+	}
+	s := c.StatsMap["db.capped"]
+	if s.TotalChecks != 5 || s.Matches != 2 || s.OutsideCapWindow != 2 || s.MissingInDest != 1 || s.MissingInSource != 0 || s.Discrepancies() != 1 {
+		t.Errorf("stats %+v, want 2 matches, 3 and 7 outside the window and 5 missing in dest", s)
+	}
+	if got := s.MatchRate(); got < 66 || got > 67 {
+		t.Errorf("match rate %v, want 2 of the 3 ids in the window", got)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Change stream watch defaults
+const (
+	defaultChangeStreamDuration = time.Minute
+	defaultChangeStreamTimeout  = 30 * time.Second
+)
+
+// changeEvent is a document change seen on a change stream
+type changeEvent struct {
+	Namespace string
+	Op        string      // operationType: insert, update, replace or delete
+	ID        interface{} // documentKey._id
+	Token     bson.Raw    // resume token
+}
+
+// changeStreamer tails the document changes of a cluster
+type changeStreamer interface {
+	// WatchChanges calls fn with each insert, update, replace and delete
+	// in namespaces until ctx is done, or fn returns an error
+	WatchChanges(ctx context.Context, namespaces []string, fn func(changeEvent) error) error
+}
+
+// changeOps are the operation types watched: those of a document
+var changeOps = bson.A{"insert", "update", "replace", "delete"}
+
+// WatchChanges opens a change stream on the whole deployment filtered to
+// namespaces, which requires a replica set or sharded cluster. The end of
+// ctx ends the watch without error.
+func (m mongoSource) WatchChanges(ctx context.Context, namespaces []string, fn func(changeEvent) error) error {
+	var nsFilter bson.A
+	for _, ns := range namespaces {
+		db, col, err := splitNamespace(ns)
+		if err != nil {
+			return err
+		}
+		nsFilter = append(nsFilter, bson.D{{Key: "ns.db", Value: db}, {Key: "ns.coll", Value: col}})
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{
+		{Key: "operationType", Value: bson.D{{Key: "$in", Value: changeOps}}},
+		{Key: "$or", Value: nsFilter},
+	}}}}
+	cs, err := m.client.Watch(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cs.Close(context.Background())
+	for cs.Next(ctx) {
+		var doc struct {
+			Op string `bson:"operationType"`
+			NS struct {
+				DB   string `bson:"db"`
+				Coll string `bson:"coll"`
+			} `bson:"ns"`
+			Key struct {
+				ID interface{} `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+		if err := cs.Decode(&doc); err != nil {
+			return err
+		}
+		event := changeEvent{Namespace: doc.NS.DB + "." + doc.NS.Coll, Op: doc.Op, ID: doc.Key.ID, Token: append(bson.Raw(nil), cs.ResumeToken()...)}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return cs.Err()
+}
+
+// changeDrop is a source change not seen on dest within the timeout
+type changeDrop struct {
+	Namespace string
+	Op        string
+	ID        interface{}
+	Seen      time.Time // when the source change was seen
+}
+
+// changeStreamReport is the result of -mode changestream
+type changeStreamReport struct {
+	Namespaces   []string
+	Watched      time.Duration // how long source changes were taken in
+	Timeout      time.Duration
+	SourceEvents int
+	DestEvents   int
+	Matched      int
+	Lag          ageStats // of the matched changes, from source to dest
+	Drops        []changeDrop
+	Pending      int // source changes whose timeout had not passed at the end
+	DestOnly     int // dest changes that matched no source change
+
+	// The last resume token of each side. Tokens are specific to their
+	// cluster, so changes are matched by namespace and document key.
+	SourceToken, DestToken bson.Raw
+}
+
+// pendingChange is a source change awaiting its dest counterpart
+type pendingChange struct {
+	event changeEvent
+	seen  time.Time
+}
+
+// changeMatcher pairs the changes seen on the source with those seen on
+// dest. Changes are matched by namespace and document _id, oldest first,
+// whatever their operation type: a migration tool may well apply an insert
+// as an upsert. A dest change seen first, the two streams being read
+// concurrently, waits for its source change as long.
+type changeMatcher struct {
+	timeout time.Duration
+	pending map[string][]pendingChange // source changes by changeKey
+	early   map[string][]time.Time     // dest changes by changeKey
+	report  *changeStreamReport
+}
+
+func newChangeMatcher(timeout time.Duration) *changeMatcher {
+	return &changeMatcher{
+		timeout: timeout,
+		pending: make(map[string][]pendingChange),
+		early:   make(map[string][]time.Time),
+		report:  &changeStreamReport{Timeout: timeout},
+	}
+}
+
+func changeKey(e changeEvent) string {
+	return idKey(e.Namespace, e.ID)
+}
+
+// source records a change seen on the source at t
+func (m *changeMatcher) source(e changeEvent, t time.Time) {
+	m.report.SourceEvents++
+	m.report.SourceToken = e.Token
+	key := changeKey(e)
+	if early := m.early[key]; len(early) > 0 {
+		m.popEarly(key)
+		m.report.Matched++
+		m.report.Lag.add(0)
+		return
+	}
+	m.pending[key] = append(m.pending[key], pendingChange{event: e, seen: t})
+}
+
+// dest records a change seen on dest at t
+func (m *changeMatcher) dest(e changeEvent, t time.Time) {
+	m.report.DestEvents++
+	m.report.DestToken = e.Token
+	key := changeKey(e)
+	if pending := m.pending[key]; len(pending) > 0 {
+		m.popPending(key)
+		m.report.Matched++
+		m.report.Lag.add(t.Sub(pending[0].seen))
+		return
+	}
+	m.early[key] = append(m.early[key], t)
+}
+
+func (m *changeMatcher) popPending(key string) {
+	if len(m.pending[key]) == 1 {
+		delete(m.pending, key)
+	} else {
+		m.pending[key] = m.pending[key][1:]
+	}
+}
+
+func (m *changeMatcher) popEarly(key string) {
+	if len(m.early[key]) == 1 {
+		delete(m.early, key)
+	} else {
+		m.early[key] = m.early[key][1:]
+	}
+}
+
+// expire drops the source changes older than the timeout at now, and counts
+// the dest changes that waited as long for their source change as dest only
+func (m *changeMatcher) expire(now time.Time) {
+	for key, pending := range m.pending {
+		for len(pending) > 0 && now.Sub(pending[0].seen) > m.timeout {
+			p := pending[0]
+			m.report.Drops = append(m.report.Drops, changeDrop{Namespace: p.event.Namespace, Op: p.event.Op, ID: p.event.ID, Seen: p.seen})
+			m.popPending(key)
+			pending = m.pending[key]
+		}
+	}
+	for key, early := range m.early {
+		for len(early) > 0 && now.Sub(early[0]) > m.timeout {
+			m.report.DestOnly++
+			m.popEarly(key)
+			early = m.early[key]
+		}
+	}
+}
+
+// waiting returns the number of source changes awaiting dest
+func (m *changeMatcher) waiting() int {
+	n := 0
+	for _, pending := range m.pending {
+		n += len(pending)
+	}
+	return n
+}
+
+// finish ends the matching at now and returns the report
+func (m *changeMatcher) finish(now time.Time) *changeStreamReport {
+	m.expire(now)
+	m.report.Pending = m.waiting()
+	for _, early := range m.early {
+		m.report.DestOnly += len(early)
+	}
+	slices.SortFunc(m.report.Drops, func(a, b changeDrop) int { return a.Seen.Compare(b.Seen) })
+	return m.report
+}
+
+// RunChangeStream tails the changes to namespaces on both sides. Source
+// changes are taken in for watch; each must then be seen on dest within
+// timeout or is dropped. After watch, dest is tailed until every source
+// change is matched or dropped.
+func (c *Checker) RunChangeStream(ctx context.Context, namespaces []string, src, dest changeStreamer, watch, timeout time.Duration) (*changeStreamReport, error) {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	m := newChangeMatcher(timeout)
+	m.report.Namespaces = namespaces
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type sideEvent struct {
+		dest  bool
+		event changeEvent
+	}
+	events := make(chan sideEvent)
+	errs := make(chan error, 2)
+	tail := func(side string, s changeStreamer, isDest bool) {
+		err := s.WatchChanges(ctx, namespaces, func(e changeEvent) error {
+			select {
+			case events <- sideEvent{dest: isDest, event: e}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("%s change stream: %w", side, err)
+		} else {
+			err = nil
+		}
+		errs <- err
+	}
+	go tail("source", src, false)
+	go tail("dest", dest, true)
+	running := 2
+	defer func() {
+		cancel()
+		for ; running > 0; running-- {
+			<-errs
+		}
+	}()
+
+	start := now()
+	c.Logger.Printf("Watching changes to %s for %v", strings.Join(namespaces, ", "), watch)
+	stopSource := time.After(watch)
+	var drained <-chan time.Time
+	ticker := time.NewTicker(min(timeout/4, time.Second))
+	defer ticker.Stop()
+	watching := true
+	for done := false; !done; {
+		select {
+		case se := <-events:
+			t := now()
+			m.expire(t)
+			if se.dest {
+				m.dest(se.event, t)
+			} else if watching {
+				m.source(se.event, t)
+			}
+			if c.Progress != nil {
+				c.Progress.Rows.Add(1)
+			}
+		case <-ticker.C:
+			m.expire(now())
+		case <-stopSource:
+			watching = false
+			m.report.Watched = now().Sub(start)
+			drained = time.After(timeout)
+		case <-drained:
+			done = true
+		case err := <-errs:
+			running--
+			if err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// After the watch, stop as soon as every source change is settled
+		if !watching && m.waiting() == 0 {
+			done = true
+		}
+	}
+	return m.finish(now()), nil
+}
+
+// printChangeStreamReport writes the result of -mode changestream
+func printChangeStreamReport(w io.Writer, r *changeStreamReport) {
+	fmt.Fprintln(w, "\n=== Change Stream Report ===")
+	fmt.Fprintf(w, "Namespaces watched: %d\n", len(r.Namespaces))
+	fmt.Fprintf(w, "Source changes: %d (over %v)\n", r.SourceEvents, r.Watched.Round(time.Second))
+	fmt.Fprintf(w, "Dest changes: %d\n", r.DestEvents)
+	fmt.Fprintf(w, "Matched on dest within %v: %d\n", r.Timeout, r.Matched)
+	if r.Lag.Count > 0 {
+		fmt.Fprintf(w, "Lag: min %v, median %v, max %v\n", r.Lag.Min.Round(time.Millisecond), r.Lag.Median().Round(time.Millisecond), r.Lag.Max.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "Dropped (not on dest within %v): %d\n", r.Timeout, len(r.Drops))
+	if r.Pending > 0 {
+		fmt.Fprintf(w, "Still awaiting dest when the watch ended: %d\n", r.Pending)
+	}
+	if r.DestOnly > 0 {
+		fmt.Fprintf(w, "Dest changes matching no source change: %d\n", r.DestOnly)
+	}
+	if r.SourceToken != nil || r.DestToken != nil {
+		fmt.Fprintf(w, "Last resume tokens: source %s, dest %s\n", r.SourceToken, r.DestToken)
+	}
+	if len(r.Drops) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Dropped Changes ===")
+	for _, d := range r.Drops {
+		fmt.Fprintf(w, "[%s] %s ID: %s | seen on source %s\n", d.Namespace, d.Op, formatID(d.ID), d.Seen.UTC().Format(time.RFC3339Nano))
+	}
+}
+
+// jsonChangeDrop is the JSON form of a changeDrop
+type jsonChangeDrop struct {
+	Namespace string          `json:"namespace"`
+	Op        string          `json:"op"`
+	ID        json.RawMessage `json:"id"`
+	Seen      time.Time       `json:"seen"`
+}
+
+// jsonChangeStreamReport is the document written by -mode changestream
+// -output json
+type jsonChangeStreamReport struct {
+	SchemaVersion  int              `json:"schemaVersion"`
+	Metadata       jsonMetadata     `json:"metadata"`
+	Namespaces     []string         `json:"namespaces"`
+	WatchedSeconds float64          `json:"watchedSeconds"`
+	TimeoutSeconds float64          `json:"timeoutSeconds"`
+	SourceEvents   int              `json:"sourceEvents"`
+	DestEvents     int              `json:"destEvents"`
+	Matched        int              `json:"matched"`
+	Lag            jsonAgeStats     `json:"lag"`
+	Drops          []jsonChangeDrop `json:"drops"`
+	Pending        int              `json:"pending"`
+	DestOnly       int              `json:"destOnly"`
+	SourceToken    json.RawMessage  `json:"sourceResumeToken,omitempty"`
+	DestToken      json.RawMessage  `json:"destResumeToken,omitempty"`
+}
+
+func writeChangeStreamReport(w io.Writer, meta jsonMetadata, r *changeStreamReport) error {
+	meta.EndTime = time.Now().UTC()
+	jr := jsonChangeStreamReport{
+		SchemaVersion:  reportSchemaVersion,
+		Metadata:       meta,
+		Namespaces:     r.Namespaces,
+		WatchedSeconds: r.Watched.Seconds(),
+		TimeoutSeconds: r.Timeout.Seconds(),
+		SourceEvents:   r.SourceEvents,
+		DestEvents:     r.DestEvents,
+		Matched:        r.Matched,
+		Lag:            r.Lag.json(),
+		Drops:          []jsonChangeDrop{},
+		Pending:        r.Pending,
+		DestOnly:       r.DestOnly,
+	}
+	for _, d := range r.Drops {
+		jr.Drops = append(jr.Drops, jsonChangeDrop{Namespace: d.Namespace, Op: d.Op, ID: extJSONValue(d.ID), Seen: d.Seen.UTC()})
+	}
+	if r.SourceToken != nil {
+		jr.SourceToken = dumpDoc(r.SourceToken, 0)
+	}
+	if r.DestToken != nil {
+		jr.DestToken = dumpDoc(r.DestToken, 0)
+	}
+	return json.NewEncoder(w).Encode(jr)
+}
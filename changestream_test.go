@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fakeStream is a changeStreamer replaying events, each after its delay
+// from the start of the watch
+type fakeStream struct {
+	events []changeEvent
+	delays []time.Duration
+}
+
+func (f *fakeStream) WatchChanges(ctx context.Context, namespaces []string, fn func(changeEvent) error) error {
+	start := time.Now()
+	for i, e := range f.events {
+		select {
+		case <-time.After(time.Until(start.Add(f.delays[i]))):
+		case <-ctx.Done():
+			return nil
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestChangeMatcher(t *testing.T) {
+	m := newChangeMatcher(30 * time.Second)
+	t0 := time.Date(2025, 10, 15, 17, 0, 0, 0, time.UTC)
+	token, err := bson.Marshal(bson.D{{Key: "_data", Value: "8268F1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := func(id int32, op string) changeEvent {
+		return changeEvent{Namespace: "db.col", Op: op, ID: id, Token: token}
+	}
+
+	m.source(change(1, "insert"), t0)
+	m.dest(change(1, "update"), t0.Add(2*time.Second)) // applied as an upsert
+	m.source(change(2, "insert"), t0)
+	m.dest(change(3, "delete"), t0.Add(time.Second)) // seen before its source change
+	m.source(change(3, "delete"), t0.Add(1500*time.Millisecond))
+	m.dest(change(4, "insert"), t0.Add(3*time.Second)) // dest only
+	m.source(change(5, "insert"), t0.Add(40*time.Second))
+
+	r := m.finish(t0.Add(45 * time.Second))
+	if r.SourceEvents != 4 || r.DestEvents != 3 || r.Matched != 2 {
+		t.Errorf("source %d, dest %d, matched %d; want 4, 3, 2", r.SourceEvents, r.DestEvents, r.Matched)
+	}
+	if r.Lag.Count != 2 || r.Lag.Min != 0 || r.Lag.Max != 2*time.Second {
+		t.Errorf("lag %+v, want 0 and 2s", r.Lag)
+	}
+	if len(r.Drops) != 1 || r.Drops[0].ID != int32(2) || r.Drops[0].Op != "insert" {
+		t.Errorf("drops %+v, want the insert of 2", r.Drops)
+	}
+	if r.Pending != 1 || r.DestOnly != 1 {
+		t.Errorf("pending %d, dest only %d; want 1 each", r.Pending, r.DestOnly)
+	}
+	if string(r.SourceToken) != string(token) {
+		t.Errorf("source resume token %v not recorded", r.SourceToken)
+	}
+}
+
+func TestRunChangeStream(t *testing.T) {
+	matched := changeEvent{Namespace: "db.col", Op: "insert", ID: int32(1)}
+	dropped := changeEvent{Namespace: "db.col", Op: "update", ID: int32(2)}
+	src := &fakeStream{events: []changeEvent{matched, dropped}, delays: []time.Duration{0, 10 * time.Millisecond}}
+	dest := &fakeStream{events: []changeEvent{matched}, delays: []time.Duration{30 * time.Millisecond}}
+
+	c := NewChecker(newFakeSource(), newFakeSource())
+	r, err := c.RunChangeStream(context.Background(), []string{"db.col"}, src, dest, 50*time.Millisecond, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("RunChangeStream: %v", err)
+	}
+	if r.SourceEvents != 2 || r.Matched != 1 || len(r.Drops) != 1 || r.Drops[0].ID != int32(2) || r.Pending != 0 {
+		t.Errorf("report %+v, want 1 of 2 source changes matched and the other dropped", r)
+	}
+	if r.Lag.Min <= 0 || r.Lag.Max > 200*time.Millisecond {
+		t.Errorf("lag %v, want the dest delay", r.Lag.Max)
+	}
+
+	var out strings.Builder
+	printChangeStreamReport(&out, r)
+	if !strings.Contains(out.String(), "Matched on dest within 200ms: 1\n") || !strings.Contains(out.String(), "[db.col] update ID: 2 |") {
+		t.Errorf("report:\n%s", out.String())
+	}
+}
@@ -0,0 +1,1558 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Result statuses reported by checkDoc
+const (
+	StatusMatch            = "Match"
+	StatusMismatch         = "Mismatch"
+	StatusMissingInSource  = "MissingInSource"
+	StatusMissingInDest    = "MissingInDest"
+	StatusError            = "Error"
+	StatusIDTypeMismatch   = "IdTypeMismatch"
+	StatusMultipleMatches  = "MultipleMatches"
+	StatusMissingInBoth    = "MissingInBoth"
+	StatusRootMissing      = "CompareRootMissing"
+	StatusDuplicateID      = "DuplicateId"
+	StatusTimeout          = "Timeout"
+	StatusNotInSource      = "NotInSource"
+	StatusDecodeError      = "DecodeError"
+	StatusSkippedOld       = "SkippedOld"
+	StatusOutsideCapWindow = "OutsideCapWindow"
+)
+
+// decodeError wraps the error of a lookup that found the document but could
+// not read it: invalid BSON, or a CSFLE field that failed to decrypt
+type decodeError struct {
+	err error
+}
+
+func (e decodeError) Error() string {
+	return "unreadable document: " + e.err.Error()
+}
+
+func (e decodeError) Unwrap() error {
+	return e.err
+}
+
+// failedStatus reports whether a check with this status got no answer: an
+// Error, or a Timeout when timeouts are told apart
+func failedStatus(status string) bool {
+	return status == StatusError || status == StatusTimeout
+}
+
+// outOfScopeStatus reports whether a check with this status concerns a
+// document left out of scope, by -direction source, -modified-since or
+// -capped: it is neither a match nor a discrepancy
+func outOfScopeStatus(status string) bool {
+	return status == StatusNotInSource || status == StatusSkippedOld || status == StatusOutsideCapWindow
+}
+
+// statusNames maps the names -only-status accepts, the statuses lowercased,
+// and short forms of the missing ones, to the statuses
+var statusNames = map[string]string{
+	"mismatch":           StatusMismatch,
+	"missinginsource":    StatusMissingInSource,
+	"missingsource":      StatusMissingInSource,
+	"missingindest":      StatusMissingInDest,
+	"missingdest":        StatusMissingInDest,
+	"error":              StatusError,
+	"idtypemismatch":     StatusIDTypeMismatch,
+	"multiplematches":    StatusMultipleMatches,
+	"missinginboth":      StatusMissingInBoth,
+	"comparerootmissing": StatusRootMissing,
+	"duplicateid":        StatusDuplicateID,
+	"timeout":            StatusTimeout,
+	"notinsource":        StatusNotInSource,
+	"decodeerror":        StatusDecodeError,
+	"skippedold":         StatusSkippedOld,
+	"outsidecapwindow":   StatusOutsideCapWindow,
+}
+
+// parseStatuses parses a comma separated list of statuses, such as
+// "mismatch,missing_dest", in any case and with or without _ or -
+func parseStatuses(list string) (map[string]bool, error) {
+	statuses := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		key := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+		status, ok := statusNames[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown status %q", name)
+		}
+		statuses[status] = true
+	}
+	return statuses, nil
+}
+
+// messageColumn is the CSV column of the log message
+const messageColumn = 3
+
+// defaultErrorBufferSize is the number of recent errors kept for the report
+const defaultErrorBufferSize = 20
+
+// Values of -both-missing-status: how a document missing from both sides is classified
+const (
+	bothMissingMatch       = "match"           // Match
+	bothMissingDiscrepancy = "discrepancy"     // Mismatch
+	bothMissingSeparate    = "separate-status" // MissingInBoth
+)
+
+// Values of -compare-mode: how two documents found on both sides are compared
+const (
+	compareDeep  = "deep"  // field by field, ignoring field order
+	compareBytes = "bytes" // byte for byte, so reordered fields differ
+)
+
+// Values of -direction: which side is authoritative
+const (
+	directionBoth   = "both"   // both sides are looked up
+	directionSource = "source" // documents missing from the source are out of scope
+)
+
+// CheckResult holds the result of a comparison
+type CheckResult struct {
+	Namespace string
+	ID        interface{}
+	Status    string // One of the Status constants
+	Details   string
+	Diffs     []FieldDiff // Field level differences for a Mismatch
+	ErrClass  string      // Classification of an Error, see classifyError
+	Line      int         // Line of the input the id was read from
+
+	// Full documents, kept only when dumping is enabled
+	SourceDoc bson.Raw
+	DestDoc   bson.Raw
+
+	// BSON sizes of the documents, set when both exist
+	SourceSize, DestSize int
+
+	// PrettyDiff is a unified diff of the documents of a Mismatch, set with
+	// Checker.PrettyDiff
+	PrettyDiff string
+}
+
+// Stats holds statistics per namespace
+type Stats struct {
+	TotalChecks      int `json:"totalChecks"`
+	Matches          int `json:"matches"`
+	Mismatches       int `json:"mismatches"`
+	MissingInSource  int `json:"missingInSource"`
+	MissingInDest    int `json:"missingInDest"`
+	Errors           int `json:"errors"`
+	IDTypeMismatches int `json:"idTypeMismatches"`
+	MultipleMatches  int `json:"multipleMatches"`
+	MissingInBoth    int `json:"missingInBoth"`
+	RootMissing      int `json:"compareRootMissing"`
+	DuplicateIDs     int `json:"duplicateIds"`
+	DecodeErrors     int `json:"decodeErrors"` // Documents found but unreadable
+	Timeouts         int `json:"timeouts"`
+	NotInSource      int `json:"notInSource"`      // Missing from the source, dest not queried (-direction source)
+	SkippedOld       int `json:"skippedOld"`       // Source documents last modified before -modified-since, dest not queried
+	OutsideCapWindow int `json:"outsideCapWindow"` // Capped collection ids only one side holds, outside the window both hold
+	Skipped          int `json:"skipped"`          // Previously matched ids skipped in incremental mode
+	Duplicates       int `json:"duplicates"`       // Ids already checked earlier in the run
+	ParseFailures    int `json:"parseFailures"`    // Lines whose id could not be extracted
+
+	// Attempts is a histogram of logged failures by retry attempt number
+	Attempts map[int]int `json:"attempts,omitempty"`
+	// Categories counts logged failures by error category
+	Categories map[string]int `json:"categories,omitempty"`
+	// ErrorClasses counts Error results by classifyError class
+	ErrorClasses map[string]int `json:"errorClasses,omitempty"`
+	// Sizes aggregates document sizes, with -size-report
+	Sizes *SizeStats `json:"sizes,omitempty"`
+}
+
+// SizeStats aggregates the BSON sizes of documents found on both sides
+type SizeStats struct {
+	Compared    int   `json:"compared"`    // Checks where both documents exist
+	SourceBytes int64 `json:"sourceBytes"` // Total size of those source documents
+	DestBytes   int64 `json:"destBytes"`   // Total size of those dest documents
+	Grown       int   `json:"grown"`       // Dest document larger than source
+	Shrunk      int   `json:"shrunk"`      // Dest document smaller than source
+}
+
+// add records the sizes of one pair of documents
+func (s *SizeStats) add(srcSize, destSize int) {
+	s.Compared++
+	s.SourceBytes += int64(srcSize)
+	s.DestBytes += int64(destSize)
+	switch {
+	case destSize > srcSize:
+		s.Grown++
+	case destSize < srcSize:
+		s.Shrunk++
+	}
+}
+
+// Delta is the total size change from source to dest, in bytes
+func (s *SizeStats) Delta() int64 {
+	return s.DestBytes - s.SourceBytes
+}
+
+// MeanDelta is the average size change per document, in bytes
+func (s *SizeStats) MeanDelta() float64 {
+	if s.Compared == 0 {
+		return 0
+	}
+	return float64(s.Delta()) / float64(s.Compared)
+}
+
+// DeltaPercent is the total size change relative to the source size
+func (s *SizeStats) DeltaPercent() float64 {
+	if s.SourceBytes == 0 {
+		return 0
+	}
+	return 100 * float64(s.Delta()) / float64(s.SourceBytes)
+}
+
+// Discrepancies counts the checks of a namespace that found a discrepancy
+func (s *Stats) Discrepancies() int {
+	return s.Mismatches + s.MissingInSource + s.MissingInDest + s.IDTypeMismatches + s.MultipleMatches + s.MissingInBoth + s.RootMissing + s.DuplicateIDs + s.DecodeErrors
+}
+
+// Covered counts the checks of a namespace that got an answer from both
+// sides, whatever it was
+func (s *Stats) Covered() int {
+	return s.TotalChecks - s.Errors - s.Timeouts
+}
+
+// CompareCacheHits returns how many comparisons were answered by the
+// content cache
+func (c *Checker) CompareCacheHits() int {
+	if c.Compare == nil || c.Compare.cache == nil {
+		return 0
+	}
+	return c.Compare.cache.Hits()
+}
+
+// CollationDiffs returns the namespaces whose default collation differs
+// between source and dest
+func (c *Checker) CollationDiffs() []CollationDiff {
+	if c.Collations == nil {
+		return nil
+	}
+	return c.Collations.diffs
+}
+
+// QueryPlans returns the plans of the lookups explained with Explain
+func (c *Checker) QueryPlans() []queryPlan {
+	if c.Explain == nil {
+		return nil
+	}
+	return c.Explain.plans
+}
+
+// DedupEvictions returns how many ids were evicted from the dedup cache
+func (c *Checker) DedupEvictions() int {
+	if c.dedup == nil {
+		return 0
+	}
+	return c.dedup.evictions
+}
+
+// docSource looks up documents on one side of the comparison.
+// It returns mongo.ErrNoDocuments when the document does not exist.
+type docSource interface {
+	FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error)
+	// CountDocuments counts the documents matching filter, stopping at limit (0 = no limit)
+	CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error)
+}
+
+// mongoSource is a docSource backed by a live MongoDB client
+type mongoSource struct {
+	client *mongo.Client
+	// session, when set, is a causally consistent session used for every read
+	session mongo.Session
+	// maxTime, when set, bounds every query server-side (maxTimeMS)
+	maxTime time.Duration
+	// projection, when set, limits the fields FindOne returns
+	projection bson.D
+}
+
+// newMongoSource wraps client. With causal set, all reads go through a single
+// causally consistent session with majority read concern, so each read observes
+// at least everything the previous read on that cluster observed.
+func newMongoSource(client *mongo.Client, causal bool) (mongoSource, error) {
+	m := mongoSource{client: client}
+	if !causal {
+		return m, nil
+	}
+	sessOpts := options.Session().
+		SetCausalConsistency(true).
+		SetDefaultReadConcern(readconcern.Majority())
+	sess, err := client.StartSession(sessOpts)
+	if err != nil {
+		return m, fmt.Errorf("failed to start causally consistent session: %w", err)
+	}
+	m.session = sess
+	return m, nil
+}
+
+func (m mongoSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	if m.session != nil {
+		ctx = mongo.NewSessionContext(ctx, m.session)
+	}
+	opts := options.FindOne()
+	if m.maxTime > 0 {
+		opts.SetMaxTime(m.maxTime)
+	}
+	if m.projection != nil {
+		opts.SetProjection(m.projection)
+	}
+	doc, err := m.client.Database(db).Collection(col).FindOne(ctx, filter, opts).Raw()
+	var cryptErr mongo.MongocryptError
+	if errors.As(err, &cryptErr) {
+		return nil, decodeError{err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, decodeError{err}
+	}
+	return doc, nil
+}
+
+func (m mongoSource) CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error) {
+	if m.session != nil {
+		ctx = mongo.NewSessionContext(ctx, m.session)
+	}
+	opts := options.Count()
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	if m.maxTime > 0 {
+		opts.SetMaxTime(m.maxTime)
+	}
+	return m.client.Database(db).Collection(col).CountDocuments(ctx, filter, opts)
+}
+
+// close ends the session, if any
+func (m mongoSource) close(ctx context.Context) {
+	if m.session != nil {
+		m.session.EndSession(ctx)
+	}
+}
+
+// Checker reads log records, checks every referenced document and
+// accumulates per-namespace statistics.
+type Checker struct {
+	Src  docSource
+	Dest docSource
+
+	// State, when set, enables incremental mode: ids previously confirmed
+	// as Match are skipped unless ForceRecheck is set.
+	State        *StateStore
+	ForceRecheck bool
+
+	// LineFilter selects the messages of the failures to check
+	LineFilter *regexp.Regexp
+
+	// AttemptRegex extracts the retry attempt number from a message
+	AttemptRegex *regexp.Regexp
+
+	// IDExtractor reads the id of the failed document from a log message
+	IDExtractor IDExtractor
+
+	// LookupField is the document field the logged id is matched against
+	LookupField string
+
+	// RedactDetails scrubs host names, addresses and ports, and namespaces
+	// with RedactNamespaces, from the details of failed checks in the report
+	// and the other outputs; the log keeps them whole
+	RedactDetails    bool
+	RedactNamespaces bool
+
+	// MinMatchRate is the match rate, in percent, every namespace of the
+	// log must reach (0 = none), and NSMinMatchRate that of given
+	// namespaces, whether in the log or not; see SignOff
+	MinMatchRate   float64
+	NSMinMatchRate map[string]float64
+
+	// FailFast stops the run at the first discrepancy, for a quick yes/no
+	// answer to whether the clusters drifted
+	FailFast bool
+
+	// ModifiedSince, when set, skips the documents whose ModifiedField, a
+	// date or timestamp, is older on the source side, as SkippedOld
+	ModifiedSince time.Time
+	ModifiedField string
+
+	// Deterministic records the results of a worker pool in input order, as
+	// a single worker would, so that runs can be diffed
+	Deterministic bool
+
+	// OnlyStatus, when set, holds the statuses of the results listed in the
+	// report and the split output; the others are still counted in StatsMap
+	OnlyStatus map[string]bool
+
+	// StrictJSON stops the run at the first id that was found but could not
+	// be parsed, instead of counting it as unparsable and going on
+	StrictJSON bool
+
+	// TimeoutStatus reports lookups that timed out as Timeout instead of
+	// Error, so that a slow cluster is told apart from a failing one
+	TimeoutStatus bool
+
+	// ExtraFilter is AND-ed with every lookup, restricting the check to the
+	// documents it matches. Documents it excludes on both sides match.
+	ExtraFilter bson.M
+
+	// BothMissingStatus selects how a document missing from both sides is
+	// classified: bothMissingMatch, bothMissingDiscrepancy or bothMissingSeparate
+	BothMissingStatus string
+
+	// CompareMode is compareDeep, or compareBytes to require the documents
+	// to be byte-identical
+	CompareMode string
+
+	// Direction is directionBoth, or directionSource to leave the dest
+	// unqueried for documents missing from the source
+	Direction string
+
+	// SizeReport aggregates the BSON sizes of the documents found on both
+	// sides per namespace
+	SizeReport bool
+
+	// ConfirmExistsCount counts the documents matching each id on both
+	// sides, reporting DuplicateId when _id is not unique (corruption that
+	// bypassed the unique index)
+	ConfirmExistsCount bool
+
+	// CompareRoot, when set, is the dotted path of the subdocument compared
+	// instead of the whole document
+	CompareRoot string
+
+	// ChecksumField, when set, is the dotted path of a checksum stored in
+	// the documents, compared instead of the whole document
+	ChecksumField string
+
+	// Compare holds the deep comparison options
+	Compare *comparer
+
+	// DefaultDB and CollectionDBs give the database of the collections
+	// logged without one: CollectionDBs maps collection names to their
+	// database, and DefaultDB is that of the others
+	DefaultDB     string
+	CollectionDBs map[string]string
+
+	// SearchColumns, when set, are the CSV columns whose values, joined
+	// with spaces, are searched for the namespace and id instead of the
+	// message column
+	SearchColumns []int
+
+	// NamespaceColumn, when >= 0, is the CSV column holding the namespace,
+	// used instead of extracting it from the message
+	NamespaceColumn int
+
+	// DedupCacheSize bounds how many recently checked ids are remembered so
+	// that repeated log lines are checked once (0 = no dedup). Ids evicted
+	// from the cache may be checked again.
+	DedupCacheSize int
+	dedup          *lruSet
+
+	// Workers is the number of ids checked concurrently. AutoWorkers sizes
+	// the pool from the observed latency and error rate instead, up to
+	// MaxWorkers.
+	Workers     int
+	AutoWorkers bool
+	MaxWorkers  int
+	pool        *workerPool
+
+	// InterCheckDelay, plus a random jitter of up to InterCheckJitter, is
+	// waited by each worker between two checks to smooth the query load
+	InterCheckDelay  time.Duration
+	InterCheckJitter time.Duration
+	pacer            *checkPacer // paces checks run without a pool
+
+	// StopOnError ends the run at the first check that failed because a
+	// cluster became unreachable, once retries are exhausted. Other errors
+	// are recorded per document and never stop the run.
+	StopOnError bool
+
+	// ErrorBufferSize is the number of most recent per-line errors kept for
+	// the Recent Errors section of the report (0 = none)
+	ErrorBufferSize int
+	recentErrors    *errorRing
+
+	// HasHeader says whether the first row of the log is a header; Header
+	// holds it once read
+	HasHeader bool
+	Header    []string
+
+	// MaxLines stops reading after this many data rows (0 = unlimited)
+	MaxLines int
+
+	// CategoryRegexes classify each message into an error category
+	CategoryRegexes []*regexp.Regexp
+
+	// DumpDocs keeps the full documents of Mismatch results, and DumpMissing
+	// those of MissingInSource/MissingInDest results, for the report
+	DumpDocs    bool
+	DumpMissing bool
+	// DumpMaxBytes caps the BSON size of a dumped document (0 = no cap)
+	DumpMaxBytes int
+
+	// PrettyDiff renders each Mismatch as a unified diff of the canonical
+	// Extended JSON documents; Color adds ANSI colors to it in text reports
+	PrettyDiff bool
+	Color      bool
+
+	// TimeSeries maps time-series namespaces to the fields identifying a
+	// measurement. Their log lines are checked by measurement, looked up by
+	// time and metadata, instead of by id.
+	TimeSeries map[string]timeSeriesSpec
+
+	// GridFS holds the files namespaces of GridFS buckets: a file whose files
+	// documents match is then compared chunk by chunk
+	GridFS map[string]bool
+
+	// Capped holds the namespaces of capped collections, reconciled by
+	// RunCapped; their logged ids are not looked up
+	Capped map[string]bool
+
+	// Repair, when set, receives a statement copying the source document to
+	// dest for every MissingInDest and Mismatch
+	Repair *repairScript
+
+	// DiscrepancySink, when set, receives discrepancies as they are found
+	// instead of DiscrepancyList, so they do not accumulate in memory
+	DiscrepancySink func(CheckResult)
+
+	// SplitOutput, when set, also receives every result other than a Match,
+	// errors included, to be written to a file per status
+	SplitOutput *splitOutput
+
+	// Collations, when set, compares the default collations of the
+	// namespaces on both sides as they are first checked
+	Collations *collationCheck
+
+	// Explain, when set, explains the lookups of the namespaces on both
+	// sides as they are first checked
+	Explain *explainCheck
+
+	// Results, when set, receives every result, matches included, to be
+	// inserted into the -results-collection
+	Results *resultsWriter
+
+	// TopN is the number of namespaces listed under Top Offenders
+	TopN int
+
+	// Tracer records a span for the run and for every check. It defaults
+	// to a no-op tracer.
+	Tracer trace.Tracer
+
+	// StatsFile, when set, is rewritten with a snapshot of StatsMap at most
+	// every StatsInterval while the run is in progress
+	StatsFile     string
+	StatsInterval time.Duration
+	statsFlushed  time.Time
+
+	// Progress, when set, is updated as the run advances
+	Progress *Progress
+
+	// ExpectedChecks is the number of checks the run is expected to make,
+	// estimated or counted before it starts, or 0 when unknown. It is
+	// reported in the stats file so that watchers can tell how far along the
+	// run is.
+	ExpectedChecks int64
+
+	// Logger receives per-line diagnostics. Quiet mode discards them.
+	Logger *log.Logger
+
+	StatsMap        map[string]*Stats
+	DiscrepancyList []CheckResult
+
+	RowsRead  int  // Data rows read from the log
+	Truncated bool // Reading stopped at MaxLines before the end of the log
+
+	// MatchedLines counts the rows the filter selected. None means the
+	// filter or patterns are likely wrong: nothing was checked.
+	MatchedLines int
+	// logRun is set by Run, whose checks are the log lines the filter
+	// selects, and cappedRun by RunCapped, whose checks are not; see
+	// NoMatches
+	logRun, cappedRun bool
+
+	// HeaderRowsSkipped counts header rows found after the first line, as in
+	// concatenated exports; they are not data rows
+	HeaderRowsSkipped int
+
+	// MaxLineBytes caps the length of an input line (0 = no limit); longer
+	// lines are skipped and counted in OversizedLines
+	MaxLineBytes   int
+	OversizedLines int
+
+	// UnresolvedNamespaces counts the lines skipped because they name a
+	// collection without its database and neither DefaultDB nor
+	// CollectionDBs supplies it
+	UnresolvedNamespaces int
+
+	// SkippedLines counts the lines skipped, unchecked, by reason code;
+	// SkipLog, when set, also receives the line number of each
+	SkippedLines map[string]int
+	SkipLog      *skipLog
+
+	// TimeHistogram, when set, counts the checked log entries by the time
+	// bucket of their logged date
+	TimeHistogram *timeHistogram
+
+	// LogAge is the distribution of the age of the checked log entries
+	LogAge ageStats
+	now    func() time.Time // clock of LogAge, time.Now when nil
+
+	// StopReason explains why StopOnError, StrictJSON or FailFast ended the
+	// run early ("" when none did), and StopFlag names which one did
+	StopReason string
+	StopFlag   string
+}
+
+// NoMatches reports whether the run read a log of which no line matched the
+// filter, and so checked nothing. Runs of an ids file, a full scan or a
+// capped collection do not go through the filter.
+func (c *Checker) NoMatches() bool {
+	return c.logRun && !c.cappedRun && c.MatchedLines == 0
+}
+
+// stop ends the run early: no further line is read
+func (c *Checker) stop(flag, reason string) {
+	c.StopFlag, c.StopReason = flag, reason
+}
+
+// NewChecker creates a Checker comparing src against dest
+func NewChecker(src, dest docSource) *Checker {
+	categories, _ := compilePatterns(defaultCategoryPatterns)
+	lineFilter, _ := newLineFilter("", false)
+	return &Checker{
+		Src:               src,
+		Dest:              dest,
+		LineFilter:        lineFilter,
+		AttemptRegex:      regexp.MustCompile(defaultAttemptPattern),
+		IDExtractor:       jsonIDExtractor{},
+		LookupField:       "_id",
+		NamespaceColumn:   -1,
+		TopN:              10,
+		BothMissingStatus: bothMissingMatch,
+		Direction:         directionBoth,
+		CompareMode:       compareDeep,
+		ErrorBufferSize:   defaultErrorBufferSize,
+		Workers:           1,
+		MaxWorkers:        defaultMaxWorkers,
+		HasHeader:         true,
+		MaxLineBytes:      defaultMaxLineBytes,
+		Compare:           &comparer{},
+		CategoryRegexes:   categories,
+		Logger:            log.Default(),
+		Tracer:            noop.NewTracerProvider().Tracer(""),
+		StatsMap:          make(map[string]*Stats),
+	}
+}
+
+// Run processes every record of the CSV log in r.
+func (c *Checker) Run(ctx context.Context, r io.Reader) error {
+	ctx, span := c.Tracer.Start(ctx, "run")
+	defer span.End()
+	c.logRun = true
+
+	// Lookups run sequentially unless Workers or AutoWorkers ask for a pool
+	c.startPool(ctx)
+	defer c.drainPool(ctx)
+
+	return c.readLog(r, func(lineNum int, record []string) {
+		c.processRecordSafe(ctx, lineNum, record)
+	})
+}
+
+// defaultHeaderToken is the first column name of the log export, used to
+// spot repeated header rows when the log's own header was not read
+const defaultHeaderToken = "Date"
+
+// repeatedHeader reports whether record is a header row, as found in the
+// middle of logs concatenated from several exports: its first field is the
+// first column name of the header
+func (c *Checker) repeatedHeader(record []string) bool {
+	token := defaultHeaderToken
+	if len(c.Header) > 0 && !looksLikeTimestamp(c.Header[0]) {
+		token = strings.TrimPrefix(c.Header[0], "\ufeff")
+	}
+	return len(record) > 0 && strings.TrimPrefix(strings.TrimSpace(record[0]), "\ufeff") == token
+}
+
+// readLog reads the CSV log in r and calls fn for each data row, honoring
+// MaxLines. Rows the CSV reader rejects, and lines over MaxLineBytes, are
+// logged and skipped.
+func (c *Checker) readLog(r io.Reader, fn func(lineNum int, record []string)) error {
+	reader := csv.NewReader(newLineLimitReader(r, c.MaxLineBytes, func(line, size int) {
+		c.OversizedLines++
+		c.skip(line, SkipOversized)
+		msg := fmt.Sprintf("input line %d is %d bytes, over -max-line-bytes %d; skipped", line, size, c.MaxLineBytes)
+		c.Logger.Printf("WARNING: %s", msg)
+		c.recordError(line, "", msg)
+	}))
+	lineNum := 0
+	if c.HasHeader {
+		header, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("failed to read header: %w", err)
+		}
+		lineNum++
+		if len(header) > 0 && looksLikeTimestamp(header[0]) {
+			c.Logger.Printf("WARNING: the header row starts with a timestamp (%q); if the log has no header, pass -has-header=false or its first row is skipped", header[0])
+		} else {
+			c.Logger.Printf("Header columns: %s", strings.Join(header, ", "))
+		}
+		c.Header = header
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if c.StopReason != "" {
+			break
+		}
+		if c.MaxLines > 0 && c.RowsRead >= c.MaxLines {
+			c.Truncated = true
+			break
+		}
+		lineNum++
+		if err == nil && c.repeatedHeader(record) {
+			c.HeaderRowsSkipped++
+			c.skip(lineNum, SkipHeader)
+			c.Logger.Printf("Line %d: skipping repeated header row", lineNum)
+			continue
+		}
+		c.RowsRead++
+		if c.Progress != nil {
+			c.Progress.Rows.Add(1)
+		}
+		if err != nil {
+			c.Logger.Printf("Error reading CSV line %d: %v", lineNum, err)
+			c.skip(lineNum, SkipCSVError)
+			c.recordError(lineNum, "", err.Error())
+			continue
+		}
+
+		fn(lineNum, record)
+	}
+	return nil
+}
+
+// RunIDs checks the ids listed in r, one "namespace,id" pair per line, with
+// the id in the same forms accepted by -check-id. Blank lines are ignored.
+func (c *Checker) RunIDs(ctx context.Context, r io.Reader) error {
+	ctx, span := c.Tracer.Start(ctx, "run")
+	defer span.End()
+	c.startPool(ctx)
+	defer c.drainPool(ctx)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if c.StopReason != "" {
+			break
+		}
+		if c.MaxLines > 0 && c.RowsRead >= c.MaxLines {
+			c.Truncated = true
+			break
+		}
+		c.RowsRead++
+		if c.Progress != nil {
+			c.Progress.Rows.Add(1)
+		}
+
+		namespace, idArg, ok := strings.Cut(line, ",")
+		if !ok {
+			c.Logger.Printf("Line %d: expected namespace,id", lineNum)
+			c.skip(lineNum, SkipNoNamespace)
+			continue
+		}
+		id, err := parseIDArg(strings.TrimSpace(idArg))
+		if err != nil {
+			c.stats(strings.TrimSpace(namespace)).ParseFailures++
+			c.skip(lineNum, SkipIDParse)
+			c.Logger.Printf("Line %d: %v", lineNum, err)
+			c.strictParseFailure(lineNum, err)
+			continue
+		}
+		c.checkAndRecord(ctx, lineNum, strings.TrimSpace(namespace), id)
+	}
+	return scanner.Err()
+}
+
+// strictParseFailure stops the run, with StrictJSON, at an id that was found
+// but could not be parsed
+func (c *Checker) strictParseFailure(lineNum int, err error) {
+	if c.StrictJSON {
+		c.stop("-strict-json", fmt.Sprintf("unparsable id at line %d: %v", lineNum, err))
+	}
+}
+
+// processRecordSafe runs processRecord, logging and skipping a line whose
+// processing panics instead of ending the run
+func (c *Checker) processRecordSafe(ctx context.Context, lineNum int, record []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.Logger.Printf("Line %d: panic while processing line: %v; line: %q", lineNum, r, record)
+		}
+	}()
+	c.processRecord(ctx, lineNum, record)
+}
+
+func (c *Checker) processRecord(ctx context.Context, lineNum int, record []string) {
+	message, ok := c.messageOf(lineNum, record)
+	if !ok {
+		return
+	}
+
+	if !c.selected(message) {
+		c.skip(lineNum, SkipFiltered)
+		return
+	}
+	c.MatchedLines++
+
+	namespace, ok := c.namespaceOf(lineNum, record, message)
+	if !ok {
+		return
+	}
+
+	c.recordLogAge(record[0])
+	c.recordTime(record[0])
+
+	s := c.stats(namespace)
+	if s.Categories == nil {
+		s.Categories = make(map[string]int)
+	}
+	s.Categories[extractCategory(c.CategoryRegexes, message)]++
+
+	if attempt, ok := extractAttempt(c.AttemptRegex, message); ok {
+		if s.Attempts == nil {
+			s.Attempts = make(map[int]int)
+		}
+		s.Attempts[attempt]++
+	}
+
+	if spec, ok := c.TimeSeries[namespace]; ok {
+		key, err := spec.measurementKey(message)
+		if err != nil {
+			s.ParseFailures++
+			c.skip(lineNum, SkipIDParse)
+			c.Logger.Printf("Line %d: %v", lineNum, err)
+			return
+		}
+		c.checkAndRecord(ctx, lineNum, namespace, key)
+		return
+	}
+
+	id, err := c.extractID(message)
+	if err != nil {
+		s.ParseFailures++
+		if errors.Is(err, errNoID) {
+			c.skip(lineNum, SkipNoID)
+		} else {
+			c.skip(lineNum, SkipIDParse)
+			c.Logger.Printf("Line %d: %v", lineNum, err)
+			c.strictParseFailure(lineNum, err)
+		}
+		return
+	}
+
+	c.checkAndRecord(ctx, lineNum, namespace, id)
+}
+
+// checkDocSafe runs checkDoc, turning a panic into an Error result for the id
+func (c *Checker) checkDocSafe(ctx context.Context, lineNum int, db, col string, id interface{}) (res CheckResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.Logger.Printf("Line %d: panic while checking %s.%s id %v: %v", lineNum, db, col, id, r)
+			res = CheckResult{ID: id, Status: StatusError, Details: fmt.Sprintf("panic: %v", r), ErrClass: ErrClassPanic}
+		}
+	}()
+	return c.checkDoc(ctx, db, col, id)
+}
+
+// checkAndRecord checks one id read at lineNum of the input and records the result
+func (c *Checker) checkAndRecord(ctx context.Context, lineNum int, namespace string, idVal interface{}) {
+	dbName, colName, err := splitNamespace(namespace)
+	if err != nil {
+		c.Logger.Printf("Line %d: %v", lineNum, err)
+		return
+	}
+
+	if c.Capped[namespace] {
+		c.skip(lineNum, SkipCapped)
+		return
+	}
+
+	if c.State != nil && !c.ForceRecheck && c.State.PreviouslyMatched(namespace, idVal) {
+		c.stats(namespace).Skipped++
+		c.skip(lineNum, SkipPreviouslyMatched)
+		return
+	}
+
+	if c.DedupCacheSize > 0 {
+		if c.dedup == nil {
+			c.dedup = newLRUSet(c.DedupCacheSize)
+		}
+		if c.dedup.Add(idKey(namespace, idVal)) {
+			c.stats(namespace).Duplicates++
+			c.skip(lineNum, SkipDuplicate)
+			return
+		}
+	}
+
+	if c.Collations != nil {
+		c.Collations.check(ctx, c.Logger, namespace, dbName, colName)
+	}
+	if c.Explain != nil {
+		c.Explain.check(ctx, c.Logger, namespace, dbName, colName, lookupFilter(c.LookupField, idVal, c.ExtraFilter))
+	}
+
+	if c.pool != nil {
+		c.submit(ctx, checkJob{lineNum: lineNum, namespace: namespace, db: dbName, col: colName, id: idVal})
+		return
+	}
+	if c.pacer == nil {
+		c.pacer = c.newPacer()
+	}
+	c.pacer.wait(ctx)
+	c.finishCheck(lineNum, namespace, c.checkDocSafe(ctx, lineNum, dbName, colName, idVal))
+}
+
+// finishCheck records the result of the check of an id read at lineNum
+func (c *Checker) finishCheck(lineNum int, namespace string, res CheckResult) {
+	res.Namespace = namespace
+	res.Line = lineNum
+
+	if c.State != nil {
+		c.State.Record(res)
+	}
+
+	if failedStatus(res.Status) {
+		c.Logger.Printf("Line %d: %s checking doc: %v", lineNum, res.Status, res.Details)
+		if c.RedactDetails {
+			// The log above keeps the full details
+			ns := ""
+			if c.RedactNamespaces {
+				ns = namespace
+			}
+			res.Details = redactDetails(res.Details, ns)
+		}
+		c.recordError(lineNum, namespace, res.Details)
+		if c.StopOnError && res.ErrClass == ErrClassNetwork {
+			c.stop("-stop-on-error", fmt.Sprintf("connection lost at line %d: %s", lineNum, res.Details))
+		}
+	}
+	// Checks still in flight when FailFast stopped the run are dropped, so
+	// that the report holds the first discrepancy alone
+	if c.FailFast && c.StopFlag == "-fail-fast" {
+		return
+	}
+	if c.record(res) && c.FailFast {
+		c.stop("-fail-fast", fmt.Sprintf("first discrepancy at line %d: %s %s", lineNum, namespace, res.Status))
+	}
+}
+
+// recordError keeps a per-line error for the Recent Errors section
+func (c *Checker) recordError(lineNum int, namespace, message string) {
+	if c.ErrorBufferSize <= 0 {
+		return
+	}
+	if c.recentErrors == nil {
+		c.recentErrors = newErrorRing(c.ErrorBufferSize)
+	}
+	c.recentErrors.Add(recentError{Line: lineNum, Namespace: namespace, Message: message})
+}
+
+// messageOf returns the text of a record searched for the namespace and
+// id: the message column, or the SearchColumns joined with spaces. A record
+// too short for them is logged and skipped.
+func (c *Checker) messageOf(lineNum int, record []string) (string, bool) {
+	columns := c.SearchColumns
+	if len(columns) == 0 {
+		columns = []int{messageColumn}
+	}
+	parts := make([]string, len(columns))
+	for i, col := range columns {
+		if col >= len(record) {
+			c.Logger.Printf("Line %d: message column %d out of range (%d columns)", lineNum, col, len(record))
+			c.skip(lineNum, SkipNoColumn)
+			return "", false
+		}
+		parts[i] = record[col]
+	}
+	return strings.Join(parts, " "), true
+}
+
+// parseColumns parses a comma separated list of zero-based CSV columns; an
+// empty list is nil
+func parseColumns(list string) ([]int, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var columns []int
+	for _, f := range strings.Split(list, ",") {
+		col, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || col < 0 {
+			return nil, fmt.Errorf("%q is not a column number", f)
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// namespaceOf extracts the namespace of a record, either from the configured
+// CSV column or from the message
+func (c *Checker) namespaceOf(lineNum int, record []string, message string) (string, bool) {
+	if c.NamespaceColumn >= 0 {
+		if c.NamespaceColumn >= len(record) {
+			c.Logger.Printf("Line %d: namespace column %d out of range (%d columns)", lineNum, c.NamespaceColumn, len(record))
+			c.skip(lineNum, SkipNoNamespace)
+			return "", false
+		}
+		namespace := strings.TrimSpace(record[c.NamespaceColumn])
+		if bareCollectionFormat.MatchString(namespace) {
+			return c.qualify(lineNum, namespace)
+		}
+		if !validNamespace(namespace) {
+			c.Logger.Printf("Line %d: namespace column value %q is not of the form db.collection", lineNum, namespace)
+			c.skip(lineNum, SkipNoNamespace)
+			return "", false
+		}
+		return namespace, true
+	}
+
+	if namespace, ok := extractNamespace(message); ok {
+		return namespace, true
+	}
+	if col, ok := extractBareCollection(message); ok {
+		return c.qualify(lineNum, col)
+	}
+	c.skip(lineNum, SkipNoNamespace)
+	return "", false
+}
+
+// qualify returns the namespace of a collection logged without its
+// database: the database CollectionDBs maps it to, or DefaultDB. Without
+// either the line is skipped and counted in UnresolvedNamespaces.
+func (c *Checker) qualify(lineNum int, col string) (string, bool) {
+	db, ok := c.CollectionDBs[col]
+	if !ok {
+		db = c.DefaultDB
+	}
+	if db == "" {
+		c.UnresolvedNamespaces++
+		c.skip(lineNum, SkipUnresolvedNS)
+		c.Logger.Printf("Line %d: collection %s is logged without its database; pass -default-db or -collection-db-map", lineNum, col)
+		return "", false
+	}
+	return db + "." + col, true
+}
+
+// stats returns the statistics for a namespace, creating them if needed
+func (c *Checker) stats(namespace string) *Stats {
+	if _, ok := c.StatsMap[namespace]; !ok {
+		c.StatsMap[namespace] = &Stats{}
+	}
+	return c.StatsMap[namespace]
+}
+
+// record updates the stats and discrepancy list with a check result, and
+// reports whether it is a discrepancy
+func (c *Checker) record(res CheckResult) bool {
+	s := c.stats(res.Namespace)
+	s.TotalChecks++
+
+	if c.SizeReport && res.SourceSize > 0 && res.DestSize > 0 {
+		if s.Sizes == nil {
+			s.Sizes = &SizeStats{}
+		}
+		s.Sizes.add(res.SourceSize, res.DestSize)
+	}
+
+	discrepancy := true
+	switch res.Status {
+	case StatusMatch:
+		s.Matches++
+		discrepancy = false
+	case StatusMismatch:
+		s.Mismatches++
+	case StatusMissingInSource:
+		s.MissingInSource++
+	case StatusMissingInDest:
+		s.MissingInDest++
+	case StatusIDTypeMismatch:
+		s.IDTypeMismatches++
+	case StatusMultipleMatches:
+		s.MultipleMatches++
+	case StatusMissingInBoth:
+		s.MissingInBoth++
+	case StatusRootMissing:
+		s.RootMissing++
+	case StatusDuplicateID:
+		s.DuplicateIDs++
+	case StatusDecodeError:
+		s.DecodeErrors++
+	case StatusError:
+		s.Errors++
+		if s.ErrorClasses == nil {
+			s.ErrorClasses = make(map[string]int)
+		}
+		s.ErrorClasses[res.ErrClass]++
+		discrepancy = false
+	case StatusTimeout:
+		s.Timeouts++
+		discrepancy = false
+	case StatusNotInSource:
+		s.NotInSource++
+		discrepancy = false
+	case StatusSkippedOld:
+		s.SkippedOld++
+		discrepancy = false
+	case StatusOutsideCapWindow:
+		s.OutsideCapWindow++
+		discrepancy = false
+	}
+	listed := c.OnlyStatus == nil || c.OnlyStatus[res.Status]
+	if c.SplitOutput != nil && listed {
+		c.SplitOutput.WriteResult(c.Compare.mask.result(res, c.LookupField))
+	}
+	if c.Results != nil {
+		c.Results.WriteResult(c.Compare.mask.result(res, c.LookupField))
+	}
+	if discrepancy && listed {
+		res = c.Compare.mask.result(res, c.LookupField)
+		if c.DiscrepancySink != nil {
+			c.DiscrepancySink(res)
+		} else {
+			c.DiscrepancyList = append(c.DiscrepancyList, res)
+		}
+	}
+
+	if c.Progress != nil {
+		c.Progress.observe(res, discrepancy)
+	}
+	c.maybeFlushStats()
+	return discrepancy
+}
+
+// compareRoots compares only the values at CompareRoot of two documents.
+// A root missing on either side is reported as StatusRootMissing.
+func (c *Checker) compareRoots(id interface{}, srcDoc, destDoc bson.Raw) CheckResult {
+	keys := strings.Split(c.CompareRoot, ".")
+	srcRoot, srcErr := srcDoc.LookupErr(keys...)
+	destRoot, destErr := destDoc.LookupErr(keys...)
+	var missing []string
+	if srcErr != nil {
+		missing = append(missing, "source")
+	}
+	if destErr != nil {
+		missing = append(missing, "dest")
+	}
+	if len(missing) > 0 {
+		return CheckResult{ID: id, Status: StatusRootMissing,
+			Details: fmt.Sprintf("%s missing in %s", c.CompareRoot, strings.Join(missing, " and "))}
+	}
+
+	var diffs []FieldDiff
+	c.Compare.diffValue(c.CompareRoot, srcRoot, destRoot, &diffs)
+	if len(diffs) == 0 {
+		return CheckResult{ID: id, Status: StatusMatch}
+	}
+	res := CheckResult{ID: id, Status: StatusMismatch, Diffs: diffs}
+	if c.DumpDocs {
+		res.SourceDoc, res.DestDoc = srcDoc, destDoc
+	}
+	if c.PrettyDiff {
+		res.PrettyDiff = unifiedDocDiff(c.Compare.mask.doc(srcDoc), c.Compare.mask.doc(destDoc))
+	}
+	return res
+}
+
+// compareChecksums compares only the values at ChecksumField of two
+// documents. A document lacking the checksum cannot be reconciled this way
+// and is an Error.
+func (c *Checker) compareChecksums(id interface{}, srcDoc, destDoc bson.Raw) CheckResult {
+	keys := strings.Split(c.ChecksumField, ".")
+	srcSum, srcErr := srcDoc.LookupErr(keys...)
+	destSum, destErr := destDoc.LookupErr(keys...)
+	var missing []string
+	if srcErr != nil {
+		missing = append(missing, "source")
+	}
+	if destErr != nil {
+		missing = append(missing, "dest")
+	}
+	if len(missing) > 0 {
+		return CheckResult{ID: id, Status: StatusError, ErrClass: ErrClassNoChecksum,
+			Details: fmt.Sprintf("Checksum %s missing in %s", c.ChecksumField, strings.Join(missing, " and "))}
+	}
+	if srcSum.Equal(destSum) {
+		return CheckResult{ID: id, Status: StatusMatch}
+	}
+	res := CheckResult{ID: id, Status: StatusMismatch,
+		Diffs: []FieldDiff{{Path: c.ChecksumField, Kind: DiffChanged,
+			Source: c.Compare.mask.format(c.ChecksumField, srcSum), Dest: c.Compare.mask.format(c.ChecksumField, destSum)}}}
+	if c.DumpDocs {
+		res.SourceDoc, res.DestDoc = srcDoc, destDoc
+	}
+	return res
+}
+
+// checksumProjection returns the projection fetching only the checksum at
+// field, and the lookup field when it is not _id (which is always returned)
+func checksumProjection(field, lookupField string) bson.D {
+	proj := bson.D{{Key: field, Value: 1}}
+	if lookupField != "_id" && lookupField != field {
+		proj = append(proj, bson.E{Key: lookupField, Value: 1})
+	}
+	return proj
+}
+
+// modifiedAt returns the time of the date or timestamp at the dotted path
+// field of doc
+func modifiedAt(doc bson.Raw, field string) (time.Time, bool) {
+	v, err := doc.LookupErr(strings.Split(field, ".")...)
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch v.Type {
+	case bsontype.DateTime:
+		return v.Time(), true
+	case bsontype.Timestamp:
+		t, _ := v.Timestamp()
+		return time.Unix(int64(t), 0), true
+	}
+	return time.Time{}, false
+}
+
+// checkUnique verifies that the lookup field matched a single document on
+// each side where it was found. It returns false with a MultipleMatches
+// (DuplicateId when the lookup field is _id) or Error result otherwise.
+func (c *Checker) checkUnique(ctx context.Context, db, col string, srcID, destID interface{}, srcMissing, destMissing bool) (CheckResult, bool) {
+	var srcCount, destCount int64
+	var err error
+	if !srcMissing {
+		srcCount, err = c.Src.CountDocuments(ctx, db, col, bson.M{c.LookupField: srcID}, 2)
+		if err != nil {
+			return CheckResult{Status: StatusError, Details: fmt.Sprintf("Source count error: %v", err), ErrClass: classifyError(err)}, false
+		}
+	}
+	if !destMissing {
+		destCount, err = c.Dest.CountDocuments(ctx, db, col, bson.M{c.LookupField: destID}, 2)
+		if err != nil {
+			return CheckResult{Status: StatusError, Details: fmt.Sprintf("Dest count error: %v", err), ErrClass: classifyError(err)}, false
+		}
+	}
+	if (srcCount > 1 || destCount > 1) && c.LookupField == "_id" {
+		return CheckResult{Status: StatusDuplicateID,
+			Details: fmt.Sprintf("_id is duplicated: source matches %s, dest matches %s", countLabel(srcCount), countLabel(destCount))}, false
+	}
+	if srcCount > 1 || destCount > 1 {
+		return CheckResult{Status: StatusMultipleMatches,
+			Details: fmt.Sprintf("%s is not unique: source matches %s, dest matches %s", c.LookupField, countLabel(srcCount), countLabel(destCount))}, false
+	}
+	return CheckResult{}, true
+}
+
+// countLabel renders a count obtained with a limit of 2
+func countLabel(n int64) string {
+	if n > 1 {
+		return "2+"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// checkOne checks a single namespace/id pair given on the command line
+func (c *Checker) checkOne(ctx context.Context, namespace, idArg string) (CheckResult, error) {
+	dbName, colName, err := splitNamespace(namespace)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	id, err := parseIDArg(idArg)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	res := c.checkDoc(ctx, dbName, colName, id)
+	res.Namespace = namespace
+	return c.Compare.mask.result(res, c.LookupField), nil
+}
+
+// findDoc looks up the document whose field equals id on one side. When it is
+// not found, the lookup is retried with the id coerced to its alternate type
+// (string <-> ObjectID). It returns the id under which the document was found.
+// The extra filter, if any, is AND-ed with the lookup.
+func findDoc(ctx context.Context, side docSource, db, col, field string, id interface{}, extra bson.M) (bson.Raw, interface{}, error) {
+	doc, err := side.FindOne(ctx, db, col, lookupFilter(field, id, extra))
+	if err != mongo.ErrNoDocuments {
+		return doc, id, err
+	}
+	alt, ok := coerceID(id)
+	if !ok {
+		return nil, id, err
+	}
+	doc, altErr := side.FindOne(ctx, db, col, lookupFilter(field, alt, extra))
+	if altErr != nil {
+		// Report the original miss, or the real error of the retry
+		if altErr == mongo.ErrNoDocuments {
+			return nil, id, err
+		}
+		return nil, id, altErr
+	}
+	return doc, alt, nil
+}
+
+// lookupFilter matches the documents whose field equals id and that match
+// extra. Filter documents AND their top-level conditions, so extra is
+// merged in; parseExtraFilter refuses one that constrains field itself.
+func lookupFilter(field string, id interface{}, extra bson.M) bson.M {
+	filter := bson.M{field: id}
+	for k, v := range extra {
+		filter[k] = v
+	}
+	return filter
+}
+
+// parseExtraFilter parses an -extra-filter query document. It may not
+// constrain the lookup field, whose condition it would replace.
+func parseExtraFilter(s, lookupField string) (bson.M, error) {
+	var filter bson.M
+	if err := bson.UnmarshalExtJSON([]byte(s), false, &filter); err != nil {
+		return nil, fmt.Errorf("not an Extended JSON document: %w", err)
+	}
+	if _, ok := filter[lookupField]; ok {
+		return nil, fmt.Errorf("the filter may not constrain the lookup field %s", lookupField)
+	}
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// findFiltered looks id up on one side with ExtraFilter. When no document
+// matches, it looks again without the filter, and sets excluded when the
+// document exists but falls outside the filter.
+func (c *Checker) findFiltered(ctx context.Context, side docSource, db, col string, id interface{}) (doc bson.Raw, foundID interface{}, excluded bool, err error) {
+	doc, foundID, err = findDoc(ctx, side, db, col, c.LookupField, id, c.ExtraFilter)
+	if err != mongo.ErrNoDocuments || c.ExtraFilter == nil {
+		return doc, foundID, false, err
+	}
+	all, allID, allErr := findDoc(ctx, side, db, col, c.LookupField, id, nil)
+	if allErr != nil {
+		// Missing altogether, or the real error of the second lookup
+		return nil, id, false, allErr
+	}
+	return all, allID, true, mongo.ErrNoDocuments
+}
+
+func (c *Checker) checkDoc(ctx context.Context, db, col string, id interface{}) CheckResult {
+	ctx, span := c.Tracer.Start(ctx, "checkDoc")
+	res := c.lookupAndCompare(ctx, db, col, id)
+	if c.TimeoutStatus && res.Status == StatusError && res.ErrClass == ErrClassTimeout {
+		res.Status = StatusTimeout
+	}
+	endCheckSpan(span, db+"."+col, res)
+	return res
+}
+
+// lookupAndCompare finds the document on both sides and compares them
+func (c *Checker) lookupAndCompare(ctx context.Context, db, col string, id interface{}) CheckResult {
+	if _, ok := c.TimeSeries[db+"."+col]; ok {
+		if key, ok := id.(bson.D); ok {
+			return c.compareMeasurement(ctx, db, col, key)
+		}
+	}
+
+	var srcMissing, destMissing bool
+
+	// Find in Source
+	srcDoc, srcID, srcExcluded, err := c.findFiltered(ctx, c.Src, db, col, id)
+	if err == mongo.ErrNoDocuments {
+		srcMissing = true
+	} else if err != nil {
+		return lookupError(id, "Source", err)
+	}
+	// With the source authoritative, what dest holds for a document the
+	// source lacks does not matter
+	if srcMissing && !srcExcluded && c.Direction == directionSource {
+		return CheckResult{ID: id, Status: StatusNotInSource, Details: "Missing from the source; dest not queried (-direction source)"}
+	}
+	// Documents not modified since the cutoff are out of the delta checked
+	if !srcMissing && !c.ModifiedSince.IsZero() {
+		if t, ok := modifiedAt(srcDoc, c.ModifiedField); ok && t.Before(c.ModifiedSince) {
+			return CheckResult{ID: id, Status: StatusSkippedOld, Details: fmt.Sprintf("Source %s %s is before -modified-since; dest not queried", c.ModifiedField, t.UTC().Format(time.RFC3339))}
+		}
+	}
+
+	// Find in Dest
+	destDoc, destID, destExcluded, err := c.findFiltered(ctx, c.Dest, db, col, id)
+	if err == mongo.ErrNoDocuments {
+		destMissing = true
+	} else if err != nil {
+		return lookupError(id, "Dest", err)
+	}
+
+	if srcExcluded || destExcluded {
+		return c.compareExcluded(id, srcDoc, destDoc, srcMissing, destMissing)
+	}
+
+	// A lookup field other than _id may match several documents, and so may
+	// a corrupt _id when ConfirmExistsCount asks to check
+	if c.LookupField != "_id" || c.ConfirmExistsCount {
+		if res, ok := c.checkUnique(ctx, db, col, srcID, destID, srcMissing, destMissing); !ok {
+			res.ID = id
+			return res
+		}
+	}
+	res := c.compareLookups(db, col, id, srcDoc, destDoc, srcID, destID, srcMissing, destMissing)
+	if res.Status == StatusMatch && !srcMissing && !destMissing && c.GridFS[db+"."+col] {
+		return c.compareChunks(ctx, db, col, id, srcDoc, srcID, destID)
+	}
+	return res
+}
+
+// lookupError reports the failed lookup of id on side: a DecodeError for a
+// document found but unreadable, an Error otherwise
+func lookupError(id interface{}, side string, err error) CheckResult {
+	var decodeErr decodeError
+	if errors.As(err, &decodeErr) {
+		return CheckResult{ID: id, Status: StatusDecodeError, Details: fmt.Sprintf("%s document exists but is unreadable: %v", side, decodeErr.err)}
+	}
+	return CheckResult{ID: id, Status: StatusError, Details: fmt.Sprintf("%s error: %v", side, err), ErrClass: classifyError(err)}
+}
+
+// compareLookups compares the outcome of the lookups of id on both sides:
+// the documents found, or which side is missing it
+func (c *Checker) compareLookups(db, col string, id interface{}, srcDoc, destDoc bson.Raw, srcID, destID interface{}, srcMissing, destMissing bool) CheckResult {
+	// If both are missing, both sides agree the doc doesn't exist. By default
+	// that's a match, but the log said its write failed, so it may be flagged.
+	if srcMissing && destMissing {
+		status := StatusMatch
+		switch c.BothMissingStatus {
+		case bothMissingDiscrepancy:
+			status = StatusMismatch
+		case bothMissingSeparate:
+			status = StatusMissingInBoth
+		}
+		return CheckResult{ID: id, Status: status, Details: "Document missing from both databases"}
+	}
+
+	// If only one is missing, that's a discrepancy
+	if srcMissing {
+		res := CheckResult{ID: id, Status: StatusMissingInSource}
+		if c.DumpMissing {
+			res.DestDoc = destDoc
+		}
+		return res
+	}
+	if destMissing {
+		res := CheckResult{ID: id, Status: StatusMissingInDest}
+		if c.DumpMissing {
+			res.SourceDoc = srcDoc
+		}
+		if c.Repair != nil {
+			c.Repair.Insert(db, col, id, srcDoc)
+		}
+		return res
+	}
+
+	res := c.compareFound(id, srcDoc, destDoc, srcID, destID)
+	res.SourceSize, res.DestSize = len(srcDoc), len(destDoc)
+	if res.Status == StatusMismatch && c.Repair != nil {
+		c.Repair.Replace(db, col, id, destID, srcDoc)
+	}
+	return res
+}
+
+// compareExcluded classifies a lookup in which ExtraFilter excluded the
+// document on at least one side. A document outside the filter on both
+// sides, or outside it on one and absent from the other, is out of scope
+// and matches; one inside the filter on one side only is a Mismatch.
+func (c *Checker) compareExcluded(id interface{}, srcDoc, destDoc bson.Raw, srcMissing, destMissing bool) CheckResult {
+	srcIn, destIn := !srcMissing, !destMissing
+	if !srcIn && !destIn {
+		return CheckResult{ID: id, Status: StatusMatch, Details: "Filtered out by -extra-filter"}
+	}
+	inside, outside := "source", "dest"
+	if destIn {
+		inside, outside = outside, inside
+	}
+	res := CheckResult{ID: id, Status: StatusMismatch,
+		Details: fmt.Sprintf("Document matches -extra-filter on %s only; the %s document does not", inside, outside),
+		Diffs:   c.Compare.diffDocs(srcDoc, destDoc)}
+	if c.DumpDocs {
+		res.SourceDoc, res.DestDoc = srcDoc, destDoc
+	}
+	return res
+}
+
+// compareFound compares the documents found on both sides
+func (c *Checker) compareFound(id interface{}, srcDoc, destDoc bson.Raw, srcID, destID interface{}) CheckResult {
+	// Both exist, but under _id values of different types
+	if idTypeName(srcID) != idTypeName(destID) {
+		return CheckResult{ID: id, Status: StatusIDTypeMismatch,
+			Details: fmt.Sprintf("Source _id is %s, dest _id is %s", idTypeName(srcID), idTypeName(destID))}
+	}
+
+	if c.ChecksumField != "" {
+		return c.compareChecksums(id, srcDoc, destDoc)
+	}
+	if c.CompareRoot != "" {
+		return c.compareRoots(id, srcDoc, destDoc)
+	}
+
+	// Compare documents (both exist)
+	// bson.Raw represents the raw bytes. We can compare bytes directly if key order is guaranteed same,
+	// but MongoDB doesn't guarantee key order is preserved across replications/moves exactly the same way always?
+	// Actually, usually it does, but canonical comparison is safer.
+	// However, simplest check is bytes equal. If not, unmarshal to maps and DeepEqual.
+
+	if string(srcDoc) == string(destDoc) {
+		return CheckResult{ID: id, Status: StatusMatch}
+	}
+
+	// Deep comparison, ignoring field order
+	diffs := c.Compare.diffDocsCached(srcDoc, destDoc)
+	if len(diffs) == 0 && c.CompareMode != compareBytes {
+		return CheckResult{ID: id, Status: StatusMatch}
+	}
+
+	res := CheckResult{ID: id, Status: StatusMismatch, Diffs: diffs}
+	if len(diffs) == 0 {
+		res.Details = "Documents differ in bytes only: same fields and values, in another order or encoding (-compare-mode bytes)"
+	}
+	if c.DumpDocs {
+		res.SourceDoc, res.DestDoc = srcDoc, destDoc
+	}
+	if c.PrettyDiff {
+		res.PrettyDiff = unifiedDocDiff(c.Compare.mask.doc(srcDoc), c.Compare.mask.doc(destDoc))
+	}
+	return res
+}
@@ -0,0 +1,1141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeSource is an in-memory docSource. Filters are bson.M equality matches.
+type fakeSource struct {
+	docs  map[string][]bson.Raw // keyed by "db.col"
+	calls atomic.Int64          // lookups, made concurrently by worker pools
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{docs: make(map[string][]bson.Raw)}
+}
+
+func (f *fakeSource) insert(ns string, doc bson.D) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+	f.docs[ns] = append(f.docs[ns], raw)
+}
+
+func (f *fakeSource) find(db, col string, filter interface{}) []bson.Raw {
+	var found []bson.Raw
+	for _, doc := range f.docs[db+"."+col] {
+		if matchesFilter(doc, filter.(bson.M)) {
+			found = append(found, doc)
+		}
+	}
+	return found
+}
+
+func matchesFilter(doc bson.Raw, filter bson.M) bool {
+	for key, want := range filter {
+		got, err := doc.LookupErr(strings.Split(key, ".")...)
+		if err != nil {
+			return false
+		}
+		wrapped, err := bson.Marshal(bson.D{{Key: "v", Value: want}})
+		if err != nil || !got.Equal(bson.Raw(wrapped).Lookup("v")) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	f.calls.Add(1)
+	found := f.find(db, col, filter)
+	if len(found) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return found[0], nil
+}
+
+func (f *fakeSource) CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error) {
+	f.calls.Add(1)
+	n := int64(len(f.find(db, col, filter)))
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	return n, nil
+}
+
+// logLine builds a CSV row in the format produced by the log export
+func logLine(ns string, id primitive.ObjectID) string {
+	return fmt.Sprintf(`2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed retryErr=""E11000 duplicate key error collection: %s index: _id_"" id=""{\""$oid\"":\""%s\""}"" key=1"`, ns, id.Hex())
+}
+
+func logFile(lines ...string) string {
+	return "Date,Pod Name,@processKey,Message\n" + strings.Join(lines, "\n") + "\n"
+}
+
+func TestCheckDoc(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, mismatch, onlySrc, onlyDest, none := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	src.insert("db.col", bson.D{{Key: "_id", Value: match}, {Key: "a", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: match}, {Key: "a", Value: 1}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "a", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "a", Value: 2}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: onlySrc}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: onlyDest}})
+
+	tests := []struct {
+		id   primitive.ObjectID
+		want string
+	}{
+		{match, StatusMatch},
+		{mismatch, StatusMismatch},
+		{onlySrc, StatusMissingInDest},
+		{onlyDest, StatusMissingInSource},
+		{none, StatusMatch},
+	}
+	c := NewChecker(src, dest)
+	for _, tt := range tests {
+		res := c.checkDoc(context.Background(), "db", "col", tt.id)
+		if res.Status != tt.want {
+			t.Errorf("checkDoc(%s) = %s, want %s", tt.id.Hex(), res.Status, tt.want)
+		}
+	}
+}
+
+func TestMongoSourceCausalSession(t *testing.T) {
+	ctx := context.Background()
+	// mongo.Connect does not contact the server, so an unreachable host is fine here
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100"))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	plain, err := newMongoSource(client, false)
+	if err != nil || plain.session != nil {
+		t.Fatalf("expected no session without causal consistency, got %v (err %v)", plain.session, err)
+	}
+
+	m, err := newMongoSource(client, true)
+	if err != nil {
+		t.Fatalf("newMongoSource: %v", err)
+	}
+	defer m.close(ctx)
+
+	if m.session == nil {
+		t.Fatal("expected a session when causal consistency is enabled")
+	}
+	if !m.session.(mongo.XSession).ClientSession().Consistent {
+		t.Error("session is not causally consistent")
+	}
+
+	// The read must go through the session; with no server it fails on selection
+	if _, err := m.FindOne(ctx, "db", "col", bson.M{"_id": 1}); err == nil {
+		t.Error("expected FindOne to fail against an unreachable server")
+	}
+}
+
+func TestCheckOne(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "a"}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "b"}})
+
+	c := NewChecker(src, dest)
+	for _, arg := range []string{id.Hex(), `{"$oid":"` + id.Hex() + `"}`} {
+		res, err := c.checkOne(context.Background(), "db.col", arg)
+		if err != nil {
+			t.Fatalf("checkOne(%s): %v", arg, err)
+		}
+		if res.Status != StatusMismatch || res.Namespace != "db.col" {
+			t.Errorf("checkOne(%s) = %+v, want Mismatch in db.col", arg, res)
+		}
+
+		var out strings.Builder
+		printResult(&out, res, false)
+		if !strings.Contains(out.String(), `name: source "a" != dest "b"`) {
+			t.Errorf("printResult output missing diff:\n%s", out.String())
+		}
+	}
+
+	if _, err := c.checkOne(context.Background(), "nodot", id.Hex()); err == nil {
+		t.Error("expected an error for an invalid namespace")
+	}
+}
+
+func TestMaxLines(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	input := logFile(
+		logLine("db.col", primitive.NewObjectID()),
+		logLine("db.col", primitive.NewObjectID()),
+		logLine("db.col", primitive.NewObjectID()),
+	)
+
+	c := NewChecker(src, dest)
+	c.MaxLines = 2
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.RowsRead != 2 || !c.Truncated || c.StatsMap["db.col"].TotalChecks != 2 {
+		t.Errorf("got %d rows read, truncated=%v, %d checks; want reading to stop at 2", c.RowsRead, c.Truncated, c.StatsMap["db.col"].TotalChecks)
+	}
+
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "input truncated after 2 data rows") {
+		t.Errorf("report does not mention truncation:\n%s", out.String())
+	}
+
+	// A cap equal to the number of rows is not a truncation
+	c = NewChecker(src, dest)
+	c.MaxLines = 3
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.Truncated {
+		t.Error("input reported as truncated although every row was read")
+	}
+}
+
+func TestCheckDocIDTypeCoercion(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	oid := primitive.NewObjectID()
+	// The source kept a string _id, the destination migrated it to an ObjectID
+	src.insert("db.col", bson.D{{Key: "_id", Value: oid.Hex()}, {Key: "a", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: oid}, {Key: "a", Value: 1}})
+
+	c := NewChecker(src, dest)
+	for _, id := range []interface{}{oid.Hex(), oid} {
+		res := c.checkDoc(context.Background(), "db", "col", id)
+		if res.Status != StatusIDTypeMismatch {
+			t.Errorf("checkDoc(%#v) = %s, want %s", id, res.Status, StatusIDTypeMismatch)
+		}
+		if res.Details != "Source _id is string, dest _id is ObjectID" {
+			t.Errorf("unexpected details %q", res.Details)
+		}
+	}
+
+	// Both sides agree on the string form: a normal comparison, found via coercion
+	other := primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: other.Hex()}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: other.Hex()}})
+	if res := c.checkDoc(context.Background(), "db", "col", other); res.Status != StatusMatch {
+		t.Errorf("checkDoc with both sides coerced = %s, want Match", res.Status)
+	}
+}
+
+func TestCheckDocLookupField(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	src.insert("shop.orders", bson.D{{Key: "_id", Value: 1}, {Key: "orderId", Value: "A-1"}, {Key: "total", Value: 10}})
+	dest.insert("shop.orders", bson.D{{Key: "_id", Value: 1}, {Key: "orderId", Value: "A-1"}, {Key: "total", Value: 10}})
+	src.insert("shop.orders", bson.D{{Key: "_id", Value: 2}, {Key: "orderId", Value: "A-2"}})
+	dest.insert("shop.orders", bson.D{{Key: "_id", Value: 2}, {Key: "orderId", Value: "A-2"}})
+	dest.insert("shop.orders", bson.D{{Key: "_id", Value: 3}, {Key: "orderId", Value: "A-2"}})
+
+	c := NewChecker(src, dest)
+	c.LookupField = "orderId"
+
+	if res := c.checkDoc(context.Background(), "shop", "orders", "A-1"); res.Status != StatusMatch {
+		t.Errorf("lookup by orderId A-1 = %s (%s), want Match", res.Status, res.Details)
+	}
+	res := c.checkDoc(context.Background(), "shop", "orders", "A-2")
+	if res.Status != StatusMultipleMatches {
+		t.Errorf("lookup by orderId A-2 = %s, want %s", res.Status, StatusMultipleMatches)
+	}
+	if res.Details != "orderId is not unique: source matches 1, dest matches 2+" {
+		t.Errorf("unexpected details %q", res.Details)
+	}
+	if res := c.checkDoc(context.Background(), "shop", "orders", "A-3"); res.Status != StatusMatch || res.Details == "" {
+		t.Errorf("lookup by unknown orderId = %s, want Match with missing-from-both details", res.Status)
+	}
+}
+
+func TestNamespaceColumn(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("shop.orders", bson.D{{Key: "_id", Value: id}})
+
+	// The message names no collection; the namespace is in its own column
+	input := "Date,Namespace,@processKey,Message\n" +
+		fmt.Sprintf(`2025-10-15T17:32:48.521Z,shop.orders,col,"ERR Isolated retry still failed id=""{\""$oid\"":\""%s\""}"""`, id.Hex()) + "\n" +
+		fmt.Sprintf(`2025-10-15T17:32:48.521Z,orders,col,"ERR Isolated retry still failed id=""{\""$oid\"":\""%s\""}"""`, id.Hex()) + "\n"
+
+	c := NewChecker(src, dest)
+	c.NamespaceColumn = 1
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(c.StatsMap) != 1 {
+		t.Fatalf("expected only the valid namespace, got %v", c.StatsMap)
+	}
+	if s := c.StatsMap["shop.orders"]; s == nil || s.MissingInDest != 1 {
+		t.Errorf("shop.orders stats = %+v, want one MissingInDest", s)
+	}
+}
+
+func TestSearchColumns(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("shop.orders", bson.D{{Key: "_id", Value: id}})
+
+	// The message names the collection, the id is in a column of its own
+	input := "Date,Pod Name,@processKey,Message,Document\n" +
+		fmt.Sprintf(`2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed retryErr=""E11000 duplicate key error collection: shop.orders index: _id_""","id=""{\""$oid\"":\""%s\""}"""`, id.Hex()) + "\n"
+
+	columns, err := parseColumns("3, 4")
+	if err != nil {
+		t.Fatalf("parseColumns: %v", err)
+	}
+	c := NewChecker(src, dest)
+	c.SearchColumns = columns
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s := c.StatsMap["shop.orders"]; s == nil || s.MissingInDest != 1 {
+		t.Errorf("shop.orders stats = %+v, want one MissingInDest", s)
+	}
+
+	// The message column alone holds no id
+	c = NewChecker(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s := c.StatsMap["shop.orders"]; s == nil || s.TotalChecks != 0 || s.ParseFailures != 1 {
+		t.Errorf("message column only: stats = %+v, want an unparsable id", s)
+	}
+
+	// A column beyond the record skips it
+	c = NewChecker(src, dest)
+	c.SearchColumns = []int{3, 7}
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(c.StatsMap) != 0 {
+		t.Errorf("out of range column: stats %v, want the line skipped", c.StatsMap)
+	}
+
+	if _, err := parseColumns("3,x"); err == nil {
+		t.Error("parseColumns accepted a non-numeric column")
+	}
+}
+
+func TestBareCollection(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	mapped, fallback, unknown := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("shop.col2", bson.D{{Key: "_id", Value: mapped}})
+	src.insert("legacy.col3", bson.D{{Key: "_id", Value: fallback}})
+	src.insert("legacy.col4", bson.D{{Key: "_id", Value: unknown}})
+
+	// Older logs name the collection alone
+	bare := func(col string, id primitive.ObjectID) string {
+		return strings.Replace(logLine("db."+col, id), "collection: db."+col+" ", "collection: "+col+" ", 1)
+	}
+	input := logFile(bare("col2", mapped), bare("col3", fallback), logLine("other.col2", unknown))
+
+	dbs, err := loadCollectionDBs(strings.NewReader("# collection,db\ncol2, shop\n\n"))
+	if err != nil {
+		t.Fatalf("loadCollectionDBs: %v", err)
+	}
+	c := NewChecker(src, dest)
+	c.CollectionDBs, c.DefaultDB = dbs, "legacy"
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, ns := range []string{"shop.col2", "legacy.col3", "other.col2"} {
+		if s := c.StatsMap[ns]; s == nil || s.TotalChecks != 1 {
+			t.Errorf("%s stats = %+v, want one check", ns, s)
+		}
+	}
+
+	// Without a database to give them, bare collections are skipped and counted
+	c = NewChecker(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.UnresolvedNamespaces != 2 || len(c.StatsMap) != 1 {
+		t.Errorf("%d unresolved, stats %v; want the two bare collections skipped", c.UnresolvedNamespaces, c.StatsMap)
+	}
+
+	for _, bad := range []string{"col2\n", "col2,a.b\n", "col2,shop\ncol2,other\n"} {
+		if _, err := loadCollectionDBs(strings.NewReader(bad)); err == nil {
+			t.Errorf("loadCollectionDBs(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRunIDs(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, f := range []*fakeSource{src, dest} {
+		f.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	}
+	src.insert("other.col", bson.D{{Key: "_id", Value: missing}})
+
+	ids := strings.Join([]string{
+		"db.col," + match.Hex(),
+		"",
+		`other.col, {"$oid":"` + missing.Hex() + `"}`,
+		"db.col,not-an-id",
+		"no-comma",
+	}, "\n")
+
+	c := NewChecker(src, dest)
+	if err := c.RunIDs(context.Background(), strings.NewReader(ids)); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.StatsMap["db.col"]; s == nil || s.TotalChecks != 1 || s.Matches != 1 {
+		t.Errorf("db.col stats = %+v, want 1 Match", s)
+	}
+	if s := c.StatsMap["other.col"]; s == nil || s.MissingInDest != 1 {
+		t.Errorf("other.col stats = %+v, want 1 MissingInDest", s)
+	}
+	if c.RowsRead != 4 {
+		t.Errorf("RowsRead = %d, want 4", c.RowsRead)
+	}
+}
+
+func TestBothMissingStatus(t *testing.T) {
+	tests := []struct {
+		option      string
+		want        string
+		discrepancy bool
+	}{
+		{bothMissingMatch, StatusMatch, false},
+		{bothMissingDiscrepancy, StatusMismatch, true},
+		{bothMissingSeparate, StatusMissingInBoth, true},
+	}
+	for _, tt := range tests {
+		c := NewChecker(newFakeSource(), newFakeSource())
+		c.BothMissingStatus = tt.option
+		if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", primitive.NewObjectID())))); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(c.DiscrepancyList) == 1; got != tt.discrepancy {
+			t.Errorf("%s: discrepancy reported = %v, want %v", tt.option, got, tt.discrepancy)
+		}
+		s := c.StatsMap["db.col"]
+		if tt.discrepancy && c.DiscrepancyList[0].Status != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.option, c.DiscrepancyList[0].Status, tt.want)
+		}
+		if tt.option == bothMissingSeparate && s.MissingInBoth != 1 {
+			t.Errorf("%s: MissingInBoth = %d, want 1", tt.option, s.MissingInBoth)
+		}
+		if tt.option == bothMissingMatch && s.Matches != 1 {
+			t.Errorf("%s: Matches = %d, want 1", tt.option, s.Matches)
+		}
+	}
+}
+
+func TestCompareRoot(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	same, changed, noRoot := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: same}, {Key: "replica", Value: "a"}, {Key: "payload", Value: bson.D{{Key: "x", Value: 1}}}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: same}, {Key: "replica", Value: "b"}, {Key: "payload", Value: bson.D{{Key: "x", Value: 1}}}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: changed}, {Key: "payload", Value: bson.D{{Key: "x", Value: 1}}}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: changed}, {Key: "payload", Value: bson.D{{Key: "x", Value: 2}}}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: noRoot}, {Key: "payload", Value: bson.D{}}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: noRoot}})
+
+	c := NewChecker(src, dest)
+	c.CompareRoot = "payload"
+	if res := c.checkDoc(context.Background(), "db", "col", same); res.Status != StatusMatch {
+		t.Errorf("top-level difference outside the root: %s, want Match", res.Status)
+	}
+	res := c.checkDoc(context.Background(), "db", "col", changed)
+	if res.Status != StatusMismatch || len(res.Diffs) != 1 || res.Diffs[0].Path != "payload.x" {
+		t.Errorf("difference inside the root: %+v, want Mismatch at payload.x", res)
+	}
+	res = c.checkDoc(context.Background(), "db", "col", noRoot)
+	if res.Status != StatusRootMissing || res.Details != "payload missing in dest" {
+		t.Errorf("root missing in dest: %+v", res)
+	}
+}
+
+func TestChecksumField(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	same, changed, noSum := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	// Only the checksum is compared: other fields may differ
+	src.insert("db.col", bson.D{{Key: "_id", Value: same}, {Key: "v", Value: 1}, {Key: "_checksum", Value: "abc"}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: same}, {Key: "v", Value: 2}, {Key: "_checksum", Value: "abc"}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: changed}, {Key: "_checksum", Value: "abc"}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: changed}, {Key: "_checksum", Value: "abd"}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: noSum}, {Key: "_checksum", Value: "abc"}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: noSum}})
+
+	c := NewChecker(src, dest)
+	c.ChecksumField = "_checksum"
+	if res := c.checkDoc(context.Background(), "db", "col", same); res.Status != StatusMatch {
+		t.Errorf("equal checksums: %s, want Match", res.Status)
+	}
+	res := c.checkDoc(context.Background(), "db", "col", changed)
+	if res.Status != StatusMismatch || len(res.Diffs) != 1 || res.Diffs[0].Path != "_checksum" {
+		t.Errorf("different checksums: %+v, want Mismatch at _checksum", res)
+	}
+	res = c.checkDoc(context.Background(), "db", "col", noSum)
+	if res.Status != StatusError || res.ErrClass != ErrClassNoChecksum || res.Details != "Checksum _checksum missing in dest" {
+		t.Errorf("checksum missing in dest: %+v", res)
+	}
+
+	if got := checksumProjection("meta.sum", "orderId"); len(got) != 2 || got[1].Key != "orderId" {
+		t.Errorf("projection = %v, want the checksum and the lookup field", got)
+	}
+}
+
+func TestHeaderlessLog(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	// logFile prepends a header row; drop it
+	body := logFile(logLine("db.col", first), logLine("db.col", second))
+	body = body[strings.Index(body, "\n")+1:]
+
+	c := NewChecker(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.StatsMap["db.col"]; s.TotalChecks != 1 {
+		t.Errorf("with a header assumed: TotalChecks = %d, want 1", s.TotalChecks)
+	}
+
+	c = NewChecker(src, dest)
+	c.HasHeader = false
+	if err := c.Run(context.Background(), strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.StatsMap["db.col"]; s.TotalChecks != 2 {
+		t.Errorf("-has-header=false: TotalChecks = %d, want 2", s.TotalChecks)
+	}
+	if c.Header != nil {
+		t.Errorf("Header = %v, want none", c.Header)
+	}
+}
+
+func TestRepeatedHeaderRows(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	// Two exports concatenated with cat, the second with a byte order mark
+	part := func() string {
+		return logFile(logLine("db.col", primitive.NewObjectID()), logLine("db.col", primitive.NewObjectID()))
+	}
+	input := part() + "\ufeff" + part()
+
+	for _, hasHeader := range []bool{true, false} {
+		c := NewChecker(src, dest)
+		c.HasHeader = hasHeader
+		if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatal(err)
+		}
+		wantSkipped := 1
+		if !hasHeader {
+			wantSkipped = 2 // the first header is a repeated one too
+		}
+		if s := c.StatsMap["db.col"]; s.TotalChecks != 4 || c.RowsRead != 4 || c.HeaderRowsSkipped != wantSkipped {
+			t.Errorf("has header %v: %d checks, %d rows, %d headers skipped; want 4, 4, %d", hasHeader, s.TotalChecks, c.RowsRead, c.HeaderRowsSkipped, wantSkipped)
+		}
+		if c.LogAge.Count != 4 {
+			t.Errorf("has header %v: %d dated entries, want 4", hasHeader, c.LogAge.Count)
+		}
+	}
+
+	c := NewChecker(src, dest)
+	c.Run(context.Background(), strings.NewReader(input))
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "Repeated header rows skipped: 1") {
+		t.Errorf("report does not count skipped headers:\n%s", out.String())
+	}
+}
+
+// panicSource panics on every lookup of the id it was given
+type panicSource struct {
+	*fakeSource
+	id primitive.ObjectID
+}
+
+func (p panicSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	if filter.(bson.M)["_id"] == p.id {
+		panic("unexpected BSON shape")
+	}
+	return p.fakeSource.FindOne(ctx, db, col, filter)
+}
+
+func TestPanicBecomesError(t *testing.T) {
+	bad, good := primitive.NewObjectID(), primitive.NewObjectID()
+	src, dest := newFakeSource(), newFakeSource()
+	for _, f := range []*fakeSource{src, dest} {
+		f.insert("db.col", bson.D{{Key: "_id", Value: good}})
+	}
+
+	c := NewChecker(src, panicSource{fakeSource: dest, id: bad})
+	log := logFile(logLine("db.col", bad), logLine("db.col", good))
+	if err := c.Run(context.Background(), strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	s := c.StatsMap["db.col"]
+	if s.TotalChecks != 2 || s.Errors != 1 || s.Matches != 1 {
+		t.Errorf("stats = %+v, want 2 checks: 1 Error and 1 Match", s)
+	}
+	if s.ErrorClasses[ErrClassPanic] != 1 {
+		t.Errorf("ErrorClasses = %v, want one %s", s.ErrorClasses, ErrClassPanic)
+	}
+}
+
+func TestSizeReport(t *testing.T) {
+	s := &SizeStats{}
+	s.add(100, 80)
+	s.add(50, 50)
+	s.add(50, 90)
+	if s.Compared != 3 || s.SourceBytes != 200 || s.DestBytes != 220 {
+		t.Fatalf("totals = %+v", s)
+	}
+	if s.Delta() != 20 || s.DeltaPercent() != 10 {
+		t.Errorf("Delta = %d (%.2f%%), want 20 (10%%)", s.Delta(), s.DeltaPercent())
+	}
+	if got := s.MeanDelta(); got < 6.66 || got > 6.67 {
+		t.Errorf("MeanDelta = %v, want 6.67", got)
+	}
+	if s.Grown != 1 || s.Shrunk != 1 {
+		t.Errorf("Grown = %d, Shrunk = %d; want 1, 1", s.Grown, s.Shrunk)
+	}
+
+	// Only documents found on both sides are counted
+	src, dest := newFakeSource(), newFakeSource()
+	both, onlySrc := primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: both}, {Key: "s", Value: "abcdef"}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: both}, {Key: "s", Value: "abc"}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: onlySrc}})
+	c := NewChecker(src, dest)
+	c.SizeReport = true
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", both), logLine("db.col", onlySrc)))); err != nil {
+		t.Fatal(err)
+	}
+	if z := c.StatsMap["db.col"].Sizes; z == nil || z.Compared != 1 || z.Delta() != -3 {
+		t.Errorf("Sizes = %+v, want 1 compared with delta -3", z)
+	}
+}
+
+func TestConfirmExistsCount(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	dup, ok := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, f := range []*fakeSource{src, dest} {
+		f.insert("db.col", bson.D{{Key: "_id", Value: dup}})
+		f.insert("db.col", bson.D{{Key: "_id", Value: ok}})
+	}
+	// A second document with the same _id, inserted bypassing the unique index
+	dest.insert("db.col", bson.D{{Key: "_id", Value: dup}, {Key: "copy", Value: true}})
+
+	c := NewChecker(src, dest)
+	if res := c.checkDoc(context.Background(), "db", "col", dup); res.Status != StatusMatch {
+		t.Fatalf("without the option: %s, want Match", res.Status)
+	}
+	c.ConfirmExistsCount = true
+	res := c.checkDoc(context.Background(), "db", "col", dup)
+	if res.Status != StatusDuplicateID || res.Details != "_id is duplicated: source matches 1, dest matches 2+" {
+		t.Errorf("duplicated _id: %+v", res)
+	}
+	if res := c.checkDoc(context.Background(), "db", "col", ok); res.Status != StatusMatch {
+		t.Errorf("unique _id: %s, want Match", res.Status)
+	}
+}
+
+func TestExtraFilter(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	doc := func(id primitive.ObjectID, status string) bson.D {
+		return bson.D{{Key: "_id", Value: id}, {Key: "status", Value: status}}
+	}
+	ids := make([]primitive.ObjectID, 7)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+	}
+	src.insert("db.col", doc(ids[0], "active"))
+	dest.insert("db.col", doc(ids[0], "active"))
+	src.insert("db.col", doc(ids[1], "closed"))
+	dest.insert("db.col", doc(ids[1], "closed"))
+	src.insert("db.col", doc(ids[2], "active"))
+	dest.insert("db.col", doc(ids[2], "closed"))
+	src.insert("db.col", doc(ids[3], "closed"))
+	dest.insert("db.col", doc(ids[3], "active"))
+	src.insert("db.col", doc(ids[4], "closed"))
+	src.insert("db.col", doc(ids[5], "active"))
+
+	filter, err := parseExtraFilter(`{"status":"active"}`, "_id")
+	if err != nil {
+		t.Fatalf("parseExtraFilter: %v", err)
+	}
+	c := NewChecker(src, dest)
+	c.ExtraFilter = filter
+	tests := []struct {
+		name    string
+		id      primitive.ObjectID
+		status  string
+		details string
+	}{
+		{"inside on both", ids[0], StatusMatch, ""},
+		{"outside on both", ids[1], StatusMatch, "Filtered out by -extra-filter"},
+		{"inside on source only", ids[2], StatusMismatch, "Document matches -extra-filter on source only; the dest document does not"},
+		{"inside on dest only", ids[3], StatusMismatch, "Document matches -extra-filter on dest only; the source document does not"},
+		{"outside on source, missing from dest", ids[4], StatusMatch, "Filtered out by -extra-filter"},
+		{"inside on source, missing from dest", ids[5], StatusMissingInDest, ""},
+		{"missing from both", ids[6], StatusMatch, "Document missing from both databases"},
+	}
+	for _, tt := range tests {
+		res := c.checkDoc(context.Background(), "db", "col", tt.id)
+		if res.Status != tt.status || res.Details != tt.details {
+			t.Errorf("%s: %s (%s), want %s (%s)", tt.name, res.Status, res.Details, tt.status, tt.details)
+		}
+		if res.Status == StatusMismatch && (len(res.Diffs) != 1 || res.Diffs[0].Path != "status") {
+			t.Errorf("%s: diffs %v, want the status difference", tt.name, res.Diffs)
+		}
+	}
+
+	for _, bad := range []string{`not json`, `[1]`, `{"_id":1}`} {
+		if _, err := parseExtraFilter(bad, "_id"); err == nil {
+			t.Errorf("parseExtraFilter(%s) succeeded, want an error", bad)
+		}
+	}
+	if f, err := parseExtraFilter(`{}`, "_id"); err != nil || f != nil {
+		t.Errorf("empty filter = %v, %v; want no filter", f, err)
+	}
+}
+
+// lostSource fails every lookup after the first working ones with err
+type lostSource struct {
+	docSource
+	working int
+	err     error
+}
+
+func (l *lostSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	if l.working <= 0 {
+		return nil, l.err
+	}
+	l.working--
+	return l.docSource.FindOne(ctx, db, col, filter)
+}
+
+func TestStopOnError(t *testing.T) {
+	ids := make([]string, 4)
+	for i := range ids {
+		ids[i] = logLine("db.col", primitive.NewObjectID())
+	}
+	input := logFile(ids...)
+	lost := fmt.Errorf("server selection: %w", netErr{})
+
+	for _, stop := range []bool{false, true} {
+		// The dest answers for the first id (a lookup, then one with the id
+		// coerced to a string), then becomes unreachable
+		c := NewChecker(newFakeSource(), &lostSource{docSource: newFakeSource(), working: 2, err: lost})
+		c.StopOnError = stop
+		if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		s := c.StatsMap["db.col"]
+		if !stop {
+			if c.StopReason != "" || c.RowsRead != 4 || s.Errors != 3 {
+				t.Errorf("keep going: stop reason %q, %d rows, %d errors; want every row checked", c.StopReason, c.RowsRead, s.Errors)
+			}
+			continue
+		}
+		if !strings.Contains(c.StopReason, "connection lost at line 3") || c.RowsRead != 2 || s.Errors != 1 || s.Matches != 1 {
+			t.Errorf("stop: stop reason %q, %d rows, %+v; want a stop after the first connection loss", c.StopReason, c.RowsRead, s)
+		}
+		var out strings.Builder
+		printReport(&out, c)
+		if !strings.Contains(out.String(), "run stopped (-stop-on-error)") {
+			t.Errorf("report does not mention the stop:\n%s", out.String())
+		}
+	}
+
+	// A per-document error does not stop the run
+	c := NewChecker(newFakeSource(), &lostSource{docSource: newFakeSource(), err: mongo.CommandError{Code: 2, Name: "BadValue"}})
+	c.StopOnError = true
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.StopReason != "" || c.StatsMap["db.col"].Errors != 4 {
+		t.Errorf("per-document errors stopped the run: %q", c.StopReason)
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	// The $oid value of the second line is a number, not a hex string
+	malformed := `2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed retryErr=""E11000 duplicate key error collection: db.col index: _id_"" id=""{\""$oid\"":1}"" key=1"`
+	input := logFile(logLine("db.col", primitive.NewObjectID()), malformed, logLine("db.col", primitive.NewObjectID()))
+
+	for _, strict := range []bool{false, true} {
+		c := NewChecker(newFakeSource(), newFakeSource())
+		c.StrictJSON = strict
+		if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		s := c.StatsMap["db.col"]
+		if !strict {
+			if c.StopReason != "" || c.RowsRead != 3 || s.TotalChecks != 2 || s.ParseFailures != 1 {
+				t.Errorf("lenient: stop reason %q, %d rows, %+v; want the malformed id skipped", c.StopReason, c.RowsRead, s)
+			}
+			continue
+		}
+		if !strings.Contains(c.StopReason, "unparsable id at line 3") || c.RowsRead != 2 || s.TotalChecks != 1 || s.ParseFailures != 1 {
+			t.Errorf("strict: stop reason %q, %d rows, %+v; want a stop at the malformed id", c.StopReason, c.RowsRead, s)
+		}
+		var out strings.Builder
+		printReport(&out, c)
+		if !strings.Contains(out.String(), "run stopped (-strict-json)") {
+			t.Errorf("report does not mention the stop:\n%s", out.String())
+		}
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	ids := make([]primitive.ObjectID, 6)
+	lines := make([]string, len(ids))
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+		lines[i] = logLine("db.col", ids[i])
+		src.insert("db.col", bson.D{{Key: "_id", Value: ids[i]}})
+		// The first id matches, every later one is missing from dest
+		if i == 0 {
+			dest.insert("db.col", bson.D{{Key: "_id", Value: ids[i]}})
+		}
+	}
+	input := logFile(lines...)
+
+	c := NewChecker(src, dest)
+	c.FailFast = true
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(c.StopReason, "first discrepancy at line 3") || c.RowsRead != 2 || len(c.DiscrepancyList) != 1 {
+		t.Errorf("stop reason %q, %d rows, %d discrepancies; want a stop at the first discrepancy", c.StopReason, c.RowsRead, len(c.DiscrepancyList))
+	}
+
+	// Checks in flight on other workers when the run stops are dropped
+	c = NewChecker(src, dest)
+	c.FailFast = true
+	c.Workers = 4
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.StopFlag != "-fail-fast" || len(c.DiscrepancyList) != 1 {
+		t.Errorf("workers: stop flag %q, %d discrepancies; want the first one alone", c.StopFlag, len(c.DiscrepancyList))
+	}
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "run stopped (-fail-fast)") {
+		t.Errorf("report does not mention the stop:\n%s", out.String())
+	}
+}
+
+func TestCompareModeBytes(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	same, reordered := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, f := range []*fakeSource{src, dest} {
+		f.insert("db.col", bson.D{{Key: "_id", Value: same}, {Key: "a", Value: 1}, {Key: "b", Value: 2}})
+	}
+	src.insert("db.col", bson.D{{Key: "_id", Value: reordered}, {Key: "a", Value: 1}, {Key: "b", Value: 2}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: reordered}, {Key: "b", Value: 2}, {Key: "a", Value: 1}})
+
+	tests := []struct {
+		mode string
+		id   primitive.ObjectID
+		want string
+	}{
+		{compareDeep, same, StatusMatch},
+		{compareDeep, reordered, StatusMatch},
+		{compareBytes, same, StatusMatch},
+		{compareBytes, reordered, StatusMismatch},
+	}
+	for _, tt := range tests {
+		c := NewChecker(src, dest)
+		c.CompareMode = tt.mode
+		res := c.checkDoc(context.Background(), "db", "col", tt.id)
+		if res.Status != tt.want {
+			t.Errorf("%s, %v: status %s, want %s", tt.mode, tt.id, res.Status, tt.want)
+		}
+		if res.Status == StatusMismatch && (len(res.Diffs) != 0 || !strings.Contains(res.Details, "differ in bytes only")) {
+			t.Errorf("%s: diffs %v, details %q; want no field difference", tt.mode, res.Diffs, res.Details)
+		}
+	}
+}
+
+// corruptSource finds the documents of its corrupt ids but cannot read them
+type corruptSource struct {
+	docSource
+	corrupt map[interface{}]bool
+}
+
+func (c corruptSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	doc, err := c.docSource.FindOne(ctx, db, col, filter)
+	if err == nil && c.corrupt[doc.Lookup("_id").ObjectID()] {
+		return nil, decodeError{errors.New("invalid document length")}
+	}
+	return doc, err
+}
+
+func TestDecodeError(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	readable, corrupt, missing := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	for _, id := range []primitive.ObjectID{readable, corrupt} {
+		src.insert("db.col", bson.D{{Key: "_id", Value: id}})
+		dest.insert("db.col", bson.D{{Key: "_id", Value: id}})
+	}
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}})
+
+	c := NewChecker(src, corruptSource{docSource: dest, corrupt: map[interface{}]bool{corrupt: true}})
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", readable), logLine("db.col", corrupt), logLine("db.col", missing)))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	s := c.StatsMap["db.col"]
+	if s.Matches != 1 || s.DecodeErrors != 1 || s.MissingInDest != 1 || s.Errors != 0 {
+		t.Errorf("stats %+v, want the corrupt document apart from errors and missing ones", s)
+	}
+	var found bool
+	for _, res := range c.DiscrepancyList {
+		if res.Status == StatusDecodeError {
+			found = res.ID == corrupt && strings.Contains(res.Details, "Dest document exists but is unreadable")
+		}
+	}
+	if !found {
+		t.Errorf("discrepancies %+v, want a DecodeError for the corrupt id", c.DiscrepancyList)
+	}
+}
+
+func TestCompareTimeoutResult(t *testing.T) {
+	id := primitive.NewObjectID()
+	timedOut := fmt.Errorf("find: %w", context.DeadlineExceeded)
+
+	for _, split := range []bool{false, true} {
+		c := NewChecker(newFakeSource(), &lostSource{docSource: newFakeSource(), err: timedOut})
+		c.TimeoutStatus = split
+		res := c.checkDoc(context.Background(), "db", "col", id)
+		want := StatusError
+		if split {
+			want = StatusTimeout
+		}
+		if res.Status != want || res.ErrClass != ErrClassTimeout {
+			t.Errorf("-compare-timeout-result=%v: status %s (%s), want %s (%s)", split, res.Status, res.ErrClass, want, ErrClassTimeout)
+		}
+	}
+
+	// Timeouts are counted apart, and other errors are still Errors
+	c := NewChecker(newFakeSource(), &lostSource{docSource: newFakeSource(), err: timedOut})
+	c.TimeoutStatus = true
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", id)))); err != nil {
+		t.Fatal(err)
+	}
+	s := c.StatsMap["db.col"]
+	if s.Timeouts != 1 || s.Errors != 0 || s.Covered() != 0 {
+		t.Errorf("stats = %+v, want 1 Timeout and no Errors", s)
+	}
+	c = NewChecker(newFakeSource(), &lostSource{docSource: newFakeSource(), err: mongo.CommandError{Code: 2, Name: "BadValue"}})
+	c.TimeoutStatus = true
+	if res := c.checkDoc(context.Background(), "db", "col", id); res.Status != StatusError {
+		t.Errorf("BadValue: status %s, want %s", res.Status, StatusError)
+	}
+}
+
+func TestDirectionSource(t *testing.T) {
+	deleted, kept := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, direction := range []string{directionBoth, directionSource} {
+		src, dest := newFakeSource(), newFakeSource()
+		src.insert("db.col", bson.D{{Key: "_id", Value: kept}})
+		dest.insert("db.col", bson.D{{Key: "_id", Value: kept}})
+		dest.insert("db.col", bson.D{{Key: "_id", Value: deleted}})
+		c := NewChecker(src, dest)
+		c.Direction = direction
+
+		res := c.checkDoc(context.Background(), "db", "col", deleted)
+		if direction == directionBoth {
+			if res.Status != StatusMissingInSource || dest.calls.Load() == 0 {
+				t.Errorf("both: %s with %d dest queries, want MissingInSource", res.Status, dest.calls.Load())
+			}
+			continue
+		}
+		if res.Status != StatusNotInSource || dest.calls.Load() != 0 {
+			t.Errorf("source: %s with %d dest queries, want NotInSource without any", res.Status, dest.calls.Load())
+		}
+		// A document the source has is still looked up in dest
+		if res := c.checkDoc(context.Background(), "db", "col", kept); res.Status != StatusMatch || dest.calls.Load() == 0 {
+			t.Errorf("source, present document: %s with %d dest queries, want a Match", res.Status, dest.calls.Load())
+		}
+	}
+}
+
+func TestOnlyStatus(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	mismatch, onlySrc, onlyDest := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 2}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: onlySrc}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: onlyDest}})
+
+	only, err := parseStatuses("Mismatch, missing_source")
+	if err != nil {
+		t.Fatalf("parseStatuses: %v", err)
+	}
+	c := NewChecker(src, dest)
+	c.OnlyStatus = only
+	lines := []string{logLine("db.col", mismatch), logLine("db.col", onlySrc), logLine("db.col", onlyDest)}
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var listed []string
+	for _, d := range c.DiscrepancyList {
+		listed = append(listed, d.Status)
+	}
+	if got, want := strings.Join(listed, ","), StatusMismatch+","+StatusMissingInSource; got != want {
+		t.Errorf("listed %s, want %s", got, want)
+	}
+	if s := c.StatsMap["db.col"]; s.Mismatches != 1 || s.MissingInSource != 1 || s.MissingInDest != 1 || s.Discrepancies() != 3 {
+		t.Errorf("stats %+v, want every status counted", s)
+	}
+
+	if _, err := parseStatuses("mismatch,missing"); err == nil {
+		t.Error("parseStatuses accepted an unknown status")
+	}
+}
+
+func TestResultLine(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, f := range []*fakeSource{src, dest} {
+		f.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	}
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}})
+
+	// The missing id is on line 4: the header, a match, an unrelated line
+	input := logFile(logLine("db.col", match), "2025-10-15T17:32:48.521Z,dsync,col,batch applied", logLine("db.col", missing))
+	c := NewChecker(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(c.DiscrepancyList) != 1 || c.DiscrepancyList[0].Line != 4 {
+		t.Fatalf("discrepancies %+v, want the missing id at line 4", c.DiscrepancyList)
+	}
+
+	var text strings.Builder
+	printReport(&text, c)
+	if !strings.Contains(text.String(), "[db.col] Line: 4 | ID: ") {
+		t.Errorf("text report does not give the line:\n%s", text.String())
+	}
+	if jr := newJSONResult(c.DiscrepancyList[0], 0); jr.Line != 4 {
+		t.Errorf("JSON result line %d, want 4", jr.Line)
+	}
+}
+
+func TestModifiedSince(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	old, recent, undated := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	cutoff := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	src.insert("db.col", bson.D{{Key: "_id", Value: old}, {Key: "meta", Value: bson.D{{Key: "updatedAt", Value: primitive.NewDateTimeFromTime(cutoff.Add(-time.Hour))}}}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: recent}, {Key: "meta", Value: bson.D{{Key: "updatedAt", Value: primitive.Timestamp{T: uint32(cutoff.Add(time.Hour).Unix())}}}}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: undated}})
+
+	c := NewChecker(src, dest)
+	c.ModifiedSince, c.ModifiedField = cutoff, "meta.updatedAt"
+	lines := []string{logLine("db.col", old), logLine("db.col", recent), logLine("db.col", undated)}
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	s := c.StatsMap["db.col"]
+	if s.SkippedOld != 1 || s.MissingInDest != 2 || s.Discrepancies() != 2 {
+		t.Errorf("stats %+v, want the old document skipped and the others checked", s)
+	}
+	if got := s.MatchRate(); got != 0 {
+		t.Errorf("match rate %v, want 0 over the 2 scoped checks", got)
+	}
+}
+
+func TestNoMatchedLines(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	c := NewChecker(src, dest)
+	input := logFile("2025-10-15T17:32:48.521Z,dsync,col,batch applied", "2025-10-15T17:32:49.000Z,dsync,col,batch applied")
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.RowsRead != 2 || c.MatchedLines != 0 {
+		t.Errorf("rows read %d, matched %d; want 2 and 0", c.RowsRead, c.MatchedLines)
+	}
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "WARNING: no log line matched the filter after 2 data rows; nothing was checked") {
+		t.Errorf("report does not warn that nothing matched:\n%s", out.String())
+	}
+
+	id := primitive.NewObjectID()
+	c = NewChecker(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", id)))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	out.Reset()
+	printReport(&out, c)
+	if c.MatchedLines != 1 || strings.Contains(out.String(), "no log line matched") {
+		t.Errorf("matched %d, want 1 without a warning:\n%s", c.MatchedLines, out.String())
+	}
+}
+
+func TestNoMatchesLogRunsOnly(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	for _, f := range []*fakeSource{src, dest} {
+		f.insert("db.col", bson.D{{Key: "_id", Value: id}})
+	}
+	unmatched := logFile("2025-10-15T17:32:48.521Z,dsync,col,batch applied")
+
+	// A log of which no line matched fails the run unless allowed
+	c := NewChecker(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(unmatched)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := runError(c, false); !errors.Is(err, errNoMatches) {
+		t.Errorf("log run without matches returned %v, want errNoMatches", err)
+	}
+	if err := runError(c, true); err != nil {
+		t.Errorf("log run without matches under -allow-empty returned %v", err)
+	}
+
+	// Other modes read no log through the filter, and exit 0
+	runs := map[string]func(c *Checker) error{
+		"-ids-file": func(c *Checker) error {
+			return c.RunIDs(context.Background(), strings.NewReader("db.col,"+id.Hex()))
+		},
+		"-full-scan-namespace": func(c *Checker) error {
+			return c.RunFullScan(context.Background(), "db.col", src, dest)
+		},
+		"-check-id": func(c *Checker) error {
+			_, err := c.checkOne(context.Background(), "db.col", id.Hex())
+			return err
+		},
+		"-capped": func(c *Checker) error {
+			if err := c.Run(context.Background(), strings.NewReader(unmatched)); err != nil {
+				return err
+			}
+			return c.RunCapped(context.Background(), "db.col", src, dest)
+		},
+	}
+	for mode, run := range runs {
+		c := NewChecker(src, dest)
+		if err := run(c); err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if err := runError(c, false); err != nil {
+			t.Errorf("%s run returned %v, want success", mode, err)
+		}
+		var out strings.Builder
+		printReport(&out, c)
+		if strings.Contains(out.String(), "no log line matched") {
+			t.Errorf("%s report warns that no log line matched:\n%s", mode, out.String())
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// collationLister returns the default collation of a collection or view,
+// nil for the simple (binary) collation
+type collationLister interface {
+	DefaultCollation(ctx context.Context, db, col string) (bson.Raw, error)
+}
+
+func (m mongoSource) DefaultCollation(ctx context.Context, db, col string) (bson.Raw, error) {
+	specs, err := m.client.Database(db).ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: col}})
+	if err != nil || len(specs) == 0 {
+		return nil, err
+	}
+	collation, ok := specs[0].Options.Lookup("collation").DocumentOK()
+	if !ok {
+		return nil, nil
+	}
+	return collation, nil
+}
+
+// CollationDiff is a namespace whose default collation differs between
+// source and dest
+type CollationDiff struct {
+	Namespace string `json:"namespace"`
+	Source    string `json:"source"`
+	Dest      string `json:"dest"`
+}
+
+// collationCheck looks up the default collation of every namespace on both
+// sides when the namespace is first checked. Lookups by _id and the
+// comparison of strings both follow the collation, so a collection that is
+// case-insensitive on one side only can Match or not for reasons the
+// documents do not show.
+type collationCheck struct {
+	src, dest collationLister
+	seen      map[string]bool
+	diffs     []CollationDiff
+}
+
+func newCollationCheck(src, dest collationLister) *collationCheck {
+	return &collationCheck{src: src, dest: dest, seen: make(map[string]bool)}
+}
+
+// check compares the default collations of namespace on first sight,
+// logging the differences and any collation -collation should apply
+func (cc *collationCheck) check(ctx context.Context, logger *log.Logger, namespace, db, col string) {
+	if cc.seen[namespace] {
+		return
+	}
+	cc.seen[namespace] = true
+	var specs [2]string
+	for side, lister := range []collationLister{cc.src, cc.dest} {
+		collation, err := lister.DefaultCollation(ctx, db, col)
+		if err != nil {
+			logger.Printf("Cannot read the collation of %s on %s: %v", namespace, [2]string{"source", "dest"}[side], err)
+			return
+		}
+		specs[side] = collationString(collation)
+	}
+	switch {
+	case specs[0] != specs[1]:
+		logger.Printf("WARNING: %s has default collation %s on source and %s on dest; lookups and string comparisons may disagree", namespace, specs[0], specs[1])
+		cc.diffs = append(cc.diffs, CollationDiff{Namespace: namespace, Source: specs[0], Dest: specs[1]})
+	case specs[0] != collationSimple:
+		logger.Printf("%s has default collation %s on both sides; pass -collation to compare strings under it", namespace, specs[0])
+	}
+}
+
+// collationSimple is how the simple collation is shown
+const collationSimple = "simple"
+
+// collationString renders a collation as Extended JSON, without the ICU
+// version, which differs between server releases without changing the
+// order
+func collationString(collation bson.Raw) string {
+	if locale, _ := collation.Lookup("locale").StringValueOK(); collation == nil || locale == collationSimple {
+		return collationSimple
+	}
+	elems, err := collation.Elements()
+	if err != nil {
+		return fmt.Sprintf("unreadable collation: %v", err)
+	}
+	var d bson.D
+	for _, e := range elems {
+		if e.Key() == "version" {
+			continue
+		}
+		d = append(d, bson.E{Key: e.Key(), Value: e.Value()})
+	}
+	data, err := bson.MarshalExtJSON(d, false, false)
+	if err != nil {
+		return fmt.Sprintf("unrenderable collation: %v", err)
+	}
+	return string(data)
+}
+
+func printCollationDiffs(w io.Writer, diffs []CollationDiff) {
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Collation Differences ===")
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s: source %s, dest %s\n", d.Namespace, d.Source, d.Dest)
+	}
+}
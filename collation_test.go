@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeCollations serves default collations by namespace, simple for the
+// others, and counts the lookups
+type fakeCollations struct {
+	collations map[string]bson.D
+	calls      int
+}
+
+func (fc *fakeCollations) DefaultCollation(ctx context.Context, db, col string) (bson.Raw, error) {
+	fc.calls++
+	d, ok := fc.collations[db+"."+col]
+	if !ok {
+		return nil, nil
+	}
+	return bson.Marshal(d)
+}
+
+func TestCollationDiffs(t *testing.T) {
+	caseInsensitive := bson.D{{Key: "locale", Value: "en"}, {Key: "strength", Value: 2}, {Key: "version", Value: "57.1"}}
+	src := &fakeCollations{collations: map[string]bson.D{
+		"db.users":  caseInsensitive,
+		"db.orders": caseInsensitive,
+	}}
+	// The same collation under another ICU version is not a difference
+	dest := &fakeCollations{collations: map[string]bson.D{
+		"db.orders": {{Key: "locale", Value: "en"}, {Key: "strength", Value: 2}, {Key: "version", Value: "72.1"}},
+	}}
+
+	docs := newFakeSource()
+	var lines []string
+	for _, ns := range []string{"db.users", "db.orders", "db.plain", "db.users"} {
+		id := primitive.NewObjectID()
+		docs.insert(ns, bson.D{{Key: "_id", Value: id}})
+		lines = append(lines, logLine(ns, id))
+	}
+	c := NewChecker(docs, docs)
+	c.Collations = newCollationCheck(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	diffs := c.CollationDiffs()
+	if len(diffs) != 1 || diffs[0].Namespace != "db.users" || diffs[0].Source != `{"locale":"en","strength":2}` || diffs[0].Dest != collationSimple {
+		t.Fatalf("collation diffs %+v, want db.users alone", diffs)
+	}
+	// Once per namespace
+	if src.calls != 3 || dest.calls != 3 {
+		t.Errorf("%d source and %d dest lookups, want 3 each", src.calls, dest.calls)
+	}
+
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "=== Collation Differences ===\ndb.users: source {\"locale\":\"en\",\"strength\":2}, dest simple\n") {
+		t.Errorf("report does not list the difference:\n%s", out.String())
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Kinds of FieldDiff
+const (
+	DiffChanged         = "changed"
+	DiffMissingInSource = "missing_in_source"
+	DiffMissingInDest   = "missing_in_dest"
+)
+
+// Classes of array differences, set on the FieldDiffs found inside an array.
+// A length delta, dest having fewer elements especially, points at truncated
+// replication; same-length arrays with different elements at corruption.
+const (
+	ArrayLengthDelta = "length_delta"
+	ArrayElementDiff = "element_diff"
+)
+
+// FieldDiff describes a single field that differs between source and dest
+type FieldDiff struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"` // "changed", "missing_in_source", "missing_in_dest"
+	Source string `json:"source,omitempty"`
+	Dest   string `json:"dest,omitempty"`
+
+	// Array classifies a difference inside an array, see ArrayLengthDelta
+	// and ArrayElementDiff. LengthDelta is dest length minus source length.
+	Array       string `json:"array,omitempty"`
+	LengthDelta int    `json:"lengthDelta,omitempty"`
+}
+
+func (d FieldDiff) String() string {
+	var s string
+	switch d.Kind {
+	case DiffMissingInSource:
+		s = fmt.Sprintf("%s: missing in source (dest: %s)", d.Path, d.Dest)
+	case DiffMissingInDest:
+		s = fmt.Sprintf("%s: missing in dest (source: %s)", d.Path, d.Source)
+	default:
+		s = fmt.Sprintf("%s: source %s != dest %s", d.Path, d.Source, d.Dest)
+	}
+	switch d.Array {
+	case ArrayLengthDelta:
+		s += fmt.Sprintf(" [array length delta %+d]", d.LengthDelta)
+	case ArrayElementDiff:
+		s += " [array elements differ, same length]"
+	}
+	return s
+}
+
+// comparer holds the options of the deep document comparison
+type comparer struct {
+	// unorderedArrays lists array paths compared as multisets
+	unorderedArrays map[string]bool
+	// arrayKeys maps array paths to the field their elements are matched by
+	arrayKeys map[string]string
+	// skipEncrypted leaves out of the comparison the values encrypted with
+	// CSFLE on both sides, whose ciphertext differs between clusters
+	skipEncrypted bool
+	// numericLoose treats numbers of equal value as equal whatever their
+	// types, such as int32 1, int64 1 and double 1.0
+	numericLoose bool
+	// collator, when set, treats strings that collate equal as equal. It
+	// keeps internal buffers, so collatorMu serializes the pool's workers.
+	collator   *collate.Collator
+	collatorMu sync.Mutex
+	// mask hides the values of masked fields in the diffs
+	mask *masker
+	// cache, when set, remembers the diffs of document pairs by content
+	cache *diffCache
+}
+
+// newComparer builds a comparer. unorderedArrays are dotted field paths of
+// arrays whose element order should be ignored.
+func newComparer(unorderedArrays []string) *comparer {
+	c := &comparer{unorderedArrays: make(map[string]bool), arrayKeys: make(map[string]string)}
+	for _, p := range unorderedArrays {
+		c.unorderedArrays[p] = true
+	}
+	return c
+}
+
+// diffDocs compares two documents field by field. Field order is ignored,
+// array element order and value types are not unless configured otherwise.
+func (c *comparer) diffDocs(src, dest bson.Raw) []FieldDiff {
+	var diffs []FieldDiff
+	c.diffDocument("", src, dest, &diffs)
+	return diffs
+}
+
+// diffDocsCached is diffDocs, reusing the differences found earlier for a
+// pair of documents with the same content, _id aside. Pairs whose _ids
+// differ are not cached, as the _id is part of their differences.
+func (c *comparer) diffDocsCached(src, dest bson.Raw) []FieldDiff {
+	if c.cache == nil || !src.Lookup("_id").Equal(dest.Lookup("_id")) {
+		return c.diffDocs(src, dest)
+	}
+	key := contentKey(src) + contentKey(dest)
+	if diffs, ok := c.cache.Get(key); ok {
+		return diffs
+	}
+	diffs := c.diffDocs(src, dest)
+	c.cache.Put(key, diffs)
+	return diffs
+}
+
+// contentKey returns the SHA-256 of the elements of doc but its _id
+func contentKey(doc bson.Raw) string {
+	h := sha256.New()
+	elems, _ := doc.Elements()
+	for _, e := range elems {
+		if e.Key() != "_id" {
+			h.Write(e)
+		}
+	}
+	return string(h.Sum(nil))
+}
+
+func (c *comparer) diffDocument(prefix string, src, dest bson.Raw, diffs *[]FieldDiff) {
+	srcElems, _ := src.Elements()
+	destElems, _ := dest.Elements()
+
+	destByKey := make(map[string]bson.RawValue, len(destElems))
+	for _, e := range destElems {
+		destByKey[e.Key()] = e.Value()
+	}
+
+	seen := make(map[string]bool, len(srcElems))
+	for _, e := range srcElems {
+		key := e.Key()
+		seen[key] = true
+		path := joinPath(prefix, key)
+		dv, ok := destByKey[key]
+		if !ok {
+			*diffs = append(*diffs, FieldDiff{Path: path, Kind: DiffMissingInDest, Source: c.mask.format(path, e.Value())})
+			continue
+		}
+		c.diffValue(path, e.Value(), dv, diffs)
+	}
+	for _, e := range destElems {
+		if !seen[e.Key()] {
+			path := joinPath(prefix, e.Key())
+			*diffs = append(*diffs, FieldDiff{Path: path, Kind: DiffMissingInSource, Dest: c.mask.format(path, e.Value())})
+		}
+	}
+}
+
+func (c *comparer) diffValue(path string, src, dest bson.RawValue, diffs *[]FieldDiff) {
+	if c.skipEncrypted && encrypted(src) && encrypted(dest) {
+		return
+	}
+	if src.Type == bsontype.EmbeddedDocument && dest.Type == bsontype.EmbeddedDocument {
+		c.diffDocument(path, src.Document(), dest.Document(), diffs)
+		return
+	}
+	if src.Type == bsontype.Array && dest.Type == bsontype.Array {
+		start := len(*diffs)
+		if key, ok := c.arrayKeys[schemaPath(path)]; ok {
+			c.diffKeyedArray(path, key, src.Array(), dest.Array(), diffs)
+		} else if c.unorderedArrays[schemaPath(path)] {
+			c.diffMultiset(path, src.Array(), dest.Array(), diffs)
+		} else {
+			c.diffArray(path, src.Array(), dest.Array(), diffs)
+		}
+		classifyArrayDiffs((*diffs)[start:], src.Array(), dest.Array())
+		return
+	}
+	if !src.Equal(dest) && !c.collateEqual(src, dest) && !(c.numericLoose && numericEqual(src, dest)) {
+		*diffs = append(*diffs, FieldDiff{Path: path, Kind: DiffChanged, Source: c.mask.format(path, src), Dest: c.mask.format(path, dest)})
+	}
+}
+
+// encryptedSubtype is the binary subtype of CSFLE ciphertext
+const encryptedSubtype = 6
+
+// encrypted reports whether v is a CSFLE-encrypted value
+func encrypted(v bson.RawValue) bool {
+	subtype, _, ok := v.BinaryOK()
+	return ok && subtype == encryptedSubtype
+}
+
+// numericEqual reports whether two values are numbers (int32, int64,
+// double or decimal128) of the same mathematical value. NaNs and infinities
+// are equal to nothing.
+func numericEqual(src, dest bson.RawValue) bool {
+	a, ok := numericValue(src)
+	if !ok {
+		return false
+	}
+	b, ok := numericValue(dest)
+	return ok && a.Cmp(b) == 0
+}
+
+// numericValue returns the exact value of a number
+func numericValue(v bson.RawValue) (*big.Rat, bool) {
+	switch v.Type {
+	case bsontype.Int32:
+		return new(big.Rat).SetInt64(int64(v.Int32())), true
+	case bsontype.Int64:
+		return new(big.Rat).SetInt64(v.Int64()), true
+	case bsontype.Double:
+		f := v.Double()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(f), true
+	case bsontype.Decimal128:
+		coefficient, exp, err := v.Decimal128().BigInt()
+		if err != nil {
+			return nil, false
+		}
+		r := new(big.Rat).SetInt(coefficient)
+		if exp < 0 {
+			return r.Quo(r, new(big.Rat).SetInt(pow10(-exp))), true
+		}
+		return r.Mul(r, new(big.Rat).SetInt(pow10(exp))), true
+	}
+	return nil, false
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// collateEqual reports whether two strings are equal under the collation
+func (c *comparer) collateEqual(src, dest bson.RawValue) bool {
+	if c.collator == nil || src.Type != bsontype.String || dest.Type != bsontype.String {
+		return false
+	}
+	c.collatorMu.Lock()
+	defer c.collatorMu.Unlock()
+	return c.collator.CompareString(src.StringValue(), dest.StringValue()) == 0
+}
+
+// parseCollation builds a collator from "<locale>,<strength>", where
+// strength follows MongoDB collations: 1 ignores case and diacritics, 2
+// ignores case, 3 compares both but still equates canonically equivalent
+// forms. The strength defaults to 3.
+func parseCollation(spec string) (*collate.Collator, error) {
+	locale, strength, _ := strings.Cut(spec, ",")
+	tag, err := language.Parse(strings.TrimSpace(locale))
+	if err != nil {
+		return nil, fmt.Errorf("invalid locale %q: %w", locale, err)
+	}
+	var opts []collate.Option
+	switch strings.TrimSpace(strength) {
+	case "1":
+		opts = append(opts, collate.IgnoreCase, collate.IgnoreDiacritics)
+	case "2":
+		opts = append(opts, collate.IgnoreCase)
+	case "3", "":
+	default:
+		return nil, fmt.Errorf("invalid strength %q: must be 1, 2 or 3", strength)
+	}
+	return collate.New(tag, opts...), nil
+}
+
+// classifyArrayDiffs annotates the differences found inside an array by
+// whether its length changed. Differences already classified by a nested
+// array keep their own class.
+func classifyArrayDiffs(diffs []FieldDiff, src, dest bson.Raw) {
+	srcVals, _ := src.Values()
+	destVals, _ := dest.Values()
+	delta := len(destVals) - len(srcVals)
+	for i := range diffs {
+		if diffs[i].Array != "" {
+			continue
+		}
+		if delta != 0 {
+			diffs[i].Array, diffs[i].LengthDelta = ArrayLengthDelta, delta
+		} else {
+			diffs[i].Array = ArrayElementDiff
+		}
+	}
+}
+
+func (c *comparer) diffArray(path string, src, dest bson.Raw, diffs *[]FieldDiff) {
+	srcVals, _ := src.Values()
+	destVals, _ := dest.Values()
+	for i := 0; i < len(srcVals) || i < len(destVals); i++ {
+		elemPath := fmt.Sprintf("%s.%d", path, i)
+		switch {
+		case i >= len(destVals):
+			*diffs = append(*diffs, FieldDiff{Path: elemPath, Kind: DiffMissingInDest, Source: c.mask.format(elemPath, srcVals[i])})
+		case i >= len(srcVals):
+			*diffs = append(*diffs, FieldDiff{Path: elemPath, Kind: DiffMissingInSource, Dest: c.mask.format(elemPath, destVals[i])})
+		default:
+			c.diffValue(elemPath, srcVals[i], destVals[i], diffs)
+		}
+	}
+}
+
+// diffMultiset compares two arrays ignoring element order. Elements are
+// matched by exact BSON type and value, or by value alone for numbers under
+// numericLoose; unmatched elements are reported against the array path
+// itself.
+func (c *comparer) diffMultiset(path string, src, dest bson.Raw, diffs *[]FieldDiff) {
+	srcVals, _ := src.Values()
+	destVals, _ := dest.Values()
+
+	remaining := make(map[string]int, len(destVals))
+	for _, v := range destVals {
+		remaining[c.valueKey(v)]++
+	}
+	for _, v := range srcVals {
+		k := c.valueKey(v)
+		if remaining[k] > 0 {
+			remaining[k]--
+			continue
+		}
+		*diffs = append(*diffs, FieldDiff{Path: path, Kind: DiffMissingInDest, Source: c.mask.format(path, v)})
+	}
+	for _, v := range destVals {
+		k := c.valueKey(v)
+		if remaining[k] > 0 {
+			remaining[k]--
+			*diffs = append(*diffs, FieldDiff{Path: path, Kind: DiffMissingInSource, Dest: c.mask.format(path, v)})
+		}
+	}
+}
+
+// parseArrayKey parses an -array-key value, <path>=<field>
+func parseArrayKey(s string) (string, string, error) {
+	path, field, _ := strings.Cut(s, "=")
+	path, field = strings.TrimSpace(path), strings.TrimSpace(field)
+	if path == "" || field == "" {
+		return "", "", fmt.Errorf("%q is not of the form <path>=<field>", s)
+	}
+	return path, field, nil
+}
+
+// diffKeyedArray compares two arrays of subdocuments matching their
+// elements by the value of their key field rather than by position. An
+// element is reported under its index in the source, or in dest for one
+// found only there. Elements sharing a key, or all lacking it, are matched
+// in order of appearance.
+func (c *comparer) diffKeyedArray(path, key string, src, dest bson.Raw, diffs *[]FieldDiff) {
+	srcVals, _ := src.Values()
+	destVals, _ := dest.Values()
+
+	// Indexes of the dest elements of each key, in order
+	destByKey := make(map[string][]int, len(destVals))
+	for i, v := range destVals {
+		k := c.elementKey(v, key)
+		destByKey[k] = append(destByKey[k], i)
+	}
+	matched := make([]bool, len(destVals))
+	for i, v := range srcVals {
+		elemPath := fmt.Sprintf("%s.%d", path, i)
+		k := c.elementKey(v, key)
+		if len(destByKey[k]) == 0 {
+			*diffs = append(*diffs, FieldDiff{Path: elemPath, Kind: DiffMissingInDest, Source: c.mask.format(elemPath, v)})
+			continue
+		}
+		j := destByKey[k][0]
+		destByKey[k] = destByKey[k][1:]
+		matched[j] = true
+		c.diffValue(elemPath, v, destVals[j], diffs)
+	}
+	for j, v := range destVals {
+		if !matched[j] {
+			elemPath := fmt.Sprintf("%s.%d", path, j)
+			*diffs = append(*diffs, FieldDiff{Path: elemPath, Kind: DiffMissingInSource, Dest: c.mask.format(elemPath, v)})
+		}
+	}
+}
+
+// elementKey identifies an array element by the value of its key field,
+// or as keyless when it is not a document holding the field
+func (c *comparer) elementKey(v bson.RawValue, key string) string {
+	doc, ok := v.DocumentOK()
+	if !ok {
+		return ""
+	}
+	kv, err := doc.LookupErr(key)
+	if err != nil {
+		return ""
+	}
+	return c.valueKey(kv)
+}
+
+// valueKey identifies a value for matching array elements: by rawValueKey,
+// or under numericLoose by the exact value of a number, so that int32 1 and
+// double 1.0 share a key. Type 0 is no BSON type, so the key of a number
+// cannot collide with that of another value.
+func (c *comparer) valueKey(v bson.RawValue) string {
+	if c.numericLoose {
+		if r, ok := numericValue(v); ok {
+			return "\x00" + r.RatString()
+		}
+	}
+	return rawValueKey(v)
+}
+
+// rawValueKey identifies a BSON value by its type and encoded bytes
+func rawValueKey(v bson.RawValue) string {
+	return string(rune(v.Type)) + string(v.Value)
+}
+
+// schemaPath strips array indexes from a field path, so "items.3.tags"
+// becomes "items.tags". Options are configured against these paths.
+func schemaPath(path string) string {
+	parts := strings.Split(path, ".")
+	kept := parts[:0]
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err == nil {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return strings.Join(kept, ".")
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
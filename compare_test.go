@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUnorderedArrayField(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("db.col", bson.D{
+		{Key: "_id", Value: id},
+		{Key: "tags", Value: bson.A{"a", "b", "c"}},
+		{Key: "ranks", Value: bson.A{1, 2}},
+	})
+	dest.insert("db.col", bson.D{
+		{Key: "_id", Value: id},
+		{Key: "tags", Value: bson.A{"c", "a", "b"}},
+		{Key: "ranks", Value: bson.A{1, 2}},
+	})
+
+	c := NewChecker(src, dest)
+	if res := c.checkDoc(context.Background(), "db", "col", id); res.Status != StatusMismatch {
+		t.Fatalf("without the option a reordered array should mismatch, got %s", res.Status)
+	}
+
+	c.Compare = newComparer([]string{"tags"})
+	if res := c.checkDoc(context.Background(), "db", "col", id); res.Status != StatusMatch {
+		t.Errorf("reordered tags should match when unordered, got %s: %v", res.Status, res.Diffs)
+	}
+}
+
+func TestUnorderedArrayFieldCountsDuplicates(t *testing.T) {
+	c := newComparer([]string{"items.tags"})
+	src, _ := bson.Marshal(bson.D{{Key: "items", Value: bson.A{bson.D{{Key: "tags", Value: bson.A{"x", "x", "y"}}}}}})
+	dest, _ := bson.Marshal(bson.D{{Key: "items", Value: bson.A{bson.D{{Key: "tags", Value: bson.A{"y", "x", "z"}}}}}})
+
+	diffs := c.diffDocs(src, dest)
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %v", diffs)
+	}
+	if diffs[0].Kind != DiffMissingInDest || diffs[0].Source != `"x"` || diffs[0].Path != "items.0.tags" {
+		t.Errorf("unexpected first diff %+v", diffs[0])
+	}
+	if diffs[1].Kind != DiffMissingInSource || diffs[1].Dest != `"z"` {
+		t.Errorf("unexpected second diff %+v", diffs[1])
+	}
+}
+
+func TestArrayKey(t *testing.T) {
+	item := func(sku string, qty int) bson.D {
+		return bson.D{{Key: "sku", Value: sku}, {Key: "qty", Value: qty}}
+	}
+	src, _ := bson.Marshal(bson.D{{Key: "items", Value: bson.A{item("A1", 1), item("B2", 2), item("C3", 3)}}})
+	reordered, _ := bson.Marshal(bson.D{{Key: "items", Value: bson.A{item("C3", 3), item("A1", 1), item("B2", 2)}}})
+	changed, _ := bson.Marshal(bson.D{{Key: "items", Value: bson.A{item("B2", 5), item("D4", 4), item("A1", 1)}}})
+
+	c := newComparer(nil)
+	if diffs := c.diffDocs(src, reordered); len(diffs) == 0 {
+		t.Fatal("without the option reordered line items should differ")
+	}
+
+	c.arrayKeys["items"] = "sku"
+	if diffs := c.diffDocs(src, reordered); len(diffs) != 0 {
+		t.Errorf("reordered line items should match when keyed, got %v", diffs)
+	}
+	want := []FieldDiff{
+		{Path: "items.1.qty", Kind: DiffChanged, Source: `{"$numberInt":"2"}`, Dest: `{"$numberInt":"5"}`},
+		{Path: "items.2", Kind: DiffMissingInDest},
+		{Path: "items.1", Kind: DiffMissingInSource},
+	}
+	diffs := c.diffDocs(src, changed)
+	if len(diffs) != len(want) {
+		t.Fatalf("diffs %v, want %v", diffs, want)
+	}
+	for i, d := range diffs {
+		if d.Path != want[i].Path || d.Kind != want[i].Kind || (want[i].Kind == DiffChanged && (d.Source != want[i].Source || d.Dest != want[i].Dest)) {
+			t.Errorf("diff %d: %+v, want %+v", i, d, want[i])
+		}
+	}
+}
+
+func TestCollation(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "José Müller"}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "JOSÉ MÜLLER"}})
+
+	c := NewChecker(src, dest)
+	if res := c.checkDoc(context.Background(), "db", "col", id); res.Status != StatusMismatch {
+		t.Fatalf("without a collation a case difference should mismatch, got %s", res.Status)
+	}
+
+	var err error
+	if c.Compare.collator, err = parseCollation("en,2"); err != nil {
+		t.Fatal(err)
+	}
+	if res := c.checkDoc(context.Background(), "db", "col", id); res.Status != StatusMatch {
+		t.Errorf("case-insensitive collation should match, got %s: %v", res.Status, res.Diffs)
+	}
+
+	// Strength 2 still distinguishes accents
+	src.insert("db.col", bson.D{{Key: "_id", Value: "x"}, {Key: "name", Value: "Jose"}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: "x"}, {Key: "name", Value: "josé"}})
+	if res := c.checkDoc(context.Background(), "db", "col", "x"); res.Status != StatusMismatch {
+		t.Errorf("accent difference at strength 2 should mismatch, got %s", res.Status)
+	}
+
+	for _, spec := range []string{"en,4", "not a locale!,1"} {
+		if _, err := parseCollation(spec); err == nil {
+			t.Errorf("parseCollation(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestArrayDiffClassification(t *testing.T) {
+	c := newComparer(nil)
+	src, _ := bson.Marshal(bson.D{
+		{Key: "log", Value: bson.A{"a", "b", "c"}},
+		{Key: "tags", Value: bson.A{"x", "y"}},
+	})
+	dest, _ := bson.Marshal(bson.D{
+		{Key: "log", Value: bson.A{"a"}},
+		{Key: "tags", Value: bson.A{"x", "z"}},
+	})
+
+	diffs := c.diffDocs(src, dest)
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 diffs, got %v", diffs)
+	}
+	for _, d := range diffs[:2] {
+		if d.Array != ArrayLengthDelta || d.LengthDelta != -2 {
+			t.Errorf("truncated array: got %+v, want a length delta of -2", d)
+		}
+	}
+	if d := diffs[2]; d.Path != "tags.1" || d.Array != ArrayElementDiff || d.LengthDelta != 0 {
+		t.Errorf("equal-length array: got %+v, want an element diff", d)
+	}
+	if got := diffs[0].String(); got != `log.1: missing in dest (source: "b") [array length delta -2]` {
+		t.Errorf("String() = %q", got)
+	}
+	if got := diffs[2].String(); got != `tags.1: source "y" != dest "z" [array elements differ, same length]` {
+		t.Errorf("String() = %q", got)
+	}
+
+	// A field that is not in an array is not classified
+	src, _ = bson.Marshal(bson.D{{Key: "n", Value: 1}})
+	dest, _ = bson.Marshal(bson.D{{Key: "n", Value: 2}})
+	if diffs := c.diffDocs(src, dest); len(diffs) != 1 || diffs[0].Array != "" {
+		t.Errorf("scalar diff classified as an array diff: %+v", diffs)
+	}
+}
+
+func TestCompareCache(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	first, second, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	// first and second share their content on each side, other does not
+	for _, id := range []primitive.ObjectID{first, second, other} {
+		src.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "mode", Value: "shared"}, {Key: "v", Value: 1}})
+		v := 2
+		if id == other {
+			v = 3
+		}
+		dest.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "v", Value: v}, {Key: "mode", Value: "shared"}})
+	}
+
+	c := NewChecker(src, dest)
+	c.Compare.cache = newDiffCache(10)
+	var results []CheckResult
+	for _, id := range []primitive.ObjectID{first, second, other} {
+		results = append(results, c.checkDoc(context.Background(), "db", "col", id))
+	}
+	if hits := c.CompareCacheHits(); hits != 1 {
+		t.Errorf("%d cache hits, want the second pair alone answered by the cache", hits)
+	}
+	for i, res := range results {
+		if res.Status != StatusMismatch || len(res.Diffs) != 1 || res.Diffs[0].Path != "v" {
+			t.Errorf("result %d: %s %v, want a Mismatch on v", i, res.Status, res.Diffs)
+		}
+	}
+	if results[1].ID != second || results[1].Diffs[0].Dest != results[0].Diffs[0].Dest {
+		t.Errorf("cached result %v %v, want the differences of the first pair under the second id", results[1].ID, results[1].Diffs)
+	}
+}
+
+func TestSkipEncrypted(t *testing.T) {
+	cipher := func(b byte) primitive.Binary {
+		return primitive.Binary{Subtype: encryptedSubtype, Data: []byte{1, b, b, b}}
+	}
+	src, _ := bson.Marshal(bson.D{{Key: "ssn", Value: cipher(1)}, {Key: "card", Value: bson.D{{Key: "number", Value: cipher(2)}}}, {Key: "name", Value: "Ann"}})
+	dest, _ := bson.Marshal(bson.D{{Key: "ssn", Value: cipher(3)}, {Key: "card", Value: bson.D{{Key: "number", Value: cipher(4)}}}, {Key: "name", Value: "Anne"}})
+
+	c := newComparer(nil)
+	if diffs := c.diffDocs(src, dest); len(diffs) != 3 {
+		t.Fatalf("without the option the ciphertexts should differ, got %v", diffs)
+	}
+	c.skipEncrypted = true
+	diffs := c.diffDocs(src, dest)
+	if len(diffs) != 1 || diffs[0].Path != "name" {
+		t.Errorf("diffs %v, want the plaintext name alone", diffs)
+	}
+
+	// A value encrypted on one side only, in plaintext on the other, is
+	// compared
+	plain, _ := bson.Marshal(bson.D{{Key: "ssn", Value: "123-45-6789"}, {Key: "card", Value: bson.D{{Key: "number", Value: cipher(4)}}}, {Key: "name", Value: "Ann"}})
+	diffs = c.diffDocs(src, plain)
+	if len(diffs) != 1 || diffs[0].Path != "ssn" || diffs[0].Kind != DiffChanged {
+		t.Errorf("encrypted source vs plaintext dest: diffs %v, want ssn changed", diffs)
+	}
+}
+
+func TestNumericLoose(t *testing.T) {
+	dec := func(s string) primitive.Decimal128 {
+		d, err := primitive.ParseDecimal128(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	src, _ := bson.Marshal(bson.D{
+		{Key: "a", Value: int32(1)}, {Key: "b", Value: int64(1 << 40)}, {Key: "c", Value: 2.0},
+		{Key: "d", Value: dec("2.50")}, {Key: "e", Value: bson.A{int32(7)}}, {Key: "f", Value: int64(3)},
+		{Key: "g", Value: int64(1<<53 + 1)}, {Key: "h", Value: "1"},
+	})
+	dest, _ := bson.Marshal(bson.D{
+		{Key: "a", Value: int64(1)}, {Key: "b", Value: float64(1 << 40)}, {Key: "c", Value: int32(2)},
+		{Key: "d", Value: 2.5}, {Key: "e", Value: bson.A{7.0}}, {Key: "f", Value: 3.5},
+		{Key: "g", Value: float64(1 << 53)}, {Key: "h", Value: int32(1)},
+	})
+
+	c := newComparer(nil)
+	if diffs := c.diffDocs(src, dest); len(diffs) != 8 {
+		t.Fatalf("strict comparison: %d diffs, want every field to differ: %v", len(diffs), diffs)
+	}
+	c.numericLoose = true
+	var paths []string
+	for _, d := range c.diffDocs(src, dest) {
+		paths = append(paths, d.Path)
+	}
+	// Different values still differ, 2^53+1 included, which a double
+	// cannot hold; a string is not a number
+	if got := strings.Join(paths, ","); got != "f,g,h" {
+		t.Errorf("loose comparison differs at %s, want f,g,h", got)
+	}
+	// Array elements are matched by value too: in an unordered array, and
+	// by an array key
+	c = newComparer([]string{"tags"})
+	c.arrayKeys["items"] = "sku"
+	src, _ = bson.Marshal(bson.D{
+		{Key: "tags", Value: bson.A{int32(1), int32(2)}},
+		{Key: "items", Value: bson.A{bson.D{{Key: "sku", Value: int32(5)}, {Key: "qty", Value: 1}}}},
+	})
+	dest, _ = bson.Marshal(bson.D{
+		{Key: "tags", Value: bson.A{2.0, 1.0}},
+		{Key: "items", Value: bson.A{bson.D{{Key: "sku", Value: int64(5)}, {Key: "qty", Value: 1}}}},
+	})
+	if diffs := c.diffDocs(src, dest); len(diffs) != 6 {
+		t.Errorf("strict comparison of arrays: %d diffs, want 6: %v", len(diffs), diffs)
+	}
+	c.numericLoose = true
+	if diffs := c.diffDocs(src, dest); len(diffs) != 0 {
+		t.Errorf("loose comparison of arrays: %v, want none", diffs)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// Server compatibility modes
+const (
+	compatMongoDB    = "mongodb"
+	compatDocumentDB = "documentdb"
+)
+
+// clientOptions builds the driver options for uri in the given compatibility mode
+func clientOptions(uri, compat string) *options.ClientOptions {
+	opts := options.Client().ApplyURI(uri)
+	if compat == compatDocumentDB {
+		// DocumentDB rejects retryable writes. The tool never writes, but
+		// the driver still attaches retryable-write support to sessions.
+		opts.SetRetryWrites(false)
+	}
+	return opts
+}
+
+// validateURI checks a connection string before connecting, so that a typo
+// fails at once with what is wrong rather than as a server selection
+// timeout. Its errors never quote the password.
+func validateURI(uri string) error {
+	if strings.TrimSpace(uri) != uri {
+		return errors.New("leading or trailing whitespace; remove it")
+	}
+	if len(uri) >= 2 && strings.ContainsRune(`"'`, rune(uri[0])) && uri[len(uri)-1] == uri[0] {
+		return errors.New("the connection string is quoted; remove the quotes")
+	}
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return errors.New("missing scheme; a connection string starts with mongodb:// or mongodb+srv://")
+	}
+	if scheme != "mongodb" && scheme != "mongodb+srv" {
+		want := "mongodb"
+		if strings.Contains(strings.ToLower(scheme), "srv") {
+			want = "mongodb+srv"
+		}
+		return fmt.Errorf("unknown scheme %s://; did you mean %s://?", scheme, want)
+	}
+
+	hosts := rest
+	if i := strings.IndexAny(hosts, "/?"); i >= 0 {
+		hosts = hosts[:i]
+	}
+	if i := strings.LastIndex(hosts, "@"); i >= 0 {
+		if strings.Contains(hosts[:i], "@") {
+			return errors.New("the username or password contains an unescaped @; percent-encode it as %40")
+		}
+		hosts = hosts[i+1:]
+	}
+	if hosts == "" {
+		return fmt.Errorf("no host after %s://", scheme)
+	}
+	if scheme == "mongodb+srv" && (strings.Contains(hosts, ",") || strings.Contains(hosts, ":")) {
+		return fmt.Errorf("mongodb+srv:// takes a single host name without a port, got %q; use mongodb:// to list hosts and ports", hosts)
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		if h == "" {
+			return fmt.Errorf("empty host in %q", hosts)
+		}
+		if strings.HasPrefix(h, "[") {
+			continue // IPv6 literal, left to the driver
+		}
+		if _, port, ok := strings.Cut(h, ":"); ok {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("invalid port %q of host %q; a port is a number from 1 to 65535", port, h)
+			}
+		}
+	}
+
+	// The driver checks the options too; it resolves mongodb+srv:// hosts
+	// while parsing, which resolveSRV does with its own error
+	if scheme == "mongodb" {
+		if _, err := connstring.ParseAndValidate(uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateURIs validates the connection strings of the command line
+func validateURIs(cfg Config) error {
+	for _, f := range []struct{ flag, uri string }{{"source", cfg.Source}, {"dest", cfg.Dest}, {"results-uri", cfg.ResultsURI}} {
+		if f.uri == "" {
+			continue
+		}
+		if err := validateURI(f.uri); err != nil {
+			return fmt.Errorf("invalid -%s: %w", f.flag, err)
+		}
+	}
+	return nil
+}
+
+// connectMongo connects to uri and pings the deployment. For mongodb+srv://
+// URIs the seed list is resolved first, so DNS problems surface as such
+// rather than as a generic connection failure.
+func connectMongo(ctx context.Context, uri, compat string, srvTimeout time.Duration) (*mongo.Client, error) {
+	if err := resolveSRV(ctx, uri, srvTimeout); err != nil {
+		return nil, err
+	}
+	clientOptions := clientOptions(uri, compat)
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	// Ping to verify
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Connection failure classes, see classifyConnectError
+const (
+	connErrDNS   = "dns"
+	connErrAuth  = "auth"
+	connErrOther = "other"
+)
+
+// srvError reports a failed mongodb+srv:// seed list resolution
+type srvError struct {
+	host string
+	err  error
+}
+
+func (e *srvError) Error() string {
+	return fmt.Sprintf("DNS/SRV resolution failed for host %q (SRV record _mongodb._tcp.%s): %v; "+
+		"check the hostname in the connection string and that DNS is reachable from this machine",
+		e.host, e.host, e.err)
+}
+
+func (e *srvError) Unwrap() error { return e.err }
+
+// lookupSRV is net.DefaultResolver.LookupSRV, replaceable in tests
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+// resolveSRV resolves the seed list of a mongodb+srv:// URI within timeout.
+// Other URIs are left alone.
+func resolveSRV(ctx context.Context, uri string, timeout time.Duration) error {
+	host, ok := srvHost(uri)
+	if !ok {
+		return nil
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if _, _, err := lookupSRV(ctx, "mongodb", "tcp", host); err != nil {
+		return &srvError{host: host, err: err}
+	}
+	return nil
+}
+
+// srvHost extracts the host of a mongodb+srv:// URI
+func srvHost(uri string) (string, bool) {
+	rest, ok := strings.CutPrefix(uri, "mongodb+srv://")
+	if !ok {
+		return "", false
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest, rest != ""
+}
+
+// classifyConnectError tells DNS resolution failures apart from
+// authentication failures when connecting
+func classifyConnectError(err error) string {
+	var srvErr *srvError
+	var dnsErr *net.DNSError
+	if errors.As(err, &srvErr) || errors.As(err, &dnsErr) {
+		return connErrDNS
+	}
+	var authErr *auth.Error
+	if errors.As(err, &authErr) || classifyError(err) == ErrClassAuth {
+		return connErrAuth
+	}
+	return connErrOther
+}
+
+// connectError describes a failed connection to one side. DNS failures
+// already carry their own explanation.
+func connectError(side string, err error) error {
+	if classifyConnectError(err) == connErrAuth {
+		return fmt.Errorf("failed to connect to %s: authentication failed, check the credentials and authSource in the URI: %w", side, err)
+	}
+	return fmt.Errorf("failed to connect to %s: %w", side, err)
+}
+
+// endpointKey normalizes a connection string to the cluster it points at:
+// its scheme, sorted lowercase host:port list and replica set name.
+// Credentials, database and other options are ignored.
+func endpointKey(uri string) string {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return uri
+	}
+	var query string
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+
+	hosts := strings.Split(strings.ToLower(rest), ",")
+	for i, h := range hosts {
+		if scheme == "mongodb" && !strings.Contains(h, ":") {
+			hosts[i] = h + ":27017"
+		}
+	}
+	sort.Strings(hosts)
+
+	key := scheme + "://" + strings.Join(hosts, ",")
+	if q, err := url.ParseQuery(query); err == nil && q.Get("replicaSet") != "" {
+		key += "/?replicaSet=" + q.Get("replicaSet")
+	}
+	return key
+}
+
+// sameEndpoint reports whether two connection strings point at the same cluster
+func sameEndpoint(a, b string) bool {
+	return endpointKey(a) == endpointKey(b)
+}
+
+// redactURI hides the password of a connection string
+func redactURI(uri string) string {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return uri
+	}
+	hostEnd := strings.IndexAny(rest, "/?")
+	if hostEnd < 0 {
+		hostEnd = len(rest)
+	}
+	at := strings.LastIndex(rest[:hostEnd], "@")
+	if at < 0 {
+		return uri
+	}
+	user, _, hasPassword := strings.Cut(rest[:at], ":")
+	if hasPassword {
+		user += ":xxxxx"
+	}
+	return scheme + "://" + user + rest[at:]
+}
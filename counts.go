@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CountResult holds the document counts of a namespace on both sides
+type CountResult struct {
+	Namespace string `json:"namespace"`
+	Source    int64  `json:"source"`
+	Dest      int64  `json:"dest"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CheckCounts counts the documents of each namespace on both sides
+func (c *Checker) CheckCounts(ctx context.Context, namespaces []string) []CountResult {
+	results := make([]CountResult, 0, len(namespaces))
+	for _, ns := range namespaces {
+		res := CountResult{Namespace: ns}
+		db, col, err := splitNamespace(ns)
+		if err == nil {
+			res.Source, err = c.Src.CountDocuments(ctx, db, col, bson.M{}, 0)
+			if err != nil {
+				err = fmt.Errorf("source error: %w", err)
+			}
+		}
+		if err == nil {
+			res.Dest, err = c.Dest.CountDocuments(ctx, db, col, bson.M{}, 0)
+			if err != nil {
+				err = fmt.Errorf("dest error: %w", err)
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// printCountReport writes the result of the counts command
+func printCountReport(w io.Writer, results []CountResult) {
+	fmt.Fprintln(w, "\n=== Count Report ===")
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s: %s\n", r.Namespace, r.Error)
+			continue
+		}
+		marker := ""
+		if r.Source != r.Dest {
+			marker = "  <-- differs"
+		}
+		fmt.Fprintf(w, "%s: source %d, dest %d (%+d)%s\n", r.Namespace, r.Source, r.Dest, r.Dest-r.Source, marker)
+	}
+}
+
+// jsonCountReport is the document written by the counts command with -output json
+type jsonCountReport struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Metadata      jsonMetadata  `json:"metadata"`
+	Counts        []CountResult `json:"counts"`
+}
+
+func writeCountReport(w io.Writer, meta jsonMetadata, results []CountResult) error {
+	meta.EndTime = time.Now().UTC()
+	return json.NewEncoder(w).Encode(jsonCountReport{
+		SchemaVersion: reportSchemaVersion,
+		Metadata:      meta,
+		Counts:        results,
+	})
+}
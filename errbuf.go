@@ -0,0 +1,38 @@
+package main
+
+// recentError is a per-line error kept for the final report
+type recentError struct {
+	Line      int
+	Namespace string
+	Message   string
+}
+
+// errorRing keeps the last capacity errors added to it, overwriting the
+// oldest once full.
+type errorRing struct {
+	buf   []recentError
+	next  int // index of the slot written next
+	total int // errors added, including overwritten ones
+}
+
+func newErrorRing(capacity int) *errorRing {
+	return &errorRing{buf: make([]recentError, 0, capacity)}
+}
+
+// Add appends e, dropping the oldest error when the ring is full
+func (r *errorRing) Add(e recentError) {
+	r.total++
+	if len(r.buf) < cap(r.buf) {
+		r.buf = append(r.buf, e)
+		return
+	}
+	r.buf[r.next] = e
+	r.next = (r.next + 1) % len(r.buf)
+}
+
+// Errors returns the kept errors, oldest first
+func (r *errorRing) Errors() []recentError {
+	out := make([]recentError, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestErrorRingKeepsLastN(t *testing.T) {
+	r := newErrorRing(3)
+	for i := 1; i <= 5; i++ {
+		r.Add(recentError{Line: i, Namespace: "db.col", Message: "boom"})
+	}
+	got := r.Errors()
+	if len(got) != 3 || r.total != 5 {
+		t.Fatalf("kept %d of %d errors, want 3 of 5", len(got), r.total)
+	}
+	for i, e := range got {
+		if e.Line != i+3 {
+			t.Errorf("Errors()[%d].Line = %d, want %d", i, e.Line, i+3)
+		}
+	}
+
+	var out strings.Builder
+	printRecentErrors(&out, r)
+	if !strings.Contains(out.String(), "Recent Errors (last 3 of 5)") || !strings.Contains(out.String(), "Line 5 [db.col]: boom") {
+		t.Errorf("unexpected text output:\n%s", out.String())
+	}
+
+	// Below capacity, nothing is dropped
+	r = newErrorRing(3)
+	r.Add(recentError{Line: 1})
+	if got := r.Errors(); len(got) != 1 || got[0].Line != 1 {
+		t.Errorf("Errors() = %v, want line 1 only", got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Error classes tallied separately in Stats
+const (
+	ErrClassNetwork           = "network"
+	ErrClassAuth              = "auth"
+	ErrClassTimeout           = "timeout"
+	ErrClassNamespaceNotFound = "namespace-not-found"
+	ErrClassOther             = "other"
+	ErrClassPanic             = "panic"       // the check itself panicked
+	ErrClassNoChecksum        = "no-checksum" // -checksum-field absent from a document
+)
+
+// Server error codes used for classification
+const (
+	codeUnauthorized         = 13
+	codeAuthenticationFailed = 18
+	codeNamespaceNotFound    = 26
+)
+
+// classifyError maps a driver error to one of the ErrClass categories
+func classifyError(err error) string {
+	// No server could be selected: the cluster is unreachable. Checked first
+	// as it wraps the deadline that ran out while waiting.
+	var sse topology.ServerSelectionError
+	if errors.As(err, &sse) {
+		return ErrClassNetwork
+	}
+	if mongo.IsTimeout(err) {
+		return ErrClassTimeout
+	}
+	if mongo.IsNetworkError(err) {
+		return ErrClassNetwork
+	}
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		switch {
+		case ce.HasErrorCode(codeUnauthorized), ce.HasErrorCode(codeAuthenticationFailed):
+			return ErrClassAuth
+		case ce.HasErrorCode(codeNamespaceNotFound):
+			return ErrClassNamespaceNotFound
+		}
+		return ErrClassOther
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return ErrClassNetwork
+	}
+	return ErrClassOther
+}
+
+// Host patterns scrubbed by redactDetails, in this order: an address with a
+// port, a bare IPv4 address, a host after the @ of credentials, and a dotted
+// host name under a common top-level or internal domain. Other dotted names,
+// such as db.collection namespaces, are left alone.
+var (
+	hostPortRegex    = regexp.MustCompile(`(?:\[[0-9A-Fa-f:.]+\]|[A-Za-z0-9](?:[A-Za-z0-9.-]*[A-Za-z0-9])?):\d{2,5}\b`)
+	ipv4Regex        = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	hostAfterAtRegex = regexp.MustCompile(`@[A-Za-z0-9](?:[A-Za-z0-9.-]*[A-Za-z0-9])?`)
+	hostNameRegex    = regexp.MustCompile(`\b(?:[A-Za-z0-9-]+\.)+(?:com|net|org|io|dev|cloud|internal|local|localdomain|lan|corp|intranet)\b`)
+)
+
+// redactedHost replaces what redactDetails scrubs
+const redactedHost = "<host>"
+
+// redactDetails scrubs the host names, IP addresses and ports of the error
+// text details, and namespace too unless it is empty, so that reports can
+// be shared outside
+func redactDetails(details, namespace string) string {
+	if namespace != "" {
+		details = strings.ReplaceAll(details, namespace, "<namespace>")
+	}
+	details = hostPortRegex.ReplaceAllString(details, redactedHost)
+	details = ipv4Regex.ReplaceAllString(details, redactedHost)
+	details = hostAfterAtRegex.ReplaceAllString(details, "@"+redactedHost)
+	return hostNameRegex.ReplaceAllString(details, redactedHost)
+}
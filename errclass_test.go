@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// netErr is a minimal net.Error
+type netErr struct{ timeout bool }
+
+func (e netErr) Error() string   { return "connection reset by peer" }
+func (e netErr) Timeout() bool   { return e.timeout }
+func (e netErr) Temporary() bool { return false }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"deadline", fmt.Errorf("find: %w", context.DeadlineExceeded), ErrClassTimeout},
+		{"maxTimeMS", mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}, ErrClassTimeout},
+		{"network label", mongo.CommandError{Message: "socket closed", Labels: []string{"NetworkError"}}, ErrClassNetwork},
+		{"net.Error", fmt.Errorf("read: %w", netErr{}), ErrClassNetwork},
+		{"net.Error timeout", netErr{timeout: true}, ErrClassTimeout},
+		{"unauthorized", mongo.CommandError{Code: 13, Name: "Unauthorized"}, ErrClassAuth},
+		{"auth failed", mongo.CommandError{Code: 18, Name: "AuthenticationFailed"}, ErrClassAuth},
+		{"ns not found", mongo.CommandError{Code: 26, Name: "NamespaceNotFound"}, ErrClassNamespaceNotFound},
+		{"other command", mongo.CommandError{Code: 2, Name: "BadValue"}, ErrClassOther},
+		{"server selection", fmt.Errorf("find: %w", topology.ServerSelectionError{Wrapped: context.DeadlineExceeded}), ErrClassNetwork},
+		{"plain", errors.New("boom"), ErrClassOther},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("%s: classifyError(%v) = %s, want %s", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRedactDetails(t *testing.T) {
+	tests := []struct {
+		details, namespace, want string
+	}{
+		{"Source error: connection(mongo-0.mongo.svc.cluster.local:27017[-3]) incomplete read of message header: EOF", "",
+			"Source error: connection(<host>[-3]) incomplete read of message header: EOF"},
+		{"Dest error: dial tcp 10.1.2.3:27018: i/o timeout", "",
+			"Dest error: dial tcp <host>: i/o timeout"},
+		{"Dest error: lookup shard1.internal.example.com: no such host", "",
+			"Dest error: lookup <host>: no such host"},
+		{"Source error: server at localhost:27017 refused; ns app.users not found", "app.users",
+			"Source error: server at <host> refused; ns <namespace> not found"},
+		{"Source error: ns app.users not found", "", "Source error: ns app.users not found"},
+		// Namespaces of three or more parts are not host names
+		{"Dest error: ns metrics.http.requests not found", "", "Dest error: ns metrics.http.requests not found"},
+		{"Source error: auth failed for app@db-primary.prod", "", "Source error: auth failed for app@<host>"},
+	}
+	for _, tt := range tests {
+		if got := redactDetails(tt.details, tt.namespace); got != tt.want {
+			t.Errorf("redactDetails(%q, %q) = %q, want %q", tt.details, tt.namespace, got, tt.want)
+		}
+	}
+}
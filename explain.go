@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// explainer returns the query plan the server chooses for a find
+type explainer interface {
+	Explain(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error)
+}
+
+func (m mongoSource) Explain(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	cmd := bson.D{
+		{Key: "explain", Value: bson.D{{Key: "find", Value: col}, {Key: "filter", Value: filter}, {Key: "limit", Value: 1}}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}
+	return m.client.Database(db).RunCommand(ctx, cmd).Raw()
+}
+
+// queryPlan is the plan of the lookups of a namespace on one side
+type queryPlan struct {
+	Namespace string `json:"namespace"`
+	Side      string `json:"side"`
+	Stages    string `json:"stages"` // from the root down, e.g. "FETCH > IXSCAN"
+	CollScan  bool   `json:"collScan"`
+}
+
+// explainCheck explains the lookup of the first id of every namespace on
+// both sides, so that a lookup scanning the whole collection, for want of
+// an index on the lookup field, shows before it slows the run to a crawl
+type explainCheck struct {
+	src, dest explainer
+	seen      map[string]bool
+	plans     []queryPlan
+}
+
+func newExplainCheck(src, dest explainer) *explainCheck {
+	return &explainCheck{src: src, dest: dest, seen: make(map[string]bool)}
+}
+
+// check explains filter on namespace on first sight and logs the plans,
+// with a warning for a collection scan. A nil dest is not explained.
+func (ec *explainCheck) check(ctx context.Context, logger *log.Logger, namespace, db, col string, filter interface{}) {
+	if ec.seen[namespace] {
+		return
+	}
+	ec.seen[namespace] = true
+	for side, e := range []explainer{ec.src, ec.dest} {
+		if e == nil {
+			continue
+		}
+		name := [2]string{"source", "dest"}[side]
+		explain, err := e.Explain(ctx, db, col, filter)
+		if err != nil {
+			logger.Printf("Cannot explain the lookups of %s on %s: %v", namespace, name, err)
+			continue
+		}
+		stages := planStages(explain)
+		plan := queryPlan{Namespace: namespace, Side: name, Stages: strings.Join(stages, " > ")}
+		for _, s := range stages {
+			plan.CollScan = plan.CollScan || s == "COLLSCAN"
+		}
+		ec.plans = append(ec.plans, plan)
+		if plan.CollScan {
+			logger.Printf("WARNING: lookups of %s on %s scan the whole collection (%s); is the lookup field indexed?", namespace, name, plan.Stages)
+		} else {
+			logger.Printf("Lookups of %s on %s: %s", namespace, name, plan.Stages)
+		}
+	}
+}
+
+// planStages returns the stages of the winning plan of an explain output,
+// from the root down. The plans of the shards of a sharded cluster, and
+// the slot-based queryPlan of newer servers, are walked too.
+func planStages(explain bson.Raw) []string {
+	var stages []string
+	var walk func(plan bson.Raw)
+	walk = func(plan bson.Raw) {
+		if stage, ok := plan.Lookup("stage").StringValueOK(); ok {
+			stages = append(stages, stage)
+		}
+		for _, key := range []string{"queryPlan", "inputStage", "winningPlan"} {
+			if child, ok := plan.Lookup(key).DocumentOK(); ok {
+				walk(child)
+			}
+		}
+		for _, key := range []string{"inputStages", "shards"} {
+			children, ok := plan.Lookup(key).ArrayOK()
+			if !ok {
+				continue
+			}
+			values, _ := children.Values()
+			for _, v := range values {
+				if child, ok := v.DocumentOK(); ok {
+					walk(child)
+				}
+			}
+		}
+	}
+	if plan, ok := explain.Lookup("queryPlanner", "winningPlan").DocumentOK(); ok {
+		walk(plan)
+	}
+	return stages
+}
+
+func printQueryPlans(w io.Writer, plans []queryPlan) {
+	if len(plans) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Query Plans ===")
+	for _, p := range plans {
+		warning := ""
+		if p.CollScan {
+			warning = " (WARNING: collection scan)"
+		}
+		fmt.Fprintf(w, "%s on %s: %s%s\n", p.Namespace, p.Side, p.Stages, warning)
+	}
+}
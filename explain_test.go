@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeExplainer records the explained finds and answers with a canned
+// winning plan per namespace
+type fakeExplainer struct {
+	plans     map[string]bson.D
+	explained []string
+	filters   []interface{}
+}
+
+func (fe *fakeExplainer) Explain(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	fe.explained = append(fe.explained, db+"."+col)
+	fe.filters = append(fe.filters, filter)
+	return bson.Marshal(bson.D{{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: fe.plans[db+"."+col]}}}})
+}
+
+func TestExplain(t *testing.T) {
+	idhack := bson.D{{Key: "stage", Value: "IDHACK"}}
+	collscan := bson.D{{Key: "stage", Value: "COLLSCAN"}}
+	src := &fakeExplainer{plans: map[string]bson.D{"db.a": idhack, "db.b": idhack}}
+	dest := &fakeExplainer{plans: map[string]bson.D{"db.a": idhack, "db.b": collscan}}
+
+	docs := newFakeSource()
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	var lines []string
+	for i, ns := range []string{"db.a", "db.b", "db.a"} {
+		docs.insert(ns, bson.D{{Key: "_id", Value: ids[i]}})
+		lines = append(lines, logLine(ns, ids[i]))
+	}
+	c := NewChecker(docs, docs)
+	c.Explain = newExplainCheck(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// Once per namespace and side, with the lookup of the first id
+	for _, e := range []*fakeExplainer{src, dest} {
+		if want := []string{"db.a", "db.b"}; !reflect.DeepEqual(e.explained, want) {
+			t.Errorf("explained %v, want %v", e.explained, want)
+		}
+		if want := (bson.M{"_id": ids[0]}); !reflect.DeepEqual(e.filters[0], want) {
+			t.Errorf("explained filter %v, want %v", e.filters[0], want)
+		}
+	}
+	plans := c.QueryPlans()
+	if len(plans) != 4 || plans[3].Namespace != "db.b" || plans[3].Side != "dest" || !plans[3].CollScan || plans[2].CollScan {
+		t.Fatalf("plans %+v, want a collection scan on db.b dest alone", plans)
+	}
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "db.b on dest: COLLSCAN (WARNING: collection scan)") {
+		t.Errorf("report does not warn of the collection scan:\n%s", out.String())
+	}
+}
+
+func TestPlanStages(t *testing.T) {
+	fetch := bson.D{{Key: "stage", Value: "FETCH"}, {Key: "inputStage", Value: bson.D{{Key: "stage", Value: "IXSCAN"}}}}
+	sharded := bson.D{{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: bson.D{
+		{Key: "stage", Value: "SINGLE_SHARD"},
+		{Key: "shards", Value: bson.A{bson.D{{Key: "winningPlan", Value: bson.D{{Key: "queryPlan", Value: fetch}}}}}},
+	}}}}}
+	explain, err := bson.Marshal(sharded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := planStages(explain), []string{"SINGLE_SHARD", "FETCH", "IXSCAN"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("planStages = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Regex for extraction
+// Pattern for sample: collection: testshard.col2 ... id="{"$oid":"693885e2f227ce8067db8d33"}"
+// We need to be careful about the quoting in the CSV message field.
+// The CSV reader handles the outer quotes. inside message:
+// val="... collection: <ns> ... id=""<json>"" ..."
+// Some exports mangle the quotes around the id into curly quotes, as in
+// `id=“{\""$oid...`, or into their mojibake (â€œ); normalizeQuotes turns
+// them back into ASCII before the id is extracted.
+var nsRegex = regexp.MustCompile(`collection:\s*([a-zA-Z0-9_.]+)`)
+
+// extractNamespace returns the namespace of message: the first
+// "collection: <ns>" it contains or, when that misses or is cut short by a
+// character nsRegex does not accept, the collection of its E11000 error.
+func extractNamespace(message string) (string, bool) {
+	if m := nsRegex.FindStringSubmatchIndex(message); m != nil {
+		ns, rest := message[m[2]:m[3]], message[m[3]:]
+		if validNamespace(ns) && (rest == "" || strings.ContainsAny(rest[:1], " \t\"\\,;]")) {
+			return ns, true
+		}
+	}
+	return extractE11000Namespace(message)
+}
+
+// bareCollectionRegex matches a "collection: <name>" naming a collection
+// without its database, as older logs do
+var bareCollectionRegex = regexp.MustCompile(`collection:\s*"?([a-zA-Z0-9_-]+)"?(?:[\s,;\]]|$)`)
+
+// bareCollectionFormat is a collection name without a database
+var bareCollectionFormat = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// extractBareCollection returns the collection of a "collection: <name>"
+// of message without a database
+func extractBareCollection(message string) (string, bool) {
+	if m := bareCollectionRegex.FindStringSubmatch(message); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// loadCollectionDBs reads a -collection-db-map file: one collection,db pair
+// per line, blank lines and lines starting with # ignored
+func loadCollectionDBs(r io.Reader) (map[string]string, error) {
+	dbs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		col, db, ok := strings.Cut(line, ",")
+		col, db = strings.TrimSpace(col), strings.TrimSpace(db)
+		if !ok || col == "" || strings.Contains(db, ".") || !validNamespace(db+"."+col) {
+			return nil, fmt.Errorf("line %d: %q is not a collection,db pair", lineNum, line)
+		}
+		if prev, ok := dbs[col]; ok && prev != db {
+			return nil, fmt.Errorf("line %d: collection %s mapped to both %s and %s", lineNum, col, prev, db)
+		}
+		dbs[col] = db
+	}
+	return dbs, scanner.Err()
+}
+
+// E11000 errors name the collection in a "collection: <ns> index: ..."
+// clause, with the namespace possibly quoted. Servers before 3.0 wrote
+// "index: <ns>.$<index>" instead.
+var (
+	e11000CollectionRegex = regexp.MustCompile(`collection:\s*"?([^\s"\]]+?)"?[,;\]]?(?:\s|$)`)
+	e11000IndexRegex      = regexp.MustCompile(`^\s*index:\s*"?([^\s"]+?)\.\$`)
+)
+
+// extractE11000Namespace returns the namespace of the duplicate key error
+// in message
+func extractE11000Namespace(message string) (string, bool) {
+	i := strings.Index(message, "E11000")
+	if i < 0 {
+		return "", false
+	}
+	clause := strings.ReplaceAll(message[i:], `\"`, `"`)
+	if rest, ok := strings.CutPrefix(clause, "E11000 duplicate key error"); ok {
+		if m := e11000IndexRegex.FindStringSubmatch(rest); m != nil && validNamespace(m[1]) {
+			return m[1], true
+		}
+	}
+	if m := e11000CollectionRegex.FindStringSubmatch(clause); m != nil && validNamespace(m[1]) {
+		return m[1], true
+	}
+	return "", false
+}
+
+// quoteNormalizer maps Unicode double quotes, and the mojibake left by
+// decoding the UTF-8 curly quotes as Windows-1252, to ASCII quotes
+var quoteNormalizer = strings.NewReplacer(
+	"â€œ", `"`, "â€\u009d", `"`, "â€ž", `"`, // mojibake of “ ” „
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u201f", `"`,
+	"\u2033", `"`, "\u301d", `"`, "\u301e", `"`, "\uff02", `"`,
+)
+
+// normalizeQuotes replaces the Unicode double quotes of message by ASCII ones
+func normalizeQuotes(message string) string {
+	if isASCII(message) {
+		return message
+	}
+	return quoteNormalizer.Replace(message)
+}
+
+// isASCII reports whether s is plain ASCII
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// The id is logged as id="{...}" with Extended JSON inside. The CSV reader
+// resolves the doubled quotes, so in memory it looks like id="{"$oid":"69..."}",
+// or id="{\"$oid\":\"69...\"}" when the log also backslash-escaped them.
+// A compound _id may also be logged as an array, id="["tenant-1", 42]".
+// idStartRegex finds the opening brace or bracket; extractIDJSON scans for
+// the matching closing one, since a regex cannot tell inner quotes from the
+// closing one.
+var idStartRegex = regexp.MustCompile(`(?:^|[^\w$])id="?[{\[]`)
+
+// extractIDJSON returns the Extended JSON id logged in message, with
+// backslash-escaped quotes resolved. Braces inside string values are ignored.
+func extractIDJSON(message string) (string, bool) {
+	loc := idStartRegex.FindStringIndex(message)
+	if loc == nil {
+		return "", false
+	}
+	return balancedJSON(unescapeLogged(message[loc[1]-1:]))
+}
+
+// loggedUnescaper resolves the escapes of a value the log backslash-escaped
+// as a whole. Each escape is resolved once, left to right, so that \\\"
+// becomes \", an escaped quote inside a JSON string.
+var loggedUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+
+// unescapeLogged resolves the backslash escapes some logs add to a whole
+// value, its quotes as \" and its backslashes as \\. Such text is told by
+// its first quote being escaped; other text is returned as is, leaving the
+// escapes inside its JSON strings to the JSON parser.
+func unescapeLogged(text string) string {
+	q := strings.IndexByte(text, '"')
+	if q <= 0 || text[q-1] != '\\' {
+		return text
+	}
+	return loggedUnescaper.Replace(text)
+}
+
+// balancedJSON returns the JSON object or array text starts with, up to its
+// matching closing brace or bracket. Those inside string values are ignored.
+func balancedJSON(text string) (string, bool) {
+	depth := 0
+	inString := false
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; {
+		case inString && ch == '\\':
+			i++ // skip the escaped character
+		case ch == '"':
+			inString = !inString
+		case inString:
+		case ch == '{' || ch == '[':
+			depth++
+		case ch == '}' || ch == ']':
+			depth--
+			if depth == 0 {
+				return text[:i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// timestampLayouts are the date formats recognized in the first column of a log
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// looksLikeTimestamp reports whether s is a date, as in the first column of
+// a data row
+func looksLikeTimestamp(s string) bool {
+	_, ok := parseTimestamp(s)
+	return ok
+}
+
+// parseTimestamp parses the date in the first column of a data row. Dates
+// without a zone are taken as UTC.
+func parseTimestamp(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// retryFailedMarker marks the log lines of the writes that failed for good,
+// the only lines checked by default. Its casing varies between log variants.
+const retryFailedMarker = "Isolated retry still failed"
+
+// newLineFilter compiles the filter selecting the messages that are checked:
+// pattern, honoring its own flags such as (?i) and (?s), or by default the
+// retry-failure marker, matched in any case unless caseSensitive is set
+func newLineFilter(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	if pattern != "" {
+		return regexp.Compile(pattern)
+	}
+	pattern = regexp.QuoteMeta(retryFailedMarker)
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// selected reports whether message is one of the failures to check
+func (c *Checker) selected(message string) bool {
+	return c.LineFilter.MatchString(message)
+}
+
+// defaultAttemptPattern matches retry counters such as attempt=3, retries: 2 or retryCount=1.
+// The first capture group must be the number.
+const defaultAttemptPattern = `(?i)\b(?:attempts?|retries|retry_?count)[=:]\s*(\d+)`
+
+// extractAttempt returns the retry attempt number logged in message, if any
+func extractAttempt(re *regexp.Regexp, message string) (int, bool) {
+	m := re.FindStringSubmatch(message)
+	if len(m) < 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// defaultCategoryPatterns classify why a write failed. The first pattern that
+// matches wins and its first capture group is the category.
+var defaultCategoryPatterns = []string{
+	`\b(E\d{4,5})\b`,
+	`(?i)(bulk write exception|write conflict|document failed validation|timed out|not primary)`,
+}
+
+// uncategorized is the category of messages no pattern matches
+const uncategorized = "uncategorized"
+
+// extractCategory returns the error category of message
+func extractCategory(patterns []*regexp.Regexp, message string) string {
+	for _, re := range patterns {
+		if m := re.FindStringSubmatch(message); len(m) >= 2 {
+			return m[1]
+		}
+	}
+	return uncategorized
+}
+
+// compilePatterns compiles every regex in patterns
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// parseID parses the Extended JSON id captured from a log message. Logs
+// emit relaxed and canonical, v1 and v2 Extended JSON, and sometimes mongo
+// shell syntax such as ObjectId("..."), so each dialect is tried in turn.
+func parseID(idJSON string) (interface{}, error) {
+	// The CSV reader resolves doubled quotes, but some logs also escape them
+	// with backslashes
+	idJSONClean := unescapeLogged(idJSON)
+
+	var firstErr error
+	for _, canonical := range []bool{false, true} {
+		id, err := unmarshalExtJSONValue(idJSONClean, canonical)
+		if err == nil {
+			return id, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if shell := shellToExtJSON(idJSONClean); shell != idJSONClean {
+		if id, err := unmarshalExtJSONValue(shell, false); err == nil {
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to parse ID JSON '%s' (cleaned: '%s'): %w", idJSON, idJSONClean, firstErr)
+}
+
+// unmarshalExtJSONValue parses a single Extended JSON value, which need not
+// be a document
+func unmarshalExtJSONValue(value string, canonical bool) (interface{}, error) {
+	var wrapper bson.D
+	if err := bson.UnmarshalExtJSON([]byte(`{"v":`+value+`}`), canonical, &wrapper); err != nil {
+		return nil, err
+	}
+	if len(wrapper) != 1 {
+		return nil, fmt.Errorf("expected a single value")
+	}
+	return wrapper[0].Value, nil
+}
+
+// shellConstructors rewrite mongo shell constructors into Extended JSON
+// ($$ is a literal $ in a replacement). The number constructors accept their
+// argument quoted or not.
+var shellConstructors = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`ObjectId\(\s*"([0-9a-fA-F]{24})"\s*\)`), `{"$$oid":"${1}"}`},
+	{regexp.MustCompile(`NumberLong\(\s*"?(-?\d+)"?\s*\)`), `{"$$numberLong":"${1}"}`},
+	{regexp.MustCompile(`NumberInt\(\s*"?(-?\d+)"?\s*\)`), `{"$$numberInt":"${1}"}`},
+	{regexp.MustCompile(`NumberDecimal\(\s*"([^"]*)"\s*\)`), `{"$$numberDecimal":"${1}"}`},
+	{regexp.MustCompile(`(?:ISODate|new Date)\(\s*"([^"]*)"\s*\)`), `{"$$date":"${1}"}`},
+	{regexp.MustCompile(`UUID\(\s*"([^"]*)"\s*\)`), `{"$$uuid":"${1}"}`},
+}
+
+// binDataRegex matches the shell's BinData(subtype, "base64"), whose subtype
+// is decimal while Extended JSON expects hex
+var binDataRegex = regexp.MustCompile(`BinData\(\s*(\d+)\s*,\s*"([^"]*)"\s*\)`)
+
+// shellToExtJSON rewrites the shell constructors in s into Extended JSON
+func shellToExtJSON(s string) string {
+	for _, c := range shellConstructors {
+		s = c.re.ReplaceAllString(s, c.repl)
+	}
+	return binDataRegex.ReplaceAllStringFunc(s, func(m string) string {
+		sub := binDataRegex.FindStringSubmatch(m)
+		subtype, err := strconv.ParseUint(sub[1], 10, 8)
+		if err != nil {
+			return m
+		}
+		return fmt.Sprintf(`{"$binary":{"base64":"%s","subType":"%02x"}}`, sub[2], subtype)
+	})
+}
+
+// parseIDArg parses an id given on the command line: either a bare ObjectID hex
+// string or the same Extended JSON form found in the logs.
+func parseIDArg(arg string) (interface{}, error) {
+	if primitive.IsValidObjectID(arg) {
+		return primitive.ObjectIDFromHex(arg)
+	}
+	return parseID(arg)
+}
+
+// coerceID returns the alternate form of an id whose type may have been
+// changed by a migration: an ObjectID becomes its hex string and a 24 digit
+// hex string becomes an ObjectID.
+func coerceID(id interface{}) (interface{}, bool) {
+	switch v := id.(type) {
+	case primitive.ObjectID:
+		return v.Hex(), true
+	case string:
+		if oid, err := primitive.ObjectIDFromHex(v); err == nil {
+			return oid, true
+		}
+	}
+	return nil, false
+}
+
+// idTypeName names the BSON type of an id for reports
+func idTypeName(id interface{}) string {
+	switch id.(type) {
+	case primitive.ObjectID:
+		return "ObjectID"
+	case string:
+		return "string"
+	case bson.A:
+		return "array"
+	}
+	return fmt.Sprintf("%T", id)
+}
+
+// namespaceFormat is the db.collection form of a namespace. Database names
+// cannot contain dots but collection names can, as in metrics.http.requests.
+var namespaceFormat = regexp.MustCompile(`^[^.\s$/\\"]+\.[^\s$]+$`)
+
+// validNamespace reports whether s has the db.collection form
+func validNamespace(s string) bool {
+	return namespaceFormat.MatchString(s)
+}
+
+// splitNamespace splits "db.collection" into its database and collection
+// names at the first dot, since only the collection name may contain dots:
+// metrics.http.requests is collection http.requests of database metrics.
+func splitNamespace(namespace string) (string, string, error) {
+	db, col, ok := strings.Cut(namespace, ".")
+	if !ok || db == "" || col == "" {
+		return "", "", fmt.Errorf("invalid namespace %s", namespace)
+	}
+	return db, col, nil
+}
+
+// Extract writes the namespace and id of every retry-failure line of the log
+// in r to w, one "namespace,id" pair per line in the format read by -ids-file.
+// Nothing is looked up.
+func (c *Checker) Extract(r io.Reader, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := c.readLog(r, func(lineNum int, record []string) {
+		message, ok := c.messageOf(lineNum, record)
+		if !ok || !c.selected(message) {
+			return
+		}
+		namespace, ok := c.namespaceOf(lineNum, record, message)
+		if !ok {
+			return
+		}
+		id, err := c.extractID(message)
+		if err != nil {
+			if !errors.Is(err, errNoID) {
+				c.Logger.Printf("Line %d: %v", lineNum, err)
+			}
+			return
+		}
+		fmt.Fprintf(bw, "%s,%s\n", namespace, extJSONValue(id))
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExtractAttempt(t *testing.T) {
+	re := regexp.MustCompile(defaultAttemptPattern)
+	tests := []struct {
+		msg  string
+		want int
+		ok   bool
+	}{
+		{`ERR Isolated retry still failed attempt=3 retryErr="bulk write exception" id="{}"`, 3, true},
+		{`ERR Isolated retry still failed retries: 12 err="..."`, 12, true},
+		{`ERR Isolated retry still failed retryCount=1`, 1, true},
+		{`ERR Isolated retry still failed retryErr="bulk write exception" index=0`, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := extractAttempt(re, tt.msg)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("extractAttempt(%q) = %d, %v; want %d, %v", tt.msg, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExtractCategory(t *testing.T) {
+	patterns, err := compilePatterns(defaultCategoryPatterns)
+	if err != nil {
+		t.Fatalf("compilePatterns: %v", err)
+	}
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{`ERR Isolated retry still failed retryErr="bulk write exception: write errors: [E11000 duplicate key error collection: testshard.col2 index: _id_ dup key]"`, "E11000"},
+		{`ERR Isolated retry still failed retryErr="bulk write exception: write errors: []"`, "bulk write exception"},
+		{`ERR Isolated retry still failed retryErr="something else"`, uncategorized},
+	}
+	for _, tt := range tests {
+		if got := extractCategory(patterns, tt.msg); got != tt.want {
+			t.Errorf("extractCategory(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestExtractIDJSON(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+		ok   bool
+	}{
+		{`ERR Isolated retry still failed index=0 id="{"$oid":"693885e2f227ce8067db8d33"}" key=1`,
+			`{"$oid":"693885e2f227ce8067db8d33"}`, true},
+		{`ERR Isolated retry still failed index=0 id="{\"$oid\":\"693885e2f227ce8067db8d33\"}" key=1`,
+			`{"$oid":"693885e2f227ce8067db8d33"}`, true},
+		// Several nested quoted values, and braces and quotes inside strings
+		{`ERR retryErr="x" id="{"a":{"b":"c}","d":"{e"},"g":"h"}" err="{bad}"`,
+			`{"a":{"b":"c}","d":"{e"},"g":"h"}`, true},
+		{`ERR retryErr="x" id="{\"a\":{\"b\":\"c}\"},\"g\":\"h\"}" err="{bad}"`,
+			`{"a":{"b":"c}"},"g":"h"}`, true},
+		// A quote inside a string _id, escaped for JSON, and again with
+		// the whole id escaped by the log
+		{`ERR id={"k":"a\"b"} key=1`, `{"k":"a\"b"}`, true},
+		{`ERR id="{\"k\":\"a\\\"b\"}" key=1`, `{"k":"a\"b"}`, true},
+		{`ERR oid="{"x":1}" id={"$oid":"693885e2f227ce8067db8d33"} key=1`,
+			`{"$oid":"693885e2f227ce8067db8d33"}`, true},
+		{`ERR Isolated retry still failed id="{"$oid":"6938`, "", false},
+		{`ERR Isolated retry still failed index=0`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := extractIDJSON(tt.msg)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("extractIDJSON(%q) = %q, %v; want %q, %v", tt.msg, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseIDDialects(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("693885e2f227ce8067db8d33")
+	date := primitive.NewDateTimeFromTime(time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC))
+	uuid := primitive.Binary{Subtype: 4, Data: []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}}
+	tests := []struct {
+		name string
+		in   string
+		want interface{}
+	}{
+		{"v2 ObjectId", `{"$oid":"693885e2f227ce8067db8d33"}`, oid},
+		{"v2 escaped quotes", `{\"$oid\":\"693885e2f227ce8067db8d33\"}`, oid},
+		{"v2 quote in string", `{"k":"a\"b"}`, bson.D{{Key: "k", Value: `a"b`}}},
+		{"v2 escaped quote in string", `{\"k\":\"a\\\"b\"}`, bson.D{{Key: "k", Value: `a"b`}}},
+		{"v2 relaxed int", `42`, int32(42)},
+		{"v2 canonical int", `{"$numberInt":"42"}`, int32(42)},
+		{"v2 canonical long", `{"$numberLong":"42"}`, int64(42)},
+		{"v2 relaxed string", `"abc"`, "abc"},
+		{"v2 relaxed date", `{"$date":"2023-11-14T22:13:20Z"}`, date},
+		{"v2 canonical date", `{"$date":{"$numberLong":"1700000000000"}}`, date},
+		{"v2 canonical binary", `{"$binary":{"base64":"ABEiM0RVZneImaq7zN3u/w==","subType":"04"}}`, uuid},
+		{"v2 uuid", `{"$uuid":"00112233-4455-6677-8899-aabbccddeeff"}`, uuid},
+		{"v2 compound", `{"a":1,"b":"x"}`, bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: "x"}}},
+		{"v1 date", `{"$date":1700000000000}`, date},
+		{"v1 binary", `{"$binary":"ABEiM0RVZneImaq7zN3u/w==","$type":"04"}`, uuid},
+		{"shell ObjectId", `ObjectId("693885e2f227ce8067db8d33")`, oid},
+		{"shell NumberLong", `NumberLong(42)`, int64(42)},
+		{"shell quoted NumberLong", `NumberLong("42")`, int64(42)},
+		{"shell NumberInt", `NumberInt(42)`, int32(42)},
+		{"shell ISODate", `ISODate("2023-11-14T22:13:20Z")`, date},
+		{"shell UUID", `UUID("00112233-4455-6677-8899-aabbccddeeff")`, uuid},
+		{"shell BinData", `BinData(4,"ABEiM0RVZneImaq7zN3u/w==")`, uuid},
+		{"shell BinData user subtype", `BinData(128,"AAE=")`, primitive.Binary{Subtype: 0x80, Data: []byte{0, 1}}},
+		{"shell compound", `{"a":ObjectId("693885e2f227ce8067db8d33"),"n":NumberLong(7)}`, bson.D{{Key: "a", Value: oid}, {Key: "n", Value: int64(7)}}},
+	}
+	for _, tt := range tests {
+		got, err := parseID(tt.in)
+		if err != nil {
+			t.Errorf("%s: parseID(%s): %v", tt.name, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseID(%s) = %#v, want %#v", tt.name, tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{`{"$oid":"6938`, `ObjectId(1)`, `not json`} {
+		if _, err := parseID(in); err == nil {
+			t.Errorf("parseID(%s) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestExtractNamespace(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string // "" when no namespace is found
+	}{
+		{"plain", `ERR Isolated retry still failed retryErr="write errors: [E11000 duplicate key error collection: testshard.col2 index: _id_ dup key: { _id: 1 }]" id="{}"`, "testshard.col2"},
+		{"index right after", `E11000 duplicate key error collection: db.col index: a_1 dup key: { a: 1 }`, "db.col"},
+		{"no space after colon", `E11000 duplicate key error collection:db.col index: _id_`, "db.col"},
+		{"end of write errors", `write errors: [E11000 duplicate key error collection: db.col2]`, "db.col2"},
+		{"hyphenated collection", `E11000 duplicate key error collection: db.order-items index: _id_ dup key`, "db.order-items"},
+		{"quoted collection", `E11000 duplicate key error collection: "db.col" index: _id_`, "db.col"},
+		{"escaped quotes", `retryErr="E11000 duplicate key error collection: \"db.my-col\" index: _id_"`, "db.my-col"},
+		{"dotted collection", `E11000 duplicate key error collection: db.a.b-c index: _id_`, "db.a.b-c"},
+		{"dotted collection clause", `ERR Isolated retry still failed collection: metrics.http.requests id="{}"`, "metrics.http.requests"},
+		{"dotted collection in E11000", `E11000 duplicate key error collection: metrics.http.requests index: _id_ dup key`, "metrics.http.requests"},
+		{"dotted collection quoted", `retryErr="E11000 duplicate key error collection: \"metrics.http.requests\" index: _id_"`, "metrics.http.requests"},
+		{"pre-3.0 index form", `E11000 duplicate key error index: db.col.$_id_ dup key: { : 1 }`, "db.col"},
+		{"pre-3.0 dotted", `E11000 duplicate key error index: db.a-b.c.$name_1 dup key`, "db.a-b.c"},
+		{"no E11000", `ERR Isolated retry still failed timeout`, ""},
+		{"E11000 without namespace", `E11000 duplicate key error dup key: { _id: 1 }`, ""},
+	}
+	for _, tt := range tests {
+		got, ok := extractNamespace(tt.msg)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: extractNamespace(%q) = %q, %v; want %q", tt.name, tt.msg, got, ok, tt.want)
+		}
+	}
+}
+
+func TestDottedCollection(t *testing.T) {
+	tests := []struct {
+		ns, db, col string
+	}{
+		{"db.col", "db", "col"},
+		{"metrics.http.requests", "metrics", "http.requests"},
+		{"db.a.b.c", "db", "a.b.c"},
+	}
+	for _, tt := range tests {
+		db, col, err := splitNamespace(tt.ns)
+		if err != nil || db != tt.db || col != tt.col {
+			t.Errorf("splitNamespace(%q) = %q, %q, %v; want %q, %q", tt.ns, db, col, err, tt.db, tt.col)
+		}
+	}
+	for _, ns := range []string{"db", ".col", "db.", ""} {
+		if _, _, err := splitNamespace(ns); err == nil {
+			t.Errorf("splitNamespace(%q) succeeded, want an error", ns)
+		}
+	}
+
+	// The whole dotted name is looked up, and reported, as the collection
+	oid := primitive.NewObjectID()
+	src, dest := newFakeSource(), newFakeSource()
+	src.insert("metrics.http.requests", bson.D{{Key: "_id", Value: oid}})
+	c := NewChecker(src, dest)
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("metrics.http.requests", oid)))); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.StatsMap["metrics.http.requests"]; s == nil || s.MissingInDest != 1 {
+		t.Errorf("stats = %v, want one MissingInDest under metrics.http.requests", c.StatsMap)
+	}
+}
+
+func TestCurlyQuotedID(t *testing.T) {
+	oid := primitive.NewObjectID()
+	lines := []string{
+		// Curly quotes around the id and its keys
+		`2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed collection: db.col id=“{“$oid”:“` + oid.Hex() + `”}” key=1"`,
+		// The same, decoded as Windows-1252 along the way
+		`2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed collection: db.col id=â€œ{â€œ$oidâ€` + "\u009d" + `:â€œ` + oid.Hex() + `â€` + "\u009d" + `}â€` + "\u009d" + ` key=1"`,
+		// Fullwidth quotes inside CSV-doubled ASCII ones
+		`2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed collection: db.col id=""{＂$oid＂:＂` + oid.Hex() + `＂}"" key=1"`,
+	}
+	var out strings.Builder
+	c := NewChecker(nil, nil)
+	if err := c.Extract(strings.NewReader(logFile(lines...)), &out); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := strings.Repeat(`db.col,{"$oid":"`+oid.Hex()+`"}`+"\n", len(lines))
+	if out.String() != want {
+		t.Errorf("Extract = %q, want %q", out.String(), want)
+	}
+
+	if got := normalizeQuotes(`plain "ascii"`); got != `plain "ascii"` {
+		t.Errorf("ASCII message changed: %q", got)
+	}
+}
+
+func TestArrayID(t *testing.T) {
+	line := `2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed collection: db.col id=""[""tenant-1"", 42]"" key=1"`
+	want := bson.A{"tenant-1", int32(42)}
+	var extracted []interface{}
+	c := NewChecker(nil, nil)
+	err := c.readLog(strings.NewReader(logFile(line)), func(lineNum int, record []string) {
+		id, err := c.extractID(record[3])
+		if err != nil {
+			t.Fatalf("extractID: %v", err)
+		}
+		extracted = append(extracted, id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extracted) != 1 || !reflect.DeepEqual(extracted[0], want) {
+		t.Fatalf("extracted %#v, want %#v", extracted, want)
+	}
+
+	// The array is looked up as the id value and compared like any other id
+	src, dest := newFakeSource(), newFakeSource()
+	src.insert("db.col", bson.D{{Key: "_id", Value: want}, {Key: "v", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: want}, {Key: "v", Value: 2}})
+	c = NewChecker(src, dest)
+	res := c.checkDoc(context.Background(), "db", "col", extracted[0])
+	if res.Status != StatusMismatch {
+		t.Errorf("status %s, want %s", res.Status, StatusMismatch)
+	}
+	if got := formatID(res.ID); got != `["tenant-1",42]` {
+		t.Errorf("formatID = %s, want the array as JSON", got)
+	}
+	if got := idTypeName(res.ID); got != "array" {
+		t.Errorf("idTypeName = %s, want array", got)
+	}
+}
+
+func TestLineFilter(t *testing.T) {
+	tests := []struct {
+		pattern       string
+		caseSensitive bool
+		msg           string
+		want          bool
+	}{
+		{"", false, "ERR Isolated retry still failed id=1", true},
+		{"", false, "ERR isolated retry still failed id=1", true},
+		{"", false, "ERR Isolated Retry Still Failed id=1", true},
+		{"", false, "ERR retry failed id=1", false},
+		{"", true, "ERR Isolated retry still failed id=1", true},
+		{"", true, "ERR isolated retry still failed id=1", false},
+		// A custom pattern honors its own flags
+		{`retry.still`, false, "ERR Isolated Retry Still failed", false},
+		{`(?i)retry.still`, false, "ERR Isolated Retry Still failed", true},
+		{`(?i)retry.still`, false, "ERR Isolated retry\nstill failed", false},
+		{`(?is)retry.still`, false, "ERR Isolated retry\nstill failed", true},
+	}
+	for _, tt := range tests {
+		re, err := newLineFilter(tt.pattern, tt.caseSensitive)
+		if err != nil {
+			t.Fatalf("newLineFilter(%q, %v): %v", tt.pattern, tt.caseSensitive, err)
+		}
+		if got := re.MatchString(tt.msg); got != tt.want {
+			t.Errorf("filter %q (case-sensitive %v) on %q = %v, want %v", tt.pattern, tt.caseSensitive, tt.msg, got, tt.want)
+		}
+	}
+
+	// Lines differing only in the casing of the marker are all checked
+	oid := primitive.NewObjectID()
+	lines := []string{
+		logLine("db.col", oid),
+		strings.Replace(logLine("db.col", oid), "Isolated retry", "isolated retry", 1),
+		strings.Replace(logLine("db.col", oid), "Isolated retry", "ISOLATED RETRY", 1),
+	}
+	src, dest := newFakeSource(), newFakeSource()
+	c := NewChecker(src, dest)
+	c.DedupCacheSize = 0
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.StatsMap["db.col"].TotalChecks; got != 3 {
+		t.Errorf("%d mixed-case lines checked, want 3", got)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// idScanner lists the _id of every document of a collection
+type idScanner interface {
+	// ScanIDs calls fn with each _id of db.col, streaming them with a
+	// cursor, and stops at the first error fn returns
+	ScanIDs(ctx context.Context, db, col string, fn func(id interface{}) error) error
+}
+
+// scanBatchSize is the number of _ids fetched per cursor batch
+const scanBatchSize = 1000
+
+// ScanIDs streams the _ids of db.col in natural order, which the $natural
+// hint pins whatever plan the server would otherwise pick. The scan is not
+// bounded by maxTime, which would cap the lifetime of the whole cursor.
+func (m mongoSource) ScanIDs(ctx context.Context, db, col string, fn func(id interface{}) error) error {
+	if m.session != nil {
+		ctx = mongo.NewSessionContext(ctx, m.session)
+	}
+	opts := options.Find().
+		SetProjection(bson.D{{Key: "_id", Value: 1}}).
+		SetHint(bson.D{{Key: "$natural", Value: 1}}).
+		SetBatchSize(scanBatchSize)
+	cur, err := m.client.Database(db).Collection(col).Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var doc struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc.ID); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// errScanStopped ends a scan early, when the run stops or reaches MaxLines
+var errScanStopped = errors.New("scan stopped")
+
+// RunFullScan reconciles the whole namespace instead of the logged ids: it
+// checks every _id of the source collection against dest, through the worker
+// pool and pacing like logged ids. With destScan set, it then lists the dest
+// _ids too and checks those absent from the source, which the first pass
+// cannot see. MaxLines caps the number of documents scanned.
+func (c *Checker) RunFullScan(ctx context.Context, namespace string, srcScan, destScan idScanner) error {
+	ctx, span := c.Tracer.Start(ctx, "run")
+	defer span.End()
+	dbName, colName, err := splitNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	c.startPool(ctx)
+	defer c.drainPool(ctx)
+
+	n := 0
+	next := func() bool {
+		if c.StopReason != "" {
+			return false
+		}
+		if c.MaxLines > 0 && c.RowsRead >= c.MaxLines {
+			c.Truncated = true
+			return false
+		}
+		n++
+		c.RowsRead++
+		if c.Progress != nil {
+			c.Progress.Rows.Add(1)
+		}
+		return true
+	}
+
+	err = srcScan.ScanIDs(ctx, dbName, colName, func(id interface{}) error {
+		if !next() {
+			return errScanStopped
+		}
+		c.checkAndRecord(ctx, n, namespace, id)
+		return nil
+	})
+	if err != nil && err != errScanStopped {
+		return fmt.Errorf("source scan of %s: %w", namespace, err)
+	}
+	if destScan == nil || err == errScanStopped {
+		return nil
+	}
+
+	err = destScan.ScanIDs(ctx, dbName, colName, func(id interface{}) error {
+		// Documents present in the source were checked by the first pass
+		_, _, err := findDoc(ctx, c.Src, dbName, colName, "_id", id, nil)
+		if err == nil {
+			return nil
+		}
+		if !next() {
+			return errScanStopped
+		}
+		if err != mongo.ErrNoDocuments {
+			// Whether the source holds it is unknown: the id is reported as
+			// an Error, as a failed lookup of the first pass is
+			c.finishCheck(n, namespace, lookupError(id, "Source", err))
+			return nil
+		}
+		c.checkAndRecord(ctx, n, namespace, id)
+		return nil
+	})
+	if err != nil && err != errScanStopped {
+		return fmt.Errorf("dest scan of %s: %w", namespace, err)
+	}
+	return nil
+}
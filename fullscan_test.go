@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScanIDs lists the _ids of the fake collection in insertion order
+func (f *fakeSource) ScanIDs(ctx context.Context, db, col string, fn func(id interface{}) error) error {
+	for _, doc := range f.docs[db+"."+col] {
+		var d struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := bson.Unmarshal(doc, &d); err != nil {
+			return err
+		}
+		if err := fn(d.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRunFullScan(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, mismatch, onlySrc, onlyDest := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: match}, {Key: "v", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: match}, {Key: "v", Value: 1}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 2}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: onlySrc}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: onlyDest}})
+	// Another collection is left alone
+	src.insert("db.other", bson.D{{Key: "_id", Value: primitive.NewObjectID()}})
+
+	for _, workers := range []int{1, 3} {
+		c := NewChecker(src, dest)
+		c.Workers = workers
+		if err := c.RunFullScan(context.Background(), "db.col", src, nil); err != nil {
+			t.Fatalf("RunFullScan: %v", err)
+		}
+		s := c.StatsMap["db.col"]
+		if c.RowsRead != 3 || s.TotalChecks != 3 || s.Matches != 1 || s.Mismatches != 1 || s.MissingInDest != 1 || s.MissingInSource != 0 {
+			t.Errorf("%d workers, source scan: %d docs scanned, stats %+v", workers, c.RowsRead, s)
+		}
+		if len(c.StatsMap) != 1 {
+			t.Errorf("%d workers: namespaces %v, want only db.col", workers, c.StatsMap)
+		}
+	}
+
+	// The reverse scan adds the dest-only document, and only it
+	c := NewChecker(src, dest)
+	if err := c.RunFullScan(context.Background(), "db.col", src, dest); err != nil {
+		t.Fatalf("RunFullScan: %v", err)
+	}
+	s := c.StatsMap["db.col"]
+	if s.TotalChecks != 4 || s.MissingInSource != 1 || s.Matches != 1 || s.Duplicates != 0 {
+		t.Errorf("reverse scan: stats %+v, want 4 checks with 1 MissingInSource", s)
+	}
+
+	// A failed source lookup of the reverse scan is an Error, and the scan
+	// goes on
+	onlyDest2 := primitive.NewObjectID()
+	dest.insert("db.col", bson.D{{Key: "_id", Value: onlyDest2}})
+	c = NewChecker(&failingSource{docSource: src, ids: map[interface{}]bool{onlyDest: true}}, dest)
+	if err := c.RunFullScan(context.Background(), "db.col", src, dest); err != nil {
+		t.Fatalf("RunFullScan with a failing lookup: %v", err)
+	}
+	s = c.StatsMap["db.col"]
+	if s.TotalChecks != 5 || s.Errors != 1 || s.MissingInSource != 1 {
+		t.Errorf("reverse scan with a failing lookup: stats %+v, want 5 checks with 1 Error and 1 MissingInSource", s)
+	}
+
+	// MaxLines caps the documents scanned
+	c = NewChecker(src, dest)
+	c.MaxLines = 2
+	if err := c.RunFullScan(context.Background(), "db.col", src, dest); err != nil {
+		t.Fatalf("RunFullScan: %v", err)
+	}
+	if c.StatsMap["db.col"].TotalChecks != 2 || !c.Truncated {
+		t.Errorf("-max-lines 2: %d checks, truncated %v", c.StatsMap["db.col"].TotalChecks, c.Truncated)
+	}
+}
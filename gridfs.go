@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// parseGridFSBucket parses a -gridfs value, <db.bucket>, into the namespace
+// of the bucket's files collection, under which its files are logged
+func parseGridFSBucket(s string) (string, error) {
+	s = strings.TrimSuffix(s, ".files")
+	if !validNamespace(s) {
+		return "", fmt.Errorf("%q is not of the form <db.bucket>", s)
+	}
+	return s + ".files", nil
+}
+
+// chunkCount returns the number of chunks of the GridFS file described by
+// the files document doc: its length divided by its chunkSize, rounded up
+func chunkCount(doc bson.Raw) (int64, error) {
+	length, ok := doc.Lookup("length").AsInt64OK()
+	if !ok {
+		return 0, fmt.Errorf("files document has no numeric length")
+	}
+	size, ok := doc.Lookup("chunkSize").AsInt64OK()
+	if !ok || size <= 0 {
+		return 0, fmt.Errorf("files document has no positive chunkSize")
+	}
+	return (length + size - 1) / size, nil
+}
+
+// chunkHash returns the SHA-256 of the data of a chunk document
+func chunkHash(chunk bson.Raw) string {
+	sum := sha256.Sum256(chunk.Lookup("data").Value)
+	return hex.EncodeToString(sum[:])
+}
+
+// compareChunks compares the chunks of the GridFS file id, whose files
+// documents matched, in db.<bucket>.chunks: each chunk the files document
+// announces is hashed on both sides, and a chunk that differs or is missing,
+// or an extra one, makes the file a Mismatch
+func (c *Checker) compareChunks(ctx context.Context, db, col string, id interface{}, srcDoc bson.Raw, srcID, destID interface{}) CheckResult {
+	n, err := chunkCount(srcDoc)
+	if err != nil {
+		return CheckResult{ID: id, Status: StatusError, Details: fmt.Sprintf("GridFS file: %v", err)}
+	}
+	chunks := strings.TrimSuffix(col, ".files") + ".chunks"
+
+	var diffs []FieldDiff
+	for i := int64(0); i < n; i++ {
+		var hashes [2]string
+		for side, src := range []docSource{c.Src, c.Dest} {
+			fileID := [2]interface{}{srcID, destID}[side]
+			chunk, err := src.FindOne(ctx, db, chunks, bson.M{"files_id": fileID, "n": i})
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			if err != nil {
+				name := [2]string{"Source", "Dest"}[side]
+				return CheckResult{ID: id, Status: StatusError, Details: fmt.Sprintf("%s chunk %d error: %v", name, i, err), ErrClass: classifyError(err)}
+			}
+			hashes[side] = chunkHash(chunk)
+		}
+		if d, ok := chunkDiff(fmt.Sprintf("chunks.%d", i), hashes[0], hashes[1]); ok {
+			diffs = append(diffs, d)
+		}
+	}
+
+	// Chunks beyond the length of the file are left over from a bad copy
+	for side, src := range []docSource{c.Src, c.Dest} {
+		fileID := [2]interface{}{srcID, destID}[side]
+		total, err := src.CountDocuments(ctx, db, chunks, bson.M{"files_id": fileID}, n+1)
+		if err != nil {
+			name := [2]string{"Source", "Dest"}[side]
+			return CheckResult{ID: id, Status: StatusError, Details: fmt.Sprintf("%s chunk count error: %v", name, err), ErrClass: classifyError(err)}
+		}
+		if total > n {
+			name := [2]string{"source", "dest"}[side]
+			diffs = append(diffs, FieldDiff{Path: "chunks", Kind: DiffChanged,
+				Source: fmt.Sprintf("%d chunks expected", n), Dest: fmt.Sprintf("more in %s", name)})
+		}
+	}
+
+	if len(diffs) == 0 {
+		return CheckResult{ID: id, Status: StatusMatch}
+	}
+	return CheckResult{ID: id, Status: StatusMismatch, Details: fmt.Sprintf("GridFS file content differs: %d chunk differences over %d chunks", len(diffs), n), Diffs: diffs}
+}
+
+// chunkDiff compares the hashes of a chunk on both sides, "" for a chunk
+// that is missing
+func chunkDiff(path, srcHash, destHash string) (FieldDiff, bool) {
+	switch {
+	case srcHash == destHash:
+		return FieldDiff{}, false
+	case srcHash == "":
+		return FieldDiff{Path: path, Kind: DiffMissingInSource, Dest: destHash}, true
+	case destHash == "":
+		return FieldDiff{Path: path, Kind: DiffMissingInDest, Source: srcHash}, true
+	}
+	return FieldDiff{Path: path, Kind: DiffChanged, Source: srcHash, Dest: destHash}, true
+}
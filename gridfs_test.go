@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGridFSChunks(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	file := bson.D{{Key: "length", Value: int64(10)}, {Key: "chunkSize", Value: int32(4)}, {Key: "filename", Value: "a.bin"}}
+	same, changed, short := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	for _, id := range []primitive.ObjectID{same, changed, short} {
+		for _, f := range []*fakeSource{src, dest} {
+			f.insert("media.fs.files", append(bson.D{{Key: "_id", Value: id}}, file...))
+		}
+		for n, data := range []string{"abcd", "efgh", "ij"} {
+			src.insert("media.fs.chunks", chunkDoc(id, n, data))
+			switch {
+			case id == changed && n == 1:
+				data = "efgX"
+			case id == short && n == 2:
+				continue
+			}
+			dest.insert("media.fs.chunks", chunkDoc(id, n, data))
+		}
+	}
+
+	c := NewChecker(src, dest)
+	c.GridFS = map[string]bool{"media.fs.files": true}
+	tests := []struct {
+		id   primitive.ObjectID
+		want string
+		diff string
+	}{
+		{same, StatusMatch, ""},
+		{changed, StatusMismatch, DiffChanged},
+		{short, StatusMismatch, DiffMissingInDest},
+	}
+	for _, tt := range tests {
+		res := c.checkDoc(context.Background(), "media", "fs.files", tt.id)
+		if res.Status != tt.want {
+			t.Errorf("%v: status %s (%s), want %s", tt.id, res.Status, res.Details, tt.want)
+			continue
+		}
+		if tt.diff == "" {
+			continue
+		}
+		if len(res.Diffs) != 1 || res.Diffs[0].Kind != tt.diff {
+			t.Errorf("%v: diffs %+v, want one %s chunk", tt.id, res.Diffs, tt.diff)
+		}
+	}
+
+	// Without -gridfs only the files documents are compared
+	c.GridFS = nil
+	if res := c.checkDoc(context.Background(), "media", "fs.files", changed); res.Status != StatusMatch {
+		t.Errorf("without -gridfs: status %s, want Match", res.Status)
+	}
+}
+
+func chunkDoc(id primitive.ObjectID, n int, data string) bson.D {
+	return bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "files_id", Value: id}, {Key: "n", Value: int64(n)},
+		{Key: "data", Value: primitive.Binary{Data: []byte(data)}}}
+}
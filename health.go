@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthPingTimeout bounds the pings of a /readyz request
+const healthPingTimeout = 2 * time.Second
+
+// pinger is a cluster /readyz pings
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// healthServer serves /healthz and /readyz for a run deployed as a
+// long-lived job or sidecar. /healthz fails once the run made no progress,
+// no row read and no id checked, for stall; an orchestrator restarting the
+// job on it gets a stuck run going again. /readyz fails while a cluster
+// does not answer a ping.
+type healthServer struct {
+	progress *Progress
+	stall    time.Duration
+	clusters map[string]pinger // by side
+	now      func() time.Time
+
+	mu       sync.Mutex
+	last     int64     // progress counters at the last change
+	lastSeen time.Time // when they last changed
+}
+
+func newHealthServer(progress *Progress, stall time.Duration, clusters map[string]pinger) *healthServer {
+	return &healthServer{progress: progress, stall: stall, clusters: clusters, now: time.Now, lastSeen: time.Now()}
+}
+
+// idle returns how long the run has made no progress
+func (h *healthServer) idle() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	if n := h.progress.Rows.Load() + h.progress.Checked.Load(); n != h.last {
+		h.last, h.lastSeen = n, now
+	}
+	return now.Sub(h.lastSeen)
+}
+
+func (h *healthServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if idle := h.idle(); idle > h.stall {
+			http.Error(w, fmt.Sprintf("stalled: no progress for %v (rows read %d, ids checked %d)", idle.Round(time.Second), h.progress.Rows.Load(), h.progress.Checked.Load()), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "ok: rows read %d, ids checked %d\n", h.progress.Rows.Load(), h.progress.Checked.Load())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+		defer cancel()
+		for _, side := range []string{"source", "dest"} {
+			p, ok := h.clusters[side]
+			if !ok {
+				continue
+			}
+			if err := p.Ping(ctx); err != nil {
+				http.Error(w, fmt.Sprintf("%s not connected: %v", side, err), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// serve listens on addr, so that a port in use fails the run up front, and
+// serves the endpoints until the returned server is closed
+func (h *healthServer) serve(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: h.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	return srv, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakePinger answers pings with err
+type fakePinger struct {
+	err error
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	progress := &Progress{}
+	dest := &fakePinger{}
+	h := newHealthServer(progress, time.Minute, map[string]pinger{"source": &fakePinger{}, "dest": dest})
+	clock := time.Date(2025, 10, 15, 17, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return clock }
+	h.lastSeen = clock
+	srv := httptest.NewServer(h.handler())
+	defer srv.Close()
+
+	status := func(path string) int {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Errorf("healthz at start: %d", got)
+	}
+	if got := status("/readyz"); got != http.StatusOK {
+		t.Errorf("readyz with both clusters up: %d", got)
+	}
+
+	// Progressing: rows read within the interval
+	clock = clock.Add(50 * time.Second)
+	progress.Rows.Add(10)
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Errorf("healthz while progressing: %d", got)
+	}
+	clock = clock.Add(50 * time.Second)
+	progress.Checked.Add(10)
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Errorf("healthz after checks: %d", got)
+	}
+
+	// Stalled: nothing for longer than the interval
+	clock = clock.Add(61 * time.Second)
+	if got := status("/healthz"); got != http.StatusServiceUnavailable {
+		t.Errorf("healthz when stalled: %d, want 503", got)
+	}
+	progress.Checked.Add(1)
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Errorf("healthz after progress resumed: %d", got)
+	}
+
+	dest.err = errors.New("server selection timeout")
+	if got := status("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("readyz with dest down: %d, want 503", got)
+	}
+}
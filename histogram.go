@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// histogramMaxGaps bounds the number of buckets listed: past it, empty
+// buckets between the first and last entry are left out
+const histogramMaxGaps = 1000
+
+// histogramBarWidth is the width of the bar of the fullest bucket
+const histogramBarWidth = 40
+
+// timeHistogram counts the checked log entries by the time bucket of their
+// logged date, to show whether failures cluster around a deploy or some
+// other window
+type timeHistogram struct {
+	Bucket time.Duration
+	counts map[time.Time]int
+}
+
+func newTimeHistogram(bucket time.Duration) *timeHistogram {
+	return &timeHistogram{Bucket: bucket, counts: make(map[time.Time]int)}
+}
+
+// add counts an entry logged at t
+func (h *timeHistogram) add(t time.Time) {
+	h.counts[t.UTC().Truncate(h.Bucket)]++
+}
+
+// histogramBucket is one bucket of a timeHistogram
+type histogramBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// Buckets returns the buckets in time order, from that of the first entry
+// to that of the last, empty ones included unless there are more than
+// histogramMaxGaps
+func (h *timeHistogram) Buckets() []histogramBucket {
+	if h == nil || len(h.counts) == 0 {
+		return nil
+	}
+	starts := slices.SortedFunc(maps.Keys(h.counts), time.Time.Compare)
+	first, last := starts[0], starts[len(starts)-1]
+	if int(last.Sub(first)/h.Bucket) < histogramMaxGaps {
+		starts = starts[:0]
+		for t := first; !t.After(last); t = t.Add(h.Bucket) {
+			starts = append(starts, t)
+		}
+	}
+	buckets := make([]histogramBucket, len(starts))
+	for i, t := range starts {
+		buckets[i] = histogramBucket{Start: t, Count: h.counts[t]}
+	}
+	return buckets
+}
+
+// jsonTimeHistogram is the JSON form of a timeHistogram
+type jsonTimeHistogram struct {
+	BucketSeconds float64           `json:"bucketSeconds"`
+	Buckets       []histogramBucket `json:"buckets"`
+}
+
+func (h *timeHistogram) json() jsonTimeHistogram {
+	return jsonTimeHistogram{BucketSeconds: h.Bucket.Seconds(), Buckets: h.Buckets()}
+}
+
+// recordTime counts an entry of the log in TimeHistogram by its logged date,
+// the first column of its row. Dates that do not parse are ignored.
+func (c *Checker) recordTime(date string) {
+	if c.TimeHistogram == nil {
+		return
+	}
+	if t, ok := parseTimestamp(date); ok {
+		c.TimeHistogram.add(t)
+	}
+}
+
+func printTimeHistogram(w io.Writer, h *timeHistogram) {
+	buckets := h.Buckets()
+	if len(buckets) == 0 {
+		return
+	}
+	most := 0
+	for _, b := range buckets {
+		most = max(most, b.Count)
+	}
+	fmt.Fprintf(w, "\n=== Log Entries per %v (UTC) ===\n", h.Bucket)
+	for _, b := range buckets {
+		bar := strings.Repeat("#", (b.Count*histogramBarWidth+most-1)/most)
+		fmt.Fprintf(w, "%s %-*s %d\n", b.Start.Format("2006-01-02 15:04:05"), histogramBarWidth, bar, b.Count)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTimeHistogram(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	var lines []string
+	for _, date := range []string{"2025-10-15T17:32:48.521Z", "2025-10-15T17:59:59Z", "2025-10-15T20:00:00Z", "2025-10-15T20:10:00+02:00", "not a date"} {
+		id := primitive.NewObjectID()
+		src.insert("db.col", bson.D{{Key: "_id", Value: id}})
+		lines = append(lines, strings.Replace(logLine("db.col", id), "2025-10-15T17:32:48.521Z", date, 1))
+	}
+	// A line that is not checked is not counted
+	lines = append(lines, "2025-10-15T19:00:00Z,dsync,col,batch applied")
+
+	c := NewChecker(src, dest)
+	c.TimeHistogram = newTimeHistogram(time.Hour)
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// 20:10+02:00 is 18:10 UTC; the empty hour in between is listed
+	var got []string
+	for _, b := range c.TimeHistogram.Buckets() {
+		got = append(got, fmt.Sprintf("%s=%d", b.Start.Format("15:04"), b.Count))
+	}
+	if want := "17:00=2,18:00=1,19:00=0,20:00=1"; strings.Join(got, ",") != want {
+		t.Errorf("buckets %s, want %s", strings.Join(got, ","), want)
+	}
+
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "=== Log Entries per 1h0m0s (UTC) ===\n2025-10-15 17:00:00 "+strings.Repeat("#", histogramBarWidth)+" 2\n") {
+		t.Errorf("report does not show the histogram:\n%s", out.String())
+	}
+}
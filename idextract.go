@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IDExtractor pulls the id of the failed document out of a log message.
+// ExtractID returns errNoID when the message carries no id the extractor
+// recognizes, and another error when it found one it could not parse.
+type IDExtractor interface {
+	ExtractID(message string) (interface{}, error)
+}
+
+// errNoID reports that a message carries no id of the kind an extractor
+// looks for
+var errNoID = errors.New("no id found in message")
+
+// defaultIDStrategy is the extractor used when -id-strategy is not given:
+// the Extended JSON id="{...}" form the migration logs emit
+const defaultIDStrategy = "json"
+
+// idStrategies are the -id-strategy names, auto and regex:<pattern> aside
+var idStrategies = map[string]IDExtractor{
+	"json":   jsonIDExtractor{},
+	"oid":    oidIDExtractor{},
+	"uuid":   uuidIDExtractor{},
+	"int":    intIDExtractor{},
+	"string": stringIDExtractor{},
+}
+
+// autoOrder is the order in which auto tries the strategies: the typed
+// forms first, so that a quoted hex string is read as an ObjectID rather
+// than a string
+var autoOrder = []string{"json", "oid", "uuid", "int", "string"}
+
+// newIDExtractor returns the extractor named by an -id-strategy value: one
+// of json, oid, uuid, int, string, auto, or regex:<pattern>, whose first
+// capture group (or whole match) is the id
+func newIDExtractor(strategy string) (IDExtractor, error) {
+	if pattern, ok := strings.CutPrefix(strategy, "regex:"); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id regex: %w", err)
+		}
+		return regexIDExtractor{re}, nil
+	}
+	if strategy == "auto" {
+		var auto autoIDExtractor
+		for _, name := range autoOrder {
+			auto = append(auto, idStrategies[name])
+		}
+		return auto, nil
+	}
+	if e, ok := idStrategies[strategy]; ok {
+		return e, nil
+	}
+	return nil, fmt.Errorf("unknown id strategy %q (want json, oid, uuid, int, string, auto or regex:<pattern>)", strategy)
+}
+
+// extractID reads the id of message with the configured extractor, once
+// curly quotes are normalized
+func (c *Checker) extractID(message string) (interface{}, error) {
+	return c.IDExtractor.ExtractID(normalizeQuotes(message))
+}
+
+// idValue returns the raw text logged as id=<value>
+func idValue(message string) (string, error) {
+	v, ok := extractFieldValue(message, "id")
+	if !ok {
+		return "", errNoID
+	}
+	return v, nil
+}
+
+// jsonIDExtractor reads an Extended JSON id="{...}", in any of the dialects
+// parseID accepts. A compound key is returned as a document.
+type jsonIDExtractor struct{}
+
+func (jsonIDExtractor) ExtractID(message string) (interface{}, error) {
+	idJSON, ok := extractIDJSON(message)
+	if !ok {
+		return nil, errNoID
+	}
+	return parseID(idJSON)
+}
+
+// oidIDExtractor reads an ObjectID logged as bare hex, as ObjectId("...")
+// or as {"$oid":"..."}
+type oidIDExtractor struct{}
+
+func (oidIDExtractor) ExtractID(message string) (interface{}, error) {
+	v, err := idValue(message)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseIDArg(v)
+	if err != nil {
+		return nil, errNoID
+	}
+	oid, ok := id.(primitive.ObjectID)
+	if !ok {
+		return nil, errNoID
+	}
+	return oid, nil
+}
+
+// uuidRegex matches the canonical 8-4-4-4-12 hex form of a UUID
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// uuidIDExtractor reads a UUID logged bare, as UUID("..."), as {"$uuid":...}
+// or as subtype 4 binary, and returns it as subtype 4 binary
+type uuidIDExtractor struct{}
+
+func (uuidIDExtractor) ExtractID(message string) (interface{}, error) {
+	v, err := idValue(message)
+	if err != nil {
+		return nil, err
+	}
+	if uuidRegex.MatchString(v) {
+		data, err := hex.DecodeString(strings.ReplaceAll(v, "-", ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid UUID %q: %w", v, err)
+		}
+		return primitive.Binary{Subtype: 4, Data: data}, nil
+	}
+	id, err := parseID(v)
+	if err != nil {
+		return nil, errNoID
+	}
+	bin, ok := id.(primitive.Binary)
+	if !ok || bin.Subtype != 4 {
+		return nil, errNoID
+	}
+	return bin, nil
+}
+
+// intIDExtractor reads an integer id logged bare, as NumberLong(...) or
+// NumberInt(...), or as {"$numberLong":...}
+type intIDExtractor struct{}
+
+func (intIDExtractor) ExtractID(message string) (interface{}, error) {
+	v, err := idValue(message)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	id, err := parseID(v)
+	if err != nil {
+		return nil, errNoID
+	}
+	switch id.(type) {
+	case int32, int64:
+		return id, nil
+	}
+	return nil, errNoID
+}
+
+// stringIDExtractor takes the logged id text as a string id, unparsed
+type stringIDExtractor struct{}
+
+func (stringIDExtractor) ExtractID(message string) (interface{}, error) {
+	v, err := idValue(message)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// regexIDExtractor takes the id from a user-supplied pattern: the first
+// capture group, or the whole match when there is none. The text is parsed
+// like an -id argument and is taken as a string if that fails.
+type regexIDExtractor struct {
+	re *regexp.Regexp
+}
+
+func (e regexIDExtractor) ExtractID(message string) (interface{}, error) {
+	m := e.re.FindStringSubmatch(message)
+	if m == nil {
+		return nil, errNoID
+	}
+	text := m[0]
+	if len(m) > 1 {
+		text = m[1]
+	}
+	if text == "" {
+		return nil, errNoID
+	}
+	if id, err := parseIDArg(text); err == nil {
+		return id, nil
+	}
+	return text, nil
+}
+
+// autoIDExtractor tries each extractor in turn and returns the first id
+// found. A parse error is returned only if no later extractor finds an id.
+type autoIDExtractor []IDExtractor
+
+func (a autoIDExtractor) ExtractID(message string) (interface{}, error) {
+	var firstErr error
+	for _, e := range a {
+		id, err := e.ExtractID(message)
+		if err == nil {
+			return id, nil
+		}
+		if firstErr == nil && !errors.Is(err, errNoID) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, errNoID
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIDStrategies(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("693885e2f227ce8067db8d33")
+	uuid := primitive.Binary{Subtype: 4, Data: []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}}
+	tests := []struct {
+		strategy string
+		msg      string
+		want     interface{} // nil: errNoID
+	}{
+		{"json", `failed id="{"$oid":"693885e2f227ce8067db8d33"}" key=1`, oid},
+		{"json", `failed id="{"a":1,"b":"x"}"`, bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: "x"}}},
+		{"json", `failed id=693885e2f227ce8067db8d33`, nil},
+
+		{"oid", `failed id=693885e2f227ce8067db8d33 key=1`, oid},
+		{"oid", `failed id="ObjectId("693885e2f227ce8067db8d33")" key=1`, oid},
+		{"oid", `failed id=ObjectId("693885e2f227ce8067db8d33")`, oid},
+		{"oid", `failed id="{"$oid":"693885e2f227ce8067db8d33"}"`, oid},
+		{"oid", `failed id=42`, nil},
+		{"oid", `failed index=0`, nil},
+
+		{"uuid", `failed id=00112233-4455-6677-8899-aabbccddeeff key=1`, uuid},
+		{"uuid", `failed id="UUID("00112233-4455-6677-8899-aabbccddeeff")"`, uuid},
+		{"uuid", `failed id={"$uuid":"00112233-4455-6677-8899-aabbccddeeff"}`, uuid},
+		{"uuid", `failed id=693885e2f227ce8067db8d33`, nil},
+
+		{"int", `failed id=42 key=1`, int64(42)},
+		{"int", `failed id="-7"`, int64(-7)},
+		{"int", `failed id=NumberLong(42)`, int64(42)},
+		{"int", `failed id=NumberInt(42)`, int32(42)},
+		{"int", `failed id=4.5`, nil},
+		{"int", `failed id=abc`, nil},
+
+		{"string", `failed id=order-17 key=1`, "order-17"},
+		{"string", `failed id="two words"`, "two words"},
+		{"string", `failed oid=x`, nil},
+		{"string", `failed retryid=x id=order-17`, "order-17"},
+		{"string", `failed doc.id=x $id=y`, nil},
+		{"string", `id=order-17`, "order-17"},
+
+		{`regex:doc=(\S+)`, `failed doc=693885e2f227ce8067db8d33`, oid},
+		{`regex:doc=(\S+)`, `failed doc=order-17`, "order-17"},
+		{`regex:doc=(\S+)`, `failed doc=NumberLong(5)`, int64(5)},
+		{`regex:[0-9a-f]{24}`, `failed on 693885e2f227ce8067db8d33`, oid},
+		{`regex:doc=(\S+)`, `failed id=1`, nil},
+	}
+	for _, tt := range tests {
+		e, err := newIDExtractor(tt.strategy)
+		if err != nil {
+			t.Fatalf("newIDExtractor(%q): %v", tt.strategy, err)
+		}
+		got, err := e.ExtractID(tt.msg)
+		if tt.want == nil {
+			if !errors.Is(err, errNoID) {
+				t.Errorf("%s: ExtractID(%q) = %#v, %v; want errNoID", tt.strategy, tt.msg, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ExtractID(%q): %v", tt.strategy, tt.msg, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ExtractID(%q) = %#v, want %#v", tt.strategy, tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestAutoIDStrategy(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("693885e2f227ce8067db8d33")
+	auto, err := newIDExtractor("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		msg  string
+		want interface{}
+	}{
+		// Each form falls through to the first strategy that reads it
+		{`failed id="{"$oid":"693885e2f227ce8067db8d33"}"`, oid},
+		{`failed id=693885e2f227ce8067db8d33`, oid},
+		{`failed id=00112233-4455-6677-8899-aabbccddeeff`, primitive.Binary{Subtype: 4, Data: []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}}},
+		{`failed id=42`, int64(42)},
+		{`failed id=order-17`, "order-17"},
+	}
+	for _, tt := range tests {
+		got, err := auto.ExtractID(tt.msg)
+		if err != nil {
+			t.Errorf("auto: ExtractID(%q): %v", tt.msg, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("auto: ExtractID(%q) = %#v, want %#v", tt.msg, got, tt.want)
+		}
+	}
+
+	if _, err := auto.ExtractID(`failed index=0`); !errors.Is(err, errNoID) {
+		t.Errorf("auto without an id: err = %v, want errNoID", err)
+	}
+	// A malformed JSON id is reported unless a later strategy reads the value
+	if _, err := (autoIDExtractor{jsonIDExtractor{}, oidIDExtractor{}}).ExtractID(`failed id={"$oid":1}`); err == nil || errors.Is(err, errNoID) {
+		t.Errorf("malformed JSON id: err = %v, want a parse error", err)
+	}
+}
+
+func TestNewIDExtractorErrors(t *testing.T) {
+	for _, s := range []string{"", "hex", "regex:("} {
+		if _, err := newIDExtractor(s); err == nil {
+			t.Errorf("newIDExtractor(%q) succeeded, want an error", s)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Kinds of IndexDiff
+const (
+	IndexMissingInSource = "MissingInSource"
+	IndexMissingInDest   = "MissingInDest"
+	IndexKeyMismatch     = "KeyMismatch"
+	IndexOptionsMismatch = "OptionsMismatch"
+	IndexError           = "Error"
+)
+
+// IndexDiff describes an index that differs between source and dest
+type IndexDiff struct {
+	Namespace string      `json:"namespace"`
+	Index     string      `json:"index,omitempty"`
+	Kind      string      `json:"kind"`
+	Source    string      `json:"source,omitempty"` // key pattern, for KeyMismatch
+	Dest      string      `json:"dest,omitempty"`
+	Diffs     []FieldDiff `json:"diffs,omitempty"` // option differences, for OptionsMismatch
+	Details   string      `json:"details,omitempty"`
+}
+
+func (d IndexDiff) String() string {
+	switch d.Kind {
+	case IndexKeyMismatch:
+		return fmt.Sprintf("[%s] index %s: key source %s != dest %s", d.Namespace, d.Index, d.Source, d.Dest)
+	case IndexError:
+		return fmt.Sprintf("[%s] error: %s", d.Namespace, d.Details)
+	case IndexOptionsMismatch:
+		return fmt.Sprintf("[%s] index %s: options differ", d.Namespace, d.Index)
+	}
+	return fmt.Sprintf("[%s] index %s: %s", d.Namespace, d.Index, d.Kind)
+}
+
+// indexLister lists the index specifications of a collection
+type indexLister interface {
+	ListIndexes(ctx context.Context, db, col string) ([]bson.Raw, error)
+}
+
+func (m mongoSource) ListIndexes(ctx context.Context, db, col string) ([]bson.Raw, error) {
+	cur, err := m.client.Database(db).Collection(col).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var specs []bson.Raw
+	for cur.Next(ctx) {
+		specs = append(specs, append(bson.Raw(nil), cur.Current...))
+	}
+	return specs, cur.Err()
+}
+
+// indexMetaFields are spec fields that are not index options: the name and
+// key are compared separately, v and ns vary between servers.
+var indexMetaFields = map[string]bool{"name": true, "key": true, "v": true, "ns": true}
+
+// diffIndexes compares the index specs of one namespace, matching indexes by
+// name. Key patterns are compared in order, since field order is significant
+// in an index key; the remaining options are compared ignoring order.
+func diffIndexes(namespace string, src, dest []bson.Raw) []IndexDiff {
+	srcByName, destByName := indexesByName(src), indexesByName(dest)
+	names := make([]string, 0, len(srcByName)+len(destByName))
+	for name := range srcByName {
+		names = append(names, name)
+	}
+	for name := range destByName {
+		if _, ok := srcByName[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []IndexDiff
+	for _, name := range names {
+		s, inSrc := srcByName[name]
+		d, inDest := destByName[name]
+		switch {
+		case !inDest:
+			diffs = append(diffs, IndexDiff{Namespace: namespace, Index: name, Kind: IndexMissingInDest})
+		case !inSrc:
+			diffs = append(diffs, IndexDiff{Namespace: namespace, Index: name, Kind: IndexMissingInSource})
+		default:
+			srcKey, destKey := s.Lookup("key"), d.Lookup("key")
+			if string(srcKey.Value) != string(destKey.Value) {
+				diffs = append(diffs, IndexDiff{Namespace: namespace, Index: name, Kind: IndexKeyMismatch,
+					Source: srcKey.String(), Dest: destKey.String()})
+				continue
+			}
+			if optDiffs := (&comparer{}).diffDocs(indexOptions(s), indexOptions(d)); len(optDiffs) > 0 {
+				diffs = append(diffs, IndexDiff{Namespace: namespace, Index: name, Kind: IndexOptionsMismatch, Diffs: optDiffs})
+			}
+		}
+	}
+	return diffs
+}
+
+func indexesByName(specs []bson.Raw) map[string]bson.Raw {
+	m := make(map[string]bson.Raw, len(specs))
+	for _, spec := range specs {
+		name, _ := spec.Lookup("name").StringValueOK()
+		m[name] = spec
+	}
+	return m
+}
+
+// indexOptions returns the spec without its non-option fields
+func indexOptions(spec bson.Raw) bson.Raw {
+	elems, _ := spec.Elements()
+	var opts bson.D
+	for _, e := range elems {
+		if !indexMetaFields[e.Key()] {
+			opts = append(opts, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+	}
+	raw, _ := bson.Marshal(opts)
+	return raw
+}
+
+// Namespaces reads a log and returns the distinct namespaces of its
+// retry-failure lines, sorted
+func (c *Checker) Namespaces(r io.Reader) ([]string, error) {
+	seen := make(map[string]bool)
+	err := c.readLog(r, func(lineNum int, record []string) {
+		message, ok := c.messageOf(lineNum, record)
+		if !ok || !c.selected(message) {
+			return
+		}
+		if namespace, ok := c.namespaceOf(lineNum, record, message); ok {
+			seen[namespace] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// CheckIndexes compares the indexes of each namespace on both sides. Both
+// sources must implement indexLister.
+func (c *Checker) CheckIndexes(ctx context.Context, namespaces []string) ([]IndexDiff, error) {
+	srcLister, ok := c.Src.(indexLister)
+	if !ok {
+		return nil, fmt.Errorf("source cannot list indexes")
+	}
+	destLister, ok := c.Dest.(indexLister)
+	if !ok {
+		return nil, fmt.Errorf("destination cannot list indexes")
+	}
+
+	var diffs []IndexDiff
+	for _, ns := range namespaces {
+		db, col, err := splitNamespace(ns)
+		if err != nil {
+			diffs = append(diffs, IndexDiff{Namespace: ns, Kind: IndexError, Details: err.Error()})
+			continue
+		}
+		src, err := srcLister.ListIndexes(ctx, db, col)
+		if err != nil {
+			diffs = append(diffs, IndexDiff{Namespace: ns, Kind: IndexError, Details: fmt.Sprintf("Source error: %v", err)})
+			continue
+		}
+		dest, err := destLister.ListIndexes(ctx, db, col)
+		if err != nil {
+			diffs = append(diffs, IndexDiff{Namespace: ns, Kind: IndexError, Details: fmt.Sprintf("Dest error: %v", err)})
+			continue
+		}
+		diffs = append(diffs, diffIndexes(ns, src, dest)...)
+	}
+	return diffs, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func indexSpec(t *testing.T, spec bson.D) bson.Raw {
+	t.Helper()
+	raw, err := bson.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestDiffIndexes(t *testing.T) {
+	src := []bson.Raw{
+		indexSpec(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "name", Value: "_id_"}}),
+		indexSpec(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 1}}}, {Key: "name", Value: "ab"}}),
+		indexSpec(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "email", Value: 1}}}, {Key: "name", Value: "email"}, {Key: "unique", Value: true}}),
+		indexSpec(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "c", Value: 1}}}, {Key: "name", Value: "c"}}),
+	}
+	dest := []bson.Raw{
+		// v differs between servers and is ignored
+		indexSpec(t, bson.D{{Key: "v", Value: 1}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "name", Value: "_id_"}}),
+		// key field order is significant
+		indexSpec(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "b", Value: 1}, {Key: "a", Value: 1}}}, {Key: "name", Value: "ab"}}),
+		indexSpec(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "email", Value: 1}}}, {Key: "name", Value: "email"}}),
+		indexSpec(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "d", Value: 1}}}, {Key: "name", Value: "d"}}),
+	}
+
+	diffs := diffIndexes("db.col", src, dest)
+	want := []struct{ index, kind string }{
+		{"ab", IndexKeyMismatch},
+		{"c", IndexMissingInDest},
+		{"d", IndexMissingInSource},
+		{"email", IndexOptionsMismatch},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("diffIndexes = %v, want %d diffs", diffs, len(want))
+	}
+	for i, w := range want {
+		if diffs[i].Index != w.index || diffs[i].Kind != w.kind {
+			t.Errorf("diff %d = %s %s, want %s %s", i, diffs[i].Index, diffs[i].Kind, w.index, w.kind)
+		}
+	}
+	if d := diffs[3].Diffs; len(d) != 1 || d[0].Path != "unique" || d[0].Kind != DiffMissingInDest {
+		t.Errorf("email option diffs = %v, want unique missing in dest", d)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// objectStore reads objects from a bucket
+type objectStore interface {
+	Open(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// objectStores opens the store of each URL scheme. The stores are built in
+// on demand, each by the build tag of objectStoreTags registering it from
+// its own file, so that their SDKs are left out of the default build.
+var objectStores = map[string]func(ctx context.Context) (objectStore, error){}
+
+// objectStoreTags are the build tags adding the store of each URL scheme
+var objectStoreTags = map[string]string{
+	"s3": "s3",
+	"gs": "gcs",
+}
+
+// openInput opens a local path or an s3://bucket/key or gs://bucket/key URL.
+// Objects are streamed rather than downloaded first. A .gz, .zst or .bz2
+// suffix is decompressed transparently.
+func openInput(ctx context.Context, path string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	if scheme, rest, ok := strings.Cut(path, "://"); ok {
+		newStore, known := objectStores[scheme]
+		if !known {
+			if tag, ok := objectStoreTags[scheme]; ok {
+				return nil, fmt.Errorf("cannot open %s: built without %s:// support (rebuild with -tags %s)", path, scheme, tag)
+			}
+			return nil, fmt.Errorf("unsupported scheme %q in %s", scheme, path)
+		}
+		bucket, key, _ := strings.Cut(rest, "/")
+		if bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid object URL %s: want %s://bucket/key", path, scheme)
+		}
+		store, err := newStore(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", scheme, err)
+		}
+		rc, err = store.Open(ctx, bucket, key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open %s: %w", path, err)
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
+	}
+
+	for suffix, decompress := range decompressors {
+		if !strings.HasSuffix(path, suffix) {
+			continue
+		}
+		zr, err := decompress(rc)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return zr, nil
+	}
+	return rc, nil
+}
+
+// decompressors wrap an input stream, by file suffix, in its decompressor.
+// Closing the decompressor closes the stream.
+var decompressors = map[string]func(rc io.ReadCloser) (io.ReadCloser, error){
+	".gz": func(rc io.ReadCloser) (io.ReadCloser, error) {
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, err
+		}
+		return decompressReader{Reader: zr, close: zr.Close, underlying: rc}, nil
+	},
+	".zst": func(rc io.ReadCloser) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(rc)
+		if err != nil {
+			return nil, err
+		}
+		return decompressReader{Reader: zr, close: func() error { zr.Close(); return nil }, underlying: rc}, nil
+	},
+	".bz2": func(rc io.ReadCloser) (io.ReadCloser, error) {
+		return decompressReader{Reader: bzip2.NewReader(rc), close: func() error { return nil }, underlying: rc}, nil
+	},
+}
+
+// compressed reports whether the input at path is decompressed on reading
+func compressed(path string) bool {
+	for suffix := range decompressors {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// decompressReader closes both the decompressor and the underlying stream
+type decompressReader struct {
+	io.Reader
+	close      func() error
+	underlying io.Closer
+}
+
+func (d decompressReader) Close() error {
+	d.close()
+	return d.underlying.Close()
+}
+
+// readerWithCloser also closes the client the object was read through
+type readerWithCloser struct {
+	io.ReadCloser
+	closer io.Closer
+}
+
+func (r readerWithCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.closer.Close()
+	return err
+}
+
+// logBufferSize is the read buffer of the CSV log, large enough that lines
+// carrying bulk-write error dumps are read in few calls
+const logBufferSize = 1 << 20
+
+// defaultMaxLineBytes is the default -max-line-bytes
+const defaultMaxLineBytes = 64 << 20
+
+// lineLimitReader passes the lines of r through, but replaces each line
+// longer than max bytes with an empty line, which the CSV reader skips, and
+// reports it to oversized with its line number (counting from 1) and size.
+// At most max bytes of a line are held in memory. A max of 0 is no limit.
+type lineLimitReader struct {
+	r         *bufio.Reader
+	max       int
+	line      int
+	pending   []byte
+	err       error
+	oversized func(line, size int)
+}
+
+func newLineLimitReader(r io.Reader, max int, oversized func(line, size int)) *lineLimitReader {
+	return &lineLimitReader{r: bufio.NewReaderSize(r, logBufferSize), max: max, oversized: oversized}
+}
+
+func (l *lineLimitReader) Read(p []byte) (int, error) {
+	for len(l.pending) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		l.pending, l.err = l.readLine()
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// readLine reads the next line, its newline included
+func (l *lineLimitReader) readLine() ([]byte, error) {
+	var line []byte
+	size := 0
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		size += len(chunk)
+		if l.max <= 0 || size <= l.max {
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if size > 0 {
+			l.line++
+		}
+		if l.max > 0 && size > l.max {
+			l.oversized(l.line, size)
+			line = []byte("\n")
+		}
+		return line, err
+	}
+}
@@ -0,0 +1,36 @@
+//go:build gcs
+
+package main
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// The gcs build tag adds gs://bucket/key input, with Google application
+// default credentials
+func init() {
+	objectStores["gs"] = newGCSStore
+}
+
+type gcsStore struct {
+	client *storage.Client
+}
+
+func newGCSStore(ctx context.Context) (objectStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gcsStore{client: client}, nil
+}
+
+func (s gcsStore) Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	r, err := s.client.Bucket(bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return readerWithCloser{ReadCloser: r, closer: s.client}, nil
+}
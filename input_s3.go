@@ -0,0 +1,38 @@
+//go:build s3
+
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// The s3 build tag adds s3://bucket/key input, with credentials from the
+// AWS default credential chain
+func init() {
+	objectStores["s3"] = newS3Store
+}
+
+type s3Store struct {
+	client *s3.Client
+}
+
+func newS3Store(ctx context.Context) (objectStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s3Store{client: s3.NewFromConfig(cfg)}, nil
+}
+
+func (s s3Store) Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memStore is an in-memory objectStore keyed by "bucket/key"
+type memStore map[string][]byte
+
+func (m memStore) Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	data, ok := m[bucket+"/"+key]
+	if !ok {
+		return nil, fmt.Errorf("no such object")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestOpenInputObjectStore(t *testing.T) {
+	oid := primitive.NewObjectID()
+	log := logFile(logLine("db.col", oid))
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(log))
+	zw.Close()
+
+	store := memStore{"logs/plain.csv": []byte(log), "logs/2025/errors.csv.gz": gz.Bytes()}
+	saved := objectStores
+	defer func() { objectStores = saved }()
+	objectStores = map[string]func(context.Context) (objectStore, error){
+		"s3": func(context.Context) (objectStore, error) { return store, nil },
+		"gs": func(context.Context) (objectStore, error) { return store, nil },
+	}
+
+	for _, url := range []string{"s3://logs/plain.csv", "gs://logs/2025/errors.csv.gz"} {
+		r, err := openInput(context.Background(), url)
+		if err != nil {
+			t.Fatalf("openInput(%s): %v", url, err)
+		}
+		c := NewChecker(newFakeSource(), newFakeSource())
+		if err := c.Run(context.Background(), r); err != nil {
+			t.Fatalf("%s: Run: %v", url, err)
+		}
+		r.Close()
+		if s := c.StatsMap["db.col"]; s == nil || s.TotalChecks != 1 {
+			t.Errorf("%s: stats = %+v, want 1 check", url, s)
+		}
+	}
+
+	for _, url := range []string{"s3://logs/missing.csv", "s3://logs", "ftp://host/file.csv"} {
+		if _, err := openInput(context.Background(), url); err == nil {
+			t.Errorf("openInput(%s): expected an error", url)
+		} else if !strings.Contains(err.Error(), url) && !strings.Contains(err.Error(), "ftp") {
+			t.Errorf("openInput(%s): error %q does not name the input", url, err)
+		}
+	}
+}
+
+func TestOpenInputStoreNotBuiltIn(t *testing.T) {
+	saved := objectStores
+	defer func() { objectStores = saved }()
+	objectStores = map[string]func(context.Context) (objectStore, error){}
+
+	for url, tag := range map[string]string{"s3://logs/errors.csv": "-tags s3", "gs://logs/errors.csv": "-tags gcs"} {
+		_, err := openInput(context.Background(), url)
+		if err == nil || !strings.Contains(err.Error(), tag) {
+			t.Errorf("openInput(%s) = %v, want an error naming %s", url, err, tag)
+		}
+	}
+}
+
+// bzip2Log is logFile(logLine("db.col", ObjectID 693885e2f227ce8067db8d33))
+// compressed with bzip2, which the standard library cannot write
+const bzip2Log = "425a683931415926535944d8661f00002fdf80001054077ff2462b5414bfafde6a3000ba42a9e9e49ea9e534643d4f4d" +
+	"46353ca7a20064d34186869a00680034000321a06a7a8d29ea7a4c27a8d068d00c8d001895329aa7f463b7bb8e15b824" +
+	"cc155f5ab5828040aa289e6ce744b4d8b989a12568c24e92b55d94364ed6c0410ed54258087be6252d195f14e87ebaac" +
+	"620c1cb144878d7c377edf32ce9555e21d624665f4e2f5e9709cce2cc259c830cbe9e9a2703ca186d10b7e9e0eb5eb9f" +
+	"da468486b5472dc5980f164977e80da5adbee7b2411aebd98c6217b03b3c14d95a10879052c1fc5dc914e14241136198" +
+	"7c"
+
+func TestOpenInputCompressed(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("693885e2f227ce8067db8d33")
+	log := logFile(logLine("db.col", oid))
+	dir := t.TempDir()
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(log))
+	gw.Close()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zst := zw.EncodeAll([]byte(log), nil)
+	zw.Close()
+	bz2, err := hex.DecodeString(bzip2Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{"log.csv": []byte(log), "log.csv.gz": gz.Bytes(), "log.csv.zst": zst, "log.csv.bz2": bz2}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := openInput(context.Background(), path)
+		if err != nil {
+			t.Fatalf("openInput(%s): %v", name, err)
+		}
+		c := NewChecker(newFakeSource(), newFakeSource())
+		if err := c.Run(context.Background(), r); err != nil {
+			t.Errorf("%s: Run: %v", name, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: Close: %v", name, err)
+		}
+		if s := c.StatsMap["db.col"]; s == nil || s.TotalChecks != 1 {
+			t.Errorf("%s: stats = %+v, want 1 check", name, s)
+		}
+	}
+
+	// A file that is not what its suffix says fails to open
+	path := filepath.Join(dir, "plain.csv.zst")
+	os.WriteFile(path, []byte(log), 0o644)
+	r, err := openInput(context.Background(), path)
+	if err == nil {
+		_, err = io.ReadAll(r)
+		r.Close()
+	}
+	if err == nil {
+		t.Error("reading an uncompressed .zst file succeeded")
+	}
+}
+
+func TestLongLines(t *testing.T) {
+	// A bulk-write error dump well past the 64 KiB of a default bufio.Scanner
+	dump := strings.Repeat("x", 200<<10)
+	id := primitive.NewObjectID()
+	long := strings.Replace(logLine("db.col", id), "key=1", "key=1 dump="+dump, 1)
+	input := logFile(long, logLine("db.col", primitive.NewObjectID()))
+
+	c := NewChecker(newFakeSource(), newFakeSource())
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s := c.StatsMap["db.col"]; c.OversizedLines != 0 || s.TotalChecks != 2 {
+		t.Errorf("default limit: %d oversized lines, %d checks; want both lines checked", c.OversizedLines, s.TotalChecks)
+	}
+
+	// Under a lower limit the long line is skipped and named, and the next
+	// one is still checked
+	c = NewChecker(newFakeSource(), newFakeSource())
+	c.MaxLineBytes = 100 << 10
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s := c.StatsMap["db.col"]; c.OversizedLines != 1 || c.RowsRead != 1 || s.TotalChecks != 1 {
+		t.Errorf("lower limit: %d oversized lines, %d rows, %d checks; want the long line skipped", c.OversizedLines, c.RowsRead, s.TotalChecks)
+	}
+	errs := c.recentErrors.Errors()
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "input line 2 is") {
+		t.Errorf("recent errors %+v, want the long line named", errs)
+	}
+}
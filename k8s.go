@@ -0,0 +1,83 @@
+//go:build k8s
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// podLogHeader is the header of the CSV a pod log is turned into, that of
+// the log export
+var podLogHeader = []string{"Date", "Pod Name", "@processKey", "Message"}
+
+// openPodLog streams the log of a container of a running pod through the
+// Kubernetes API, as CSV in the format of the log export. The cluster is
+// reached with the ambient configuration: $KUBECONFIG or ~/.kube/config,
+// and the in-cluster service account otherwise. An empty namespace is that
+// of the current context.
+func openPodLog(ctx context.Context, namespace, pod, container string) (io.ReadCloser, error) {
+	kubeconfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+	restConfig, err := kubeconfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes config: %w", err)
+	}
+	if namespace == "" {
+		if namespace, _, err = kubeconfig.Namespace(); err != nil {
+			return nil, fmt.Errorf("kubernetes namespace: %w", err)
+		}
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes client: %w", err)
+	}
+	return streamPodLog(ctx, client, namespace, pod, container)
+}
+
+// streamPodLog streams the log of the pod as CSV. The log is read up to its
+// current end, not followed.
+func streamPodLog(ctx context.Context, client kubernetes.Interface, namespace, pod, container string) (io.ReadCloser, error) {
+	opts := &corev1.PodLogOptions{Container: container, Timestamps: true}
+	stream, err := client.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("logs of pod %s/%s: %w", namespace, pod, err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(podLogToCSV(pw, stream, pod, container))
+	}()
+	return readerWithCloser{ReadCloser: pr, closer: stream}, nil
+}
+
+// podLogToCSV writes the lines of a pod log, each prefixed with its
+// timestamp by the API, as rows of the log export: the timestamp, the pod,
+// the container as process key, and the rest of the line as the message
+func podLogToCSV(w io.Writer, r io.Reader, pod, container string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(podLogHeader)
+	br := bufio.NewReaderSize(r, logBufferSize)
+	for {
+		line, err := br.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			date, message, _ := strings.Cut(line, " ")
+			cw.Write([]string{date, pod, container, message})
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
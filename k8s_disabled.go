@@ -0,0 +1,14 @@
+//go:build !k8s
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// openPodLog needs the Kubernetes client, which the k8s build tag adds
+func openPodLog(ctx context.Context, namespace, pod, container string) (io.ReadCloser, error) {
+	return nil, errors.New("-k8s-pod: built without Kubernetes support (rebuild with -tags k8s)")
+}
@@ -0,0 +1,67 @@
+//go:build k8s
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestPodLog(t *testing.T) {
+	match, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	podLog := "2025-10-15T17:32:48.521123456Z ERR Isolated retry still failed retryErr=\"E11000 duplicate key error collection: db.col index: _id_\" id=\"{\\\"$oid\\\":\\\"" + match.Hex() + "\\\"}\"\n" +
+		"2025-10-15T17:32:49.000000000Z INF batch applied, count=\"100\"\n" +
+		"2025-10-15T17:32:50.000000000Z ERR Isolated retry still failed retryErr=\"E11000 duplicate key error collection: db.col index: _id_\" id=\"{\\\"$oid\\\":\\\"" + missing.Hex() + "\\\"}\"\n"
+
+	// A fake API server serving the log of pod dsync-0, container worker
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v1/namespaces/mig/pods/dsync-0/log" || q.Get("container") != "worker" || q.Get("timestamps") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, podLog)
+	}))
+	defer srv.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := streamPodLog(context.Background(), client, "mig", "dsync-0", "worker")
+	if err != nil {
+		t.Fatalf("streamPodLog: %v", err)
+	}
+	defer rc.Close()
+
+	src, dest := newFakeSource(), newFakeSource()
+	for _, f := range []*fakeSource{src, dest} {
+		f.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	}
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}})
+	c := NewChecker(src, dest)
+	if err := c.Run(context.Background(), rc); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	s := c.StatsMap["db.col"]
+	if c.RowsRead != 3 || s == nil || s.Matches != 1 || s.MissingInDest != 1 {
+		t.Errorf("%d rows, stats %+v; want the two retry failures checked", c.RowsRead, s)
+	}
+	if !strings.HasPrefix(strings.Join(c.Header, ","), "Date,Pod Name") {
+		t.Errorf("header %q, want that of the log export", c.Header)
+	}
+
+	// An unknown pod fails before any line is read
+	if _, err := streamPodLog(context.Background(), client, "mig", "nope", "worker"); err == nil {
+		t.Error("streamPodLog of an unknown pod succeeded")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// ageSampleSize bounds the ages kept to estimate the median; beyond it a
+// uniform random sample of the entries is kept
+const ageSampleSize = 10000
+
+// ageStats is the distribution of the age of log entries when they were
+// checked: the time between the logged write failure and its check. Young
+// entries are the likeliest to be replication lag rather than lost writes.
+type ageStats struct {
+	Count    int
+	Min, Max time.Duration
+	sample   []time.Duration
+}
+
+// add records the age of one entry
+func (a *ageStats) add(age time.Duration) {
+	a.Count++
+	if a.Count == 1 || age < a.Min {
+		a.Min = age
+	}
+	if a.Count == 1 || age > a.Max {
+		a.Max = age
+	}
+	// Reservoir sampling: every entry is kept with probability size/Count
+	if len(a.sample) < ageSampleSize {
+		a.sample = append(a.sample, age)
+	} else if i := rand.IntN(a.Count); i < ageSampleSize {
+		a.sample[i] = age
+	}
+}
+
+// Median returns the median age, estimated from a sample past ageSampleSize
+// entries
+func (a *ageStats) Median() time.Duration {
+	if len(a.sample) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(a.sample)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// jsonAgeStats is the JSON form of ageStats, in seconds
+type jsonAgeStats struct {
+	Count         int     `json:"count"`
+	MinSeconds    float64 `json:"minSeconds"`
+	MedianSeconds float64 `json:"medianSeconds"`
+	MaxSeconds    float64 `json:"maxSeconds"`
+}
+
+func (a *ageStats) json() jsonAgeStats {
+	return jsonAgeStats{Count: a.Count, MinSeconds: a.Min.Seconds(), MedianSeconds: a.Median().Seconds(), MaxSeconds: a.Max.Seconds()}
+}
+
+// recordLogAge records the age of an entry from its logged date, the first
+// column of its row. Dates that do not parse are ignored.
+func (c *Checker) recordLogAge(date string) {
+	t, ok := parseTimestamp(date)
+	if !ok {
+		return
+	}
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	c.LogAge.add(now().Sub(t))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLogAge(t *testing.T) {
+	now := time.Date(2025, 10, 16, 12, 0, 0, 0, time.UTC)
+	var lines []string
+	for _, date := range []string{
+		"2025-10-16T11:59:30Z",     // 30s
+		"2025-10-16T11:00:00.000Z", // 1h
+		"2025-10-16 10:00:00",      // 2h, no zone: UTC
+		"2025-10-15T12:00:00Z",     // 24h
+		"not a date",
+	} {
+		line := logLine("db.col", primitive.NewObjectID())
+		lines = append(lines, date+line[strings.Index(line, ","):])
+	}
+
+	c := NewChecker(newFakeSource(), newFakeSource())
+	c.now = func() time.Time { return now }
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	a := c.LogAge
+	if a.Count != 4 || a.Min != 30*time.Second || a.Max != 24*time.Hour || a.Median() != 90*time.Minute {
+		t.Errorf("got %d entries, min %s, median %s, max %s; want 4, 30s, 1h30m, 24h", a.Count, a.Min, a.Median(), a.Max)
+	}
+
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "Log Entry Age at Check (4 entries): min 30s, median 1h30m0s, max 24h0m0s") {
+		t.Errorf("report missing the age line:\n%s", out.String())
+	}
+	var js bytes.Buffer
+	if err := writeJSONReport(&js, c); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(js.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.LogAge == nil || report.LogAge.MedianSeconds != 5400 {
+		t.Errorf("JSON logAge = %+v, want a median of 5400s", report.LogAge)
+	}
+
+	// Past the sample size the median is estimated, min and max stay exact
+	var big ageStats
+	for i := 1; i <= 3*ageSampleSize; i++ {
+		big.add(time.Duration(i) * time.Second)
+	}
+	if m := big.Median(); m < 12000*time.Second || m > 18000*time.Second || big.Min != time.Second || big.Max != 3*ageSampleSize*time.Second {
+		t.Errorf("sampled: min %s, median %s, max %s", big.Min, m, big.Max)
+	}
+}
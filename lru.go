@@ -0,0 +1,96 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruSet remembers the most recently added keys, up to a fixed capacity.
+// Adding a key beyond capacity evicts the least recently used one.
+type lruSet struct {
+	capacity  int
+	order     *list.List // front = most recently used
+	items     map[string]*list.Element
+	evictions int
+}
+
+func newLRUSet(capacity int) *lruSet {
+	return &lruSet{capacity: capacity, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Add records key as most recently used and reports whether it was already present
+func (s *lruSet) Add(key string) bool {
+	if e, ok := s.items[key]; ok {
+		s.order.MoveToFront(e)
+		return true
+	}
+	s.items[key] = s.order.PushFront(key)
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(string))
+		s.evictions++
+	}
+	return false
+}
+
+// Len returns the number of keys remembered
+func (s *lruSet) Len() int {
+	return s.order.Len()
+}
+
+// diffCache remembers the differences found between pairs of documents,
+// keyed by their content, up to a fixed capacity; the least recently used
+// pair is evicted first. It is safe for concurrent use.
+type diffCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	items    map[string]*list.Element
+	hits     int
+}
+
+type diffCacheEntry struct {
+	key   string
+	diffs []FieldDiff
+}
+
+func newDiffCache(capacity int) *diffCache {
+	return &diffCache{capacity: capacity, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get returns the differences cached under key
+func (c *diffCache) Get(key string) ([]FieldDiff, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	c.hits++
+	return e.Value.(diffCacheEntry).diffs, true
+}
+
+// Put caches diffs under key
+func (c *diffCache) Put(key string, diffs []FieldDiff) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(diffCacheEntry{key: key, diffs: diffs})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(diffCacheEntry).key)
+	}
+}
+
+// Hits returns how many lookups found their pair cached
+func (c *diffCache) Hits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLRUSetEviction(t *testing.T) {
+	s := newLRUSet(2)
+	if s.Add("a") || s.Add("b") {
+		t.Fatal("new keys reported as present")
+	}
+	if !s.Add("a") { // a becomes most recently used
+		t.Error("a not remembered")
+	}
+	s.Add("c") // evicts b, the least recently used
+	if s.Len() != 2 || s.evictions != 1 {
+		t.Errorf("Len = %d, evictions = %d; want 2, 1", s.Len(), s.evictions)
+	}
+	if !s.Add("a") {
+		t.Error("a was evicted instead of b")
+	}
+	if s.Add("b") {
+		t.Error("b still remembered after eviction")
+	}
+}
+
+func TestDedup(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	log := logFile(logLine("db.col", a), logLine("db.col", a), logLine("db.col", b), logLine("db.col", a))
+
+	c := NewChecker(newFakeSource(), newFakeSource())
+	c.DedupCacheSize = 1
+	if err := c.Run(context.Background(), strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	// a, a (duplicate), b (evicts a), a (checked again)
+	if s := c.StatsMap["db.col"]; s.TotalChecks != 3 || s.Duplicates != 1 {
+		t.Errorf("TotalChecks = %d, Duplicates = %d; want 3, 1", s.TotalChecks, s.Duplicates)
+	}
+	if n := c.DedupEvictions(); n != 2 {
+		t.Errorf("DedupEvictions = %d, want 2", n)
+	}
+}
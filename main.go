@@ -2,27 +2,138 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Config holds the application configuration
 type Config struct {
-	LogFile string
-	Source  string
-	Dest    string
+	LogFile       string
+	K8sPod        string
+	K8sNamespace  string
+	K8sContainer  string
+	Source        string
+	Dest          string
+	StateFile     string
+	ForceRecheck  bool
+	Quiet         bool
+	Causal        bool
+	AtClusterTime string
+	AttemptRegex  string
+	IDStrategy    string
+	FilterRegex   string
+	CaseSensitive bool
+	CheckID       string
+	CheckNS       string
+
+	UnorderedArrays      stringList
+	ArrayKeys            stringList
+	SkipEncrypted        bool
+	NumericLoose         bool
+	TimeSeries           stringList
+	GridFS               stringList
+	Capped               stringList
+	MaskFields           stringList
+	MaskStyle            string
+	MaskKeyFile          string
+	MaxLines             int
+	MaxLineBytes         int
+	Precount             bool
+	CategoryRegexes      stringList
+	Compat               string
+	Output               string
+	DumpDocs             bool
+	PrettyDiff           bool
+	RepairScript         string
+	DumpMissing          bool
+	DumpMaxBytes         int
+	SplitOutput          string
+	SkipLog              string
+	ResultsURI           string
+	ResultsCollection    string
+	ReportTemplate       string
+	LookupField          string
+	ExtraFilter          string
+	Version              bool
+	OutFile              string
+	Manifest             string
+	SelfTest             bool
+	SelfTestDB           string
+	SRVTimeout           time.Duration
+	DestPipeline         string
+	AllowSameEndpoint    bool
+	NamespaceColumn      int
+	SearchColumns        string
+	DefaultDB            string
+	CollectionDBMap      string
+	TopN                 int
+	OtelEndpoint         string
+	Mode                 string
+	IDsFile              string
+	FullScan             string
+	FullScanReverse      bool
+	BothMissingStatus    string
+	Direction            string
+	ModifiedSince        string
+	ModifiedField        string
+	CompareMode          string
+	StatsFile            string
+	StatsInterval        time.Duration
+	HealthAddr           string
+	HealthStall          time.Duration
+	ChangeStreamDuration time.Duration
+	ChangeStreamTimeout  time.Duration
+	TimeHistogram        time.Duration
+	DedupCacheSize       int
+	CompareCacheSize     int
+	ErrorBufferSize      int
+	StopOnError          bool
+	FailFast             bool
+	AllowEmpty           bool
+	OnlyStatus           string
+	MinMatchRate         string
+	NSMinMatchRate       stringList
+	RedactDetails        bool
+	RedactNamespaces     bool
+	TimeoutStatus        bool
+	StrictJSON           bool
+	Workers              string
+	MaxWorkers           int
+	Deterministic        bool
+	InterCheckDelay      time.Duration
+	InterCheckJitter     time.Duration
+	CompareRoot          string
+	ChecksumField        string
+	Retries              int
+	RetryBackoff         time.Duration
+	RetryMaxBackoff      time.Duration
+	QueryMaxTime         time.Duration
+	DestArchive          string
+	Collation            string
+	HasHeader            bool
+	SizeReport           bool
+	ConfirmExists        bool
+	Explain              bool
+	Warmup               bool
+
+	// Command is the subcommand run
+	Command string
+
+	// Flags records the value of every flag, for report metadata, and
+	// SetFlags the names of those given on the command line
+	Flags    map[string]string
+	SetFlags []string
 }
 
 // LogEntry represents a row in the CSV
@@ -33,271 +144,1109 @@ type LogEntry struct {
 	Message    string
 }
 
-// CheckResult holds the result of a comparison
-type CheckResult struct {
-	Namespace string
-	ID        interface{}
-	Status    string // "Match", "Mismatch", "MissingInSource", "MissingInDest", "Error"
-	Details   string
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// Values of -mode
+const (
+	modeDocuments    = "documents"
+	modeCounts       = "counts"
+	modeIndexes      = "indexes"
+	modeChangeStream = "changestream"
+)
+
+// Subcommands. Without one, the command line is that of check.
+const (
+	cmdCheck   = "check"
+	cmdExtract = "extract"
+	cmdCounts  = "counts"
+	cmdIndexes = "indexes"
+)
+
+var commands = []struct{ name, summary string }{
+	{cmdCheck, "Compare the documents of the logged ids on both sides (default)"},
+	{cmdExtract, "List the namespace,id pairs of the log, in the -ids-file format, without connecting"},
+	{cmdCounts, "Compare the document counts of the logged namespaces"},
+	{cmdIndexes, "Compare the indexes of the logged namespaces"},
 }
 
-// Stats holds statistics per namespace
-type Stats struct {
-	TotalChecks     int
-	Matches         int
-	Mismatches      int
-	MissingInSource int
-	MissingInDest   int
-	Errors          int
+// printCommands writes the list of subcommands
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Usage: error_checker [command] [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun error_checker <command> -help for the flags of a command.")
 }
 
+// errUsage reports invalid command line usage; the usage line has already been printed
+var errUsage = errors.New("invalid usage")
+
+// errNoMatches reports that no line of the log matched the filter, so that a
+// broken pattern is not mistaken for a clean run
+var errNoMatches = errors.New("no log line matched the filter; nothing was checked (-allow-empty accepts this)")
+
 func main() {
-	// Parse flags
-	configFile := flag.String("logfile", "", "Path to the CSV log file")
-	sourceURI := flag.String("source", "", "Source MongoDB connection string")
-	destURI := flag.String("dest", "", "Destination MongoDB connection string")
-	flag.Parse()
-
-	if *configFile == "" || *sourceURI == "" || *destURI == "" {
-		fmt.Println("Usage: error_checker -logfile <path> -source <uri> -dest <uri>")
+	err := run(os.Args[1:], os.Stdout)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.Is(err, errUsage):
 		os.Exit(1)
+	case errors.Is(err, errSignOff):
+		log.Printf("%v", err)
+		os.Exit(2)
+	case errors.Is(err, errNoMatches):
+		log.Printf("%v", err)
+		os.Exit(3)
+	default:
+		log.Fatalf("%v", err)
+	}
+}
+
+// runLogger returns the logger of the progress and warnings of a run: the
+// standard one, or one discarding everything under -quiet. Errors that abort
+// the run are returned, and still reach stderr.
+func runLogger(cfg Config) *log.Logger {
+	if cfg.Quiet {
+		return log.New(io.Discard, "", 0)
+	}
+	return log.Default()
+}
+
+// parseFlags parses the command line of subcommand cmd into a Config
+func parseFlags(cmd string, args []string) (Config, error) {
+	var cfg Config
+	fs := flag.NewFlagSet("error_checker "+cmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: error_checker %s [flags]\n\nFlags:\n", cmd)
+		fs.PrintDefaults()
+	}
+
+	// Flags shared by all commands
+	fs.StringVar(&cfg.LogFile, "logfile", "", "Path to the CSV log file")
+	fs.StringVar(&cfg.K8sPod, "k8s-pod", "", "Read the log of this running pod through the Kubernetes API (ambient kubeconfig or in-cluster config) instead of -logfile")
+	fs.StringVar(&cfg.K8sNamespace, "k8s-namespace", "", "Kubernetes namespace of -k8s-pod (default: that of the current context)")
+	fs.StringVar(&cfg.K8sContainer, "k8s-container", "", "Container of -k8s-pod whose log is read (default: the pod's only container)")
+	fs.BoolVar(&cfg.HasHeader, "has-header", true, "The first row of the log is a header; set to false for headerless logs")
+	fs.IntVar(&cfg.MaxLines, "max-lines", 0, "Stop reading the log after this many data rows (0 = no limit)")
+	fs.IntVar(&cfg.MaxLineBytes, "max-line-bytes", defaultMaxLineBytes, "Skip, with a warning naming it, any log line longer than this many bytes (0 = no limit)")
+	fs.StringVar(&cfg.SearchColumns, "search-columns", "", "Comma separated zero-based CSV columns whose values, joined with spaces, are searched for the namespace and id instead of the message column, e.g. 3,4")
+	fs.StringVar(&cfg.DefaultDB, "default-db", "", "Database of the collections the log names without one (collection: col2), unless -collection-db-map maps them")
+	fs.StringVar(&cfg.CollectionDBMap, "collection-db-map", "", "File mapping the collections the log names without a database to theirs, one collection,db pair per line")
+	fs.IntVar(&cfg.NamespaceColumn, "namespace-column", -1, "Zero-based CSV column holding the namespace (db.collection), instead of extracting it from the message")
+	fs.StringVar(&cfg.FilterRegex, "filter-regex", "", "Regex selecting the messages to check, instead of the \"Isolated retry still failed\" marker; its own flags such as (?i) and (?s) apply")
+	fs.BoolVar(&cfg.CaseSensitive, "case-sensitive", false, "Match the \"Isolated retry still failed\" marker in its exact case only")
+	fs.StringVar(&cfg.IDStrategy, "id-strategy", defaultIDStrategy, "How the id is read from a message: json, oid, uuid, int, string, auto (each in that order) or regex:<pattern> (first group)")
+	fs.StringVar(&cfg.OutFile, "outfile", "", "Write the report to this file instead of stdout; a .gz suffix compresses it")
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "Suppress intermediate logging and print only the final report")
+	fs.BoolVar(&cfg.Version, "version", false, "Print version and build information, then exit")
+
+	// Flags of the commands that connect to both sides
+	if cmd != cmdExtract {
+		fs.StringVar(&cfg.Source, "source", "", "Source MongoDB connection string")
+		fs.StringVar(&cfg.Dest, "dest", "", "Destination MongoDB connection string")
+		fs.BoolVar(&cfg.Causal, "causal-consistency", false, "Read through causally consistent sessions with majority read concern")
+		fs.StringVar(&cfg.Compat, "compat", compatMongoDB, "Server compatibility mode: mongodb or documentdb")
+		fs.DurationVar(&cfg.SRVTimeout, "srv-timeout", 10*time.Second, "Timeout for resolving mongodb+srv:// seed lists")
+		fs.BoolVar(&cfg.AllowSameEndpoint, "allow-same-endpoint", false, "Run even if -source and -dest point at the same cluster")
+		fs.StringVar(&cfg.Output, "output", "text", "Report format: text or json")
+		fs.StringVar(&cfg.Manifest, "manifest", "", "Write the configuration of the run (flags with credentials redacted, version, input hash, start time) to this JSON file")
+		fs.BoolVar(&cfg.Warmup, "warmup", true, "Before checking, ping each cluster a few times and list the collections of its databases, so server selection and connection pools are settled when the first lookups run")
+		fs.DurationVar(&cfg.QueryMaxTime, "query-max-time", 30*time.Second, "Server-side time limit (maxTimeMS) of each query (0 = none)")
+	}
+
+	if cmd == cmdCheck {
+		fs.BoolVar(&cfg.SelfTest, "selftest", false, "Seed known-divergent documents, check a synthetic log of them end to end and fail unless the expected results come out; in memory, or in throwaway databases with -source and -dest")
+		fs.StringVar(&cfg.SelfTestDB, "selftest-db", defaultSelfTestDB, "Prefix of the throwaway databases of -selftest (<prefix>_src and <prefix>_dest), which must be empty and are dropped afterwards")
+		fs.StringVar(&cfg.FullScan, "full-scan-namespace", "", "Check every document of this namespace (db.collection), scanning the source _ids with a cursor, instead of reading a log")
+		fs.BoolVar(&cfg.FullScanReverse, "full-scan-reverse", false, "With -full-scan-namespace, also scan the dest _ids to find the documents only dest has")
+		fs.StringVar(&cfg.IDsFile, "ids-file", "", "Check the ids listed in this file, one namespace,id pair per line, instead of reading a log")
+		fs.StringVar(&cfg.StateFile, "state-file", "", "Incremental mode: sidecar file recording results of previous runs")
+		fs.BoolVar(&cfg.ForceRecheck, "force-recheck", false, "Incremental mode: re-check ids previously confirmed as Match")
+		fs.StringVar(&cfg.AttemptRegex, "attempt-regex", defaultAttemptPattern, "Regex whose first group captures the retry attempt number in a message")
+		fs.StringVar(&cfg.AtClusterTime, "at-cluster-time", "", "Read both sides as of this cluster time with snapshot reads (MongoDB 5.0+ replica sets and sharded clusters): <seconds>,<increment>, Timestamp(...), {\"$timestamp\":...} or an RFC 3339 time")
+		fs.StringVar(&cfg.CheckID, "check-id", "", "Check a single id (ObjectID hex or Extended JSON) instead of reading a log")
+		fs.StringVar(&cfg.CheckNS, "check-ns", "", "Namespace (db.collection) of the id given with -check-id")
+		fs.Var(&cfg.Capped, "capped", "Capped collection, <db.collection>, reconciled by diffing the _ids both sides hold instead of checking its logged ids; ids one side holds outside the window both hold are OutsideCapWindow (repeatable)")
+		fs.Var(&cfg.GridFS, "gridfs", "GridFS bucket, <db.bucket>, whose files logged under <db.bucket>.files are also compared chunk by chunk, by hash (repeatable)")
+		fs.Var(&cfg.TimeSeries, "timeseries", "Time-series namespace whose log lines are checked by measurement: <db.collection>=<timeField>[,<metaField>] (repeatable)")
+		fs.BoolVar(&cfg.NumericLoose, "numeric-loose", false, "Treat numbers of equal value as equal whatever their types (int32, int64, double, decimal128), e.g. int32 1 and double 1.0")
+		fs.BoolVar(&cfg.SkipEncrypted, "skip-encrypted", false, "Leave CSFLE-encrypted values (binary subtype 6), whose ciphertext differs between clusters, out of the comparison")
+		fs.Var(&cfg.ArrayKeys, "array-key", "Array of subdocuments whose elements are matched by a key field rather than by index: <path>=<field>, e.g. items=sku (repeatable)")
+		fs.Var(&cfg.UnorderedArrays, "unordered-array-field", "Array field path compared as a multiset, ignoring element order (repeatable)")
+		fs.Var(&cfg.CategoryRegexes, "category-regex", "Regex whose first group captures the error category of a message; tried in order (repeatable, replaces the defaults)")
+		fs.StringVar(&cfg.Mode, "mode", modeDocuments, "What to verify: documents, counts or indexes (same as the counts and indexes commands), or changestream to tail the change streams of the logged namespaces on both sides")
+		fs.DurationVar(&cfg.ChangeStreamDuration, "changestream-duration", defaultChangeStreamDuration, "With -mode changestream, how long source changes are taken in")
+		fs.DurationVar(&cfg.ChangeStreamTimeout, "changestream-timeout", defaultChangeStreamTimeout, "With -mode changestream, how long a source change may take to appear on dest before it is reported dropped")
+		fs.BoolVar(&cfg.DumpDocs, "dump-docs", false, "Include the full source and dest documents of each Mismatch in the report")
+		fs.StringVar(&cfg.RepairScript, "emit-repair-script", "", "Write a mongosh script inserting or replacing the dest documents of MissingInDest and Mismatch results, for review; nothing is written during the run")
+		fs.BoolVar(&cfg.PrettyDiff, "pretty-diff", false, "Show each Mismatch as a unified diff of the canonical Extended JSON documents (colored on a terminal)")
+		fs.BoolVar(&cfg.DumpMissing, "dump-missing", false, "With -dump-docs, also include the existing document of MissingInSource/MissingInDest results")
+		fs.BoolVar(&cfg.Precount, "precount", false, "Count the log lines to check in a first pass before the run, instead of estimating them from the log size")
+		fs.StringVar(&cfg.ReportTemplate, "report-template", "", "Render the text report with this Go text/template file instead of the built-in format")
+		fs.StringVar(&cfg.SkipLog, "skip-log", "", "Write the line number and reason code (SKIP_FILTERED, SKIP_NO_NS, SKIP_ID_PARSE...) of every skipped log line to this CSV file")
+		fs.StringVar(&cfg.SplitOutput, "split-output", "", "Directory where results are also streamed into mismatches.json, missing-in-dest.json, missing-in-source.json, errors.json and other.json")
+		fs.StringVar(&cfg.ResultsURI, "results-uri", "", "MongoDB connection string of the cluster -results-collection is on")
+		fs.StringVar(&cfg.ResultsCollection, "results-collection", "", "Namespace (db.collection) every result is inserted into, with the run id and a timestamp, for tracking drift across runs")
+		fs.IntVar(&cfg.DumpMaxBytes, "dump-max-bytes", 64*1024, "Largest BSON document size dumped in full; larger ones are replaced by a size marker (0 = no cap)")
+		fs.Var(&cfg.MaskFields, "mask-field", "Field path whose values are hidden in every report output; comparison still uses the real values (repeatable)")
+		fs.StringVar(&cfg.MaskStyle, "mask-style", maskFixed, "How masked values are shown: fixed (\""+maskToken+"\") or hash (an HMAC-SHA256 prefix, keyed per run unless -mask-key-file is set)")
+		fs.StringVar(&cfg.MaskKeyFile, "mask-key-file", "", "File holding the secret key of -mask-style hash, so that hashes compare across runs")
+		fs.StringVar(&cfg.Collation, "collation", "", "Treat strings equal under this collation as equal: <locale>,<strength> (e.g. en,2 ignores case)")
+		fs.BoolVar(&cfg.Explain, "explain", false, "Explain the lookup of the first id of every namespace on both sides, reporting the plan and warning of collection scans")
+		fs.BoolVar(&cfg.ConfirmExists, "confirm-exists-count", false, "Count the documents matching each id on both sides and report DuplicateId when _id is not unique")
+		fs.BoolVar(&cfg.SizeReport, "size-report", false, "Report per-namespace totals and deltas of source and dest document sizes")
+		fs.StringVar(&cfg.CompareRoot, "compare-root", "", "Dotted path of the subdocument compared instead of the whole document")
+		fs.StringVar(&cfg.ChecksumField, "checksum-field", "", "Dotted path of a checksum stored in the documents; only it is fetched and compared")
+		fs.StringVar(&cfg.LookupField, "lookup-field", "_id", "Document field the logged id is matched against")
+		fs.StringVar(&cfg.ExtraFilter, "extra-filter", "", "Extended JSON query AND-ed with every lookup, e.g. '{\"status\":\"active\"}'; documents it excludes on both sides are reported as Match")
+		fs.StringVar(&cfg.CompareMode, "compare-mode", compareDeep, "How documents found on both sides are compared: deep (field by field, ignoring field order) or bytes (byte-identical, so reordered fields are a Mismatch)")
+		fs.StringVar(&cfg.ModifiedSince, "modified-since", "", "Check only the documents whose -modified-field is at or after this time (RFC 3339) on the source side; older ones are reported as SkippedOld without querying dest")
+		fs.StringVar(&cfg.ModifiedField, "modified-field", "", "Dotted path of the date or timestamp field recording when a document was last modified, for -modified-since")
+		fs.StringVar(&cfg.Direction, "direction", directionBoth, "Authoritative side: both, or source to report documents missing from the source as NotInSource without querying dest")
+		fs.StringVar(&cfg.BothMissingStatus, "both-missing-status", bothMissingMatch, "Classification of a document missing from both sides: match, discrepancy (Mismatch) or separate-status (MissingInBoth)")
+		fs.DurationVar(&cfg.TimeHistogram, "time-histogram", 0, "Report how many checked log entries were logged in each bucket of this length, e.g. 1h or 10m (0 = no histogram)")
+		fs.StringVar(&cfg.HealthAddr, "health-addr", "", "Address (e.g. :8080) to serve /healthz (failing once the run stalls) and /readyz (failing while a cluster does not answer) on during the run")
+		fs.DurationVar(&cfg.HealthStall, "health-stall", 5*time.Minute, "How long the run may go without reading a row or checking an id before /healthz fails")
+		fs.StringVar(&cfg.StatsFile, "stats-file", "", "Periodically rewrite this file with the current per-namespace statistics as JSON")
+		fs.DurationVar(&cfg.StatsInterval, "stats-interval", 10*time.Second, "How often -stats-file is rewritten")
+		fs.StringVar(&cfg.DestArchive, "dest-archive", "", "Look dest documents up in a mongodump directory or .bson file instead of a live cluster (replaces -dest)")
+		fs.StringVar(&cfg.DestPipeline, "dest-pipeline", "", "File with aggregation stages (Extended JSON array) applied to dest documents before comparison")
+		fs.IntVar(&cfg.Retries, "retries", 3, "Retries of a lookup that failed with a network or timeout error")
+		fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", 100*time.Millisecond, "Base delay before a retry; doubles per retry, with full jitter")
+		fs.DurationVar(&cfg.RetryMaxBackoff, "retry-max-backoff", 5*time.Second, "Longest delay before a retry")
+		fs.IntVar(&cfg.CompareCacheSize, "compare-cache-size", 0, "Number of document pairs whose differences are remembered by content, so that pairs with the same content (ids aside) are not compared again (0 = no cache)")
+		fs.IntVar(&cfg.DedupCacheSize, "dedup-cache-size", 0, "Check an id logged several times once, remembering this many recently checked ids (0 = no dedup)")
+		fs.StringVar(&cfg.Workers, "workers", "1", "Number of ids checked concurrently, or auto to size the pool from query latency and error rate")
+		fs.BoolVar(&cfg.Deterministic, "deterministic", false, "Record the results of concurrent workers in input order, so that the report lists them as a single worker would")
+		fs.IntVar(&cfg.MaxWorkers, "max-workers", defaultMaxWorkers, "Largest pool -workers auto may grow to")
+		fs.DurationVar(&cfg.InterCheckDelay, "inter-check-delay", 0, "Pause of each worker between two checks, to smooth the query load (0 = none)")
+		fs.DurationVar(&cfg.InterCheckJitter, "inter-check-jitter", 0, "Random extra pause of up to this long added to -inter-check-delay")
+		fs.BoolVar(&cfg.StrictJSON, "strict-json", false, "Stop the run, and exit non-zero, at the first id found in a line but not parsable, instead of counting it as unparsable and going on")
+		fs.BoolVar(&cfg.TimeoutStatus, "compare-timeout-result", false, "Report lookups that timed out (deadline or -query-max-time exceeded) as Timeout, counted apart from Errors")
+		fs.BoolVar(&cfg.RedactDetails, "redact-details", false, "Scrub host names, IP addresses and ports from the details of errors in the report, for sharing it; the log keeps them")
+		fs.BoolVar(&cfg.RedactNamespaces, "redact-namespaces", false, "With -redact-details, also scrub the namespace from the details of errors")
+		fs.StringVar(&cfg.MinMatchRate, "min-match-rate", "", "Match rate, in percent (e.g. 99.99), every namespace must reach; the report gives each a pass or fail and the run exits with status 2 if any fails")
+		fs.Var(&cfg.NSMinMatchRate, "ns-min-match-rate", "Match rate a namespace must reach, overriding -min-match-rate: <db.collection>=<percent> (repeatable); a namespace absent from the log fails")
+		fs.StringVar(&cfg.OnlyStatus, "only-status", "", "Comma separated statuses whose results are listed in the report and -split-output, e.g. mismatch,missing_dest; all are still counted")
+		fs.BoolVar(&cfg.FailFast, "fail-fast", false, "Stop and exit non-zero at the first discrepancy, reporting it alone: a quick drift gate for CI")
+		fs.BoolVar(&cfg.AllowEmpty, "allow-empty", false, "Exit 0 when no log line matches the filter, instead of warning and exiting with status 3")
+		fs.BoolVar(&cfg.StopOnError, "stop-on-error", false, "Stop with a partial report at the first check failing because a cluster is unreachable (after retries); by default such checks are recorded as errors and the run goes on")
+		fs.IntVar(&cfg.ErrorBufferSize, "error-buffer", defaultErrorBufferSize, "Number of most recent errors listed under Recent Errors in the report (0 = none)")
+		fs.IntVar(&cfg.TopN, "top-n", 10, "Number of namespaces listed under Top Offenders")
+		fs.StringVar(&cfg.OtelEndpoint, "otel-endpoint", "", "OTLP/HTTP endpoint URL (e.g. http://localhost:4318) to export trace spans to")
+	}
+
+	err := fs.Parse(args)
+	cfg.Flags = make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		if strings.Contains(v, "://") {
+			v = redactURI(v)
+		}
+		cfg.Flags[f.Name] = v
+	})
+	fs.Visit(func(f *flag.Flag) {
+		cfg.SetFlags = append(cfg.SetFlags, f.Name)
+	})
+	return cfg, err
+}
+
+// reportMetadata returns the JSON report metadata of a run starting now
+func reportMetadata(cfg Config) jsonMetadata {
+	meta := newJSONMetadata()
+	meta.Source = redactURI(cfg.Source)
+	meta.Dest = redactURI(cfg.Dest)
+	if cfg.DestArchive != "" {
+		meta.Dest = cfg.DestArchive
+	}
+	meta.Flags = cfg.Flags
+	return meta
+}
+
+// run executes the tool with the given command line arguments
+func run(args []string, stdout io.Writer) error {
+	cmd := cmdCheck
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case cmdCheck, cmdExtract, cmdCounts, cmdIndexes:
+	case "help":
+		printCommands(stdout)
+		return nil
+	default:
+		fmt.Fprintf(stdout, "Unknown command %q\n\n", cmd)
+		printCommands(stdout)
+		return errUsage
+	}
+
+	cfg, err := parseFlags(cmd, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	cfg.Command = cmd
+
+	if cfg.Version {
+		fmt.Fprintln(stdout, currentBuild())
+		return nil
+	}
+
+	if cfg.SelfTest {
+		return runSelfTest(cfg, stdout)
+	}
+
+	switch cmd {
+	case cmdExtract:
+		return runExtract(cfg, stdout)
+	case cmdCounts:
+		cfg.Mode = modeCounts
+	case cmdIndexes:
+		cfg.Mode = modeIndexes
+	}
+	return runCheck(cfg, stdout)
+}
+
+// runExtract runs the extract command
+func runExtract(cfg Config, stdout io.Writer) error {
+	if cfg.LogFile == "" && cfg.K8sPod == "" {
+		fmt.Fprintln(stdout, "Usage: error_checker extract -logfile <path>")
+		return errUsage
+	}
+	f, err := openLog(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+	defer f.Close()
+
+	out, err := openOutput(cfg.OutFile, stdout)
+	if err != nil {
+		return fmt.Errorf("cannot open output: %w", err)
+	}
+	defer out.Close()
+
+	checker := NewChecker(nil, nil)
+	checker.MaxLines = cfg.MaxLines
+	checker.MaxLineBytes = cfg.MaxLineBytes
+	checker.HasHeader = cfg.HasHeader || cfg.K8sPod != ""
+	checker.NamespaceColumn = cfg.NamespaceColumn
+	if checker.SearchColumns, err = parseColumns(cfg.SearchColumns); err != nil {
+		return fmt.Errorf("invalid -search-columns: %w", err)
+	}
+	checker.DefaultDB = cfg.DefaultDB
+	if checker.CollectionDBs, err = collectionDBsOf(cfg); err != nil {
+		return err
+	}
+	checker.IDExtractor, err = newIDExtractor(cfg.IDStrategy)
+	if err != nil {
+		return fmt.Errorf("invalid -id-strategy: %w", err)
+	}
+	if checker.LineFilter, err = lineFilterOf(cfg); err != nil {
+		return err
+	}
+	checker.Logger = runLogger(cfg)
+	if err := checker.Extract(f, out); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// runCheck runs the commands that connect to both sides: check, counts and
+// indexes. cfg.Mode selects what is verified.
+func runCheck(cfg Config, stdout io.Writer) error {
+	meta := reportMetadata(cfg)
+	singleCheck := cfg.CheckID != "" || cfg.CheckNS != ""
+	if singleCheck && (cfg.CheckID == "" || cfg.CheckNS == "") {
+		fmt.Fprintln(stdout, "Usage: error_checker -check-ns <db.collection> -check-id <id> -source <uri> -dest <uri>")
+		return errUsage
+	}
+	if (!singleCheck && cfg.LogFile == "" && cfg.K8sPod == "" && cfg.IDsFile == "" && cfg.FullScan == "") || cfg.Source == "" || (cfg.Dest == "") == (cfg.DestArchive == "") {
+		fmt.Fprintln(stdout, "Usage: error_checker [check|counts|indexes] -logfile <path> -source <uri> -dest <uri>")
+		return errUsage
+	}
+	if cfg.IDsFile != "" && (cfg.LogFile != "" || cfg.K8sPod != "" || singleCheck) {
+		return fmt.Errorf("-ids-file cannot be combined with -logfile, -k8s-pod or -check-id")
+	}
+	if cfg.K8sPod != "" && singleCheck {
+		return fmt.Errorf("-k8s-pod cannot be combined with -check-id")
+	}
+	if cfg.FullScan != "" {
+		switch {
+		case cfg.LogFile != "" || cfg.K8sPod != "" || cfg.IDsFile != "" || singleCheck:
+			return fmt.Errorf("-full-scan-namespace cannot be combined with -logfile, -k8s-pod, -ids-file or -check-id")
+		case !validNamespace(cfg.FullScan):
+			return fmt.Errorf("invalid -full-scan-namespace %q: want db.collection", cfg.FullScan)
+		case cfg.Mode != modeDocuments || cfg.LookupField != "_id":
+			return fmt.Errorf("-full-scan-namespace checks documents by _id and requires -mode %s and -lookup-field _id", modeDocuments)
+		case cfg.FullScanReverse && cfg.DestArchive != "":
+			return fmt.Errorf("-full-scan-reverse cannot scan a -dest-archive")
+		}
+	} else if cfg.FullScanReverse {
+		return fmt.Errorf("-full-scan-reverse requires -full-scan-namespace")
+	}
+	if len(cfg.Capped) > 0 {
+		switch {
+		case cfg.FullScan != "" || cfg.DestArchive != "" || singleCheck:
+			return fmt.Errorf("-capped cannot be combined with -full-scan-namespace, -dest-archive or -check-id")
+		case cfg.Mode != modeDocuments || cfg.LookupField != "_id":
+			return fmt.Errorf("-capped diffs _ids and requires -mode %s and -lookup-field _id", modeDocuments)
+		}
+		for _, ns := range cfg.Capped {
+			if !validNamespace(ns) {
+				return fmt.Errorf("invalid -capped %q: want db.collection", ns)
+			}
+		}
+	}
+	if cfg.RedactNamespaces && !cfg.RedactDetails {
+		return fmt.Errorf("-redact-namespaces requires -redact-details")
+	}
+
+	switch cfg.Mode {
+	case modeDocuments:
+		switch cfg.BothMissingStatus {
+		case bothMissingMatch, bothMissingDiscrepancy, bothMissingSeparate:
+		default:
+			return fmt.Errorf("invalid -both-missing-status %q: must be %s, %s or %s", cfg.BothMissingStatus, bothMissingMatch, bothMissingDiscrepancy, bothMissingSeparate)
+		}
+		if cfg.Direction != directionBoth && cfg.Direction != directionSource {
+			return fmt.Errorf("invalid -direction %q: must be %s or %s", cfg.Direction, directionBoth, directionSource)
+		}
+		switch cfg.CompareMode {
+		case compareDeep:
+		case compareBytes:
+			if len(cfg.UnorderedArrays) > 0 || len(cfg.ArrayKeys) > 0 || cfg.Collation != "" || cfg.SkipEncrypted || cfg.NumericLoose || cfg.CompareRoot != "" || cfg.ChecksumField != "" {
+				return fmt.Errorf("-compare-mode bytes requires byte-identical documents and cannot be combined with -unordered-array-field, -array-key, -collation, -skip-encrypted, -numeric-loose, -compare-root or -checksum-field")
+			}
+		default:
+			return fmt.Errorf("invalid -compare-mode %q: must be %s or %s", cfg.CompareMode, compareDeep, compareBytes)
+		}
+	case modeCounts, modeIndexes, modeChangeStream:
+		if cfg.IDsFile != "" || singleCheck {
+			return fmt.Errorf("-ids-file and -check-id cannot be used with -mode %s", cfg.Mode)
+		}
+		if cfg.Mode == modeChangeStream {
+			if cfg.DestArchive != "" {
+				return fmt.Errorf("-mode %s tails a live dest and cannot be used with -dest-archive", cfg.Mode)
+			}
+			if cfg.ChangeStreamDuration <= 0 || cfg.ChangeStreamTimeout <= 0 {
+				return fmt.Errorf("-changestream-duration and -changestream-timeout must be positive")
+			}
+		}
+	default:
+		return fmt.Errorf("invalid -mode %q: must be %s, %s, %s or %s", cfg.Mode, modeDocuments, modeCounts, modeIndexes, modeChangeStream)
+	}
+	if cfg.Output != "text" && cfg.Output != "json" {
+		return fmt.Errorf("invalid -output %q: must be text or json", cfg.Output)
+	}
+	reportTmpl := defaultReport
+	if cfg.ReportTemplate != "" {
+		if cfg.Output != "text" {
+			return fmt.Errorf("-report-template renders the text report and requires -output text")
+		}
+		tmpl, err := loadReportTemplate(cfg.ReportTemplate)
+		if err != nil {
+			return err
+		}
+		reportTmpl = tmpl
+	}
+	if cfg.Compat != compatMongoDB && cfg.Compat != compatDocumentDB {
+		return fmt.Errorf("invalid -compat %q: must be %s or %s", cfg.Compat, compatMongoDB, compatDocumentDB)
+	}
+	if cfg.Compat == compatDocumentDB && cfg.Causal {
+		return fmt.Errorf("-causal-consistency is not supported with -compat %s", compatDocumentDB)
+	}
+	workers, autoWorkers, err := parseWorkers(cfg.Workers)
+	if err != nil {
+		return err
+	}
+	if cfg.Causal && (autoWorkers || workers > 1) {
+		return fmt.Errorf("-causal-consistency reads through a single session and requires -workers 1")
+	}
+	var atClusterTime primitive.Timestamp
+	if cfg.AtClusterTime != "" {
+		if atClusterTime, err = parseClusterTime(cfg.AtClusterTime); err != nil {
+			return fmt.Errorf("invalid -at-cluster-time: %w", err)
+		}
+		switch {
+		case cfg.Causal:
+			return fmt.Errorf("-at-cluster-time and -causal-consistency cannot be combined")
+		case cfg.Compat == compatDocumentDB:
+			return fmt.Errorf("-at-cluster-time is not supported with -compat %s", compatDocumentDB)
+		case autoWorkers || workers > 1:
+			return fmt.Errorf("-at-cluster-time reads through a single session and requires -workers 1")
+		}
+	}
+	if cfg.DestArchive != "" && (cfg.DestPipeline != "" || cfg.LookupField != "_id" || cfg.ExtraFilter != "") {
+		return fmt.Errorf("-dest-archive supports only _id lookups without -dest-pipeline or -extra-filter")
+	}
+	if cfg.ChecksumField != "" && (cfg.CompareRoot != "" || cfg.RepairScript != "" || cfg.SizeReport || len(cfg.TimeSeries) > 0 || len(cfg.GridFS) > 0) {
+		return fmt.Errorf("-checksum-field fetches only the checksum and cannot be combined with -compare-root, -emit-repair-script, -size-report, -timeseries or -gridfs")
+	}
+	if (cfg.ResultsURI == "") != (cfg.ResultsCollection == "") {
+		return fmt.Errorf("-results-uri and -results-collection must be given together")
+	}
+	if cfg.ResultsCollection != "" && !validNamespace(cfg.ResultsCollection) {
+		return fmt.Errorf("invalid -results-collection %q: must be db.collection", cfg.ResultsCollection)
+	}
+	var extraFilter bson.M
+	if cfg.ExtraFilter != "" {
+		if extraFilter, err = parseExtraFilter(cfg.ExtraFilter, cfg.LookupField); err != nil {
+			return fmt.Errorf("invalid -extra-filter: %w", err)
+		}
+	}
+
+	if err := validateURIs(cfg); err != nil {
+		return err
+	}
+	logger := runLogger(cfg)
+	if cfg.DestArchive == "" && sameEndpoint(cfg.Source, cfg.Dest) {
+		if !cfg.AllowSameEndpoint {
+			return fmt.Errorf("-source and -dest point at the same cluster (%s); every check would Match. Pass -allow-same-endpoint to run anyway", redactURI(cfg.Source))
+		}
+		logger.Printf("WARNING: -source and -dest point at the same cluster (%s)", redactURI(cfg.Source))
 	}
 
 	// Connect to MongoDBs
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	srcClient, err := connectMongo(ctx, *sourceURI)
+	srcClient, err := connectMongo(ctx, cfg.Source, cfg.Compat, cfg.SRVTimeout)
 	if err != nil {
-		log.Fatalf("Failed to connect to source: %v", err)
+		return connectError("source", err)
 	}
 	defer srcClient.Disconnect(context.Background())
+	if cfg.Warmup {
+		warmUp(context.Background(), logger, "source", clientTarget{srcClient})
+	}
+	healthClusters := map[string]pinger{"source": clientTarget{srcClient}}
 
-	destClient, err := connectMongo(ctx, *destURI)
+	src, err := openMongoSource(ctx, srcClient, cfg.Causal, cfg.AtClusterTime != "", atClusterTime)
 	if err != nil {
-		log.Fatalf("Failed to connect to destination: %v", err)
+		return fmt.Errorf("source: %w", err)
+	}
+	defer src.close(context.Background())
+	src.maxTime = cfg.QueryMaxTime
+	if cfg.ChecksumField != "" {
+		src.projection = checksumProjection(cfg.ChecksumField, cfg.LookupField)
+		if cfg.ModifiedField != "" {
+			src.projection = append(src.projection, bson.E{Key: cfg.ModifiedField, Value: 1})
+		}
 	}
-	defer destClient.Disconnect(context.Background())
 
-	// Open CSV
-	f, err := os.Open(*configFile)
-	if err != nil {
-		log.Fatalf("Cannot open log file: %v", err)
+	var destSource docSource
+	var destScan idScanner
+	var destCollations collationLister
+	var destExplain explainer
+	if cfg.DestArchive != "" {
+		archive, err := newArchiveSource(cfg.DestArchive)
+		if err != nil {
+			return err
+		}
+		defer archive.close()
+		destSource = archive
+	} else {
+		destClient, err := connectMongo(ctx, cfg.Dest, cfg.Compat, cfg.SRVTimeout)
+		if err != nil {
+			return connectError("destination", err)
+		}
+		defer destClient.Disconnect(context.Background())
+		if cfg.Warmup {
+			warmUp(context.Background(), logger, "destination", clientTarget{destClient})
+		}
+		healthClusters["dest"] = clientTarget{destClient}
+
+		dest, err := openMongoSource(ctx, destClient, cfg.Causal, cfg.AtClusterTime != "", atClusterTime)
+		if err != nil {
+			return fmt.Errorf("destination: %w", err)
+		}
+		defer dest.close(context.Background())
+		dest.maxTime = cfg.QueryMaxTime
+		dest.projection = src.projection
+		// -full-scan-reverse and -capped, which exclude each other
+		if cfg.FullScanReverse || len(cfg.Capped) > 0 {
+			destScan = dest
+		}
+		destCollations = dest
+		destExplain = dest
+
+		destSource = dest
+		if cfg.DestPipeline != "" && cfg.Mode == modeDocuments {
+			stages, err := loadPipeline(cfg.DestPipeline)
+			if err != nil {
+				return err
+			}
+			destSource = pipelineSource{docSource: dest, agg: dest, stages: stages}
+		}
 	}
-	defer f.Close()
 
-	reader := csv.NewReader(f)
-	// Read header
-	if _, err := reader.Read(); err != nil {
-		log.Fatalf("Failed to read header: %v", err)
-	}
-
-	// Regex for extraction
-	// Pattern for sample: collection: testshard.col2 ... id="{"$oid":"693885e2f227ce8067db8d33"}"
-	// We need to be careful about the quoting in the CSV message field.
-	// The CSV reader handles the outer quotes. inside message:
-	// val="... collection: <ns> ... id=""<json>"" ..."
-	// Note: The sample showing `id=“{\""$oid...` suggests some smart quotes or mixed quoting might be in play,
-	// but the provided "raw" view showed standard quotes escaped by CSV rules.
-	// Let's assume standard ASCII double quotes for property values.
-
-	nsRegex := regexp.MustCompile(`collection:\s*([a-zA-Z0-9_.]+)`)
-	// Captures the JSON content inside id=""..."" or id="..."
-	// The sample shows id=""{...}"" which implies inside the CSV string it was id="{...}".
-	// Wait, the CSV parser will give us the raw string of the Message column.
-	// In that raw string, it likely looks like: ... id="{...}" ...
-	// The sample line 6 says: ... id=""{\""$oid\"":\""693885e2f227ce8067db8d33\""}"" ...
-	// When Go's CSV reader parses this, it will resolve the double double-quotes.
-	// So the string in memory will be: ... id="{"$oid":"69..."}" ...
-	idRegex := regexp.MustCompile(`id="(\{.*?\})"`)
-
-	statsMap := make(map[string]*Stats)
-	var discrepancyList []CheckResult
-
-	// We shouldn't execute queries sequentially if the file is huge, but for simplicity and safety against rate limits,
-	// let's do sequential or a small worker pool. Sequential is safer for now unless requested otherwise.
-
-	lineNum := 1
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
+	var srcSource docSource = src
+	if cfg.Retries > 0 && cfg.Mode == modeDocuments {
+		b := newBackoff(cfg.RetryBackoff, cfg.RetryMaxBackoff)
+		srcSource = newRetryingSource(srcSource, cfg.Retries, b)
+		if cfg.DestArchive == "" {
+			destSource = newRetryingSource(destSource, cfg.Retries, b)
 		}
+	}
+
+	checker := NewChecker(srcSource, destSource)
+	checker.Logger = logger
+	checker.ForceRecheck = cfg.ForceRecheck
+	if cfg.Explain && cfg.Mode == modeDocuments {
+		checker.Explain = newExplainCheck(src, destExplain)
+	}
+	if destCollations != nil && cfg.Mode == modeDocuments {
+		checker.Collations = newCollationCheck(src, destCollations)
+	}
+	checker.MaxLines = cfg.MaxLines
+	checker.MaxLineBytes = cfg.MaxLineBytes
+	checker.HasHeader = cfg.HasHeader || cfg.K8sPod != ""
+	checker.LookupField = cfg.LookupField
+	checker.ExtraFilter = extraFilter
+	checker.CompareRoot = cfg.CompareRoot
+	checker.ChecksumField = cfg.ChecksumField
+	checker.SizeReport = cfg.SizeReport
+	checker.ConfirmExistsCount = cfg.ConfirmExists
+	checker.NamespaceColumn = cfg.NamespaceColumn
+	if checker.SearchColumns, err = parseColumns(cfg.SearchColumns); err != nil {
+		return fmt.Errorf("invalid -search-columns: %w", err)
+	}
+	checker.DefaultDB = cfg.DefaultDB
+	if checker.CollectionDBs, err = collectionDBsOf(cfg); err != nil {
+		return err
+	}
+	checker.TopN = cfg.TopN
+	checker.BothMissingStatus = cfg.BothMissingStatus
+	checker.Direction = cfg.Direction
+	if (cfg.ModifiedSince == "") != (cfg.ModifiedField == "") {
+		return fmt.Errorf("-modified-since and -modified-field must be given together")
+	}
+	if cfg.ModifiedSince != "" {
+		since, ok := parseTimestamp(cfg.ModifiedSince)
+		if !ok {
+			return fmt.Errorf("invalid -modified-since %q: not a timestamp", cfg.ModifiedSince)
+		}
+		checker.ModifiedSince, checker.ModifiedField = since, cfg.ModifiedField
+	}
+	checker.CompareMode = cfg.CompareMode
+	checker.DedupCacheSize = cfg.DedupCacheSize
+	checker.ErrorBufferSize = cfg.ErrorBufferSize
+	checker.StopOnError = cfg.StopOnError
+	checker.FailFast = cfg.FailFast
+	if cfg.OnlyStatus != "" {
+		if checker.OnlyStatus, err = parseStatuses(cfg.OnlyStatus); err != nil {
+			return fmt.Errorf("invalid -only-status: %w", err)
+		}
+	}
+	if cfg.MinMatchRate != "" {
+		if checker.MinMatchRate, err = parseMatchRate(cfg.MinMatchRate); err != nil {
+			return fmt.Errorf("invalid -min-match-rate: %w", err)
+		}
+	}
+	for _, spec := range cfg.NSMinMatchRate {
+		namespace, rate, err := parseNSMatchRate(spec)
 		if err != nil {
-			log.Printf("Error reading CSV line %d: %v", lineNum, err)
-			continue
+			return fmt.Errorf("invalid -ns-min-match-rate: %w", err)
 		}
-		lineNum++
+		if checker.NSMinMatchRate == nil {
+			checker.NSMinMatchRate = make(map[string]float64)
+		}
+		checker.NSMinMatchRate[namespace] = rate
+	}
+	checker.RedactDetails = cfg.RedactDetails
+	checker.RedactNamespaces = cfg.RedactNamespaces
+	checker.TimeoutStatus = cfg.TimeoutStatus
+	checker.StrictJSON = cfg.StrictJSON
+	checker.Workers, checker.AutoWorkers = workers, autoWorkers
+	checker.MaxWorkers = cfg.MaxWorkers
+	checker.Deterministic = cfg.Deterministic
+	checker.InterCheckDelay = cfg.InterCheckDelay
+	checker.InterCheckJitter = cfg.InterCheckJitter
+	checker.StatsFile = cfg.StatsFile
+	checker.StatsInterval = cfg.StatsInterval
+	if cfg.TimeHistogram < 0 {
+		return fmt.Errorf("invalid -time-histogram %v: must be positive", cfg.TimeHistogram)
+	}
+	if cfg.TimeHistogram > 0 {
+		checker.TimeHistogram = newTimeHistogram(cfg.TimeHistogram)
+	}
+	checker.DumpDocs = cfg.DumpDocs
+	checker.PrettyDiff = cfg.PrettyDiff
+	if f, ok := stdout.(*os.File); ok && cfg.OutFile == "" {
+		checker.Color = isTerminal(f)
+	}
+	checker.DumpMissing = cfg.DumpDocs && cfg.DumpMissing
+	checker.DumpMaxBytes = cfg.DumpMaxBytes
+	if checker.LineFilter, err = lineFilterOf(cfg); err != nil {
+		return err
+	}
+	checker.AttemptRegex, err = regexp.Compile(cfg.AttemptRegex)
+	if err != nil {
+		return fmt.Errorf("invalid -attempt-regex: %w", err)
+	}
+	checker.IDExtractor, err = newIDExtractor(cfg.IDStrategy)
+	if err != nil {
+		return fmt.Errorf("invalid -id-strategy: %w", err)
+	}
+	checker.Compare = newComparer(cfg.UnorderedArrays)
+	checker.Compare.skipEncrypted = cfg.SkipEncrypted
+	checker.Compare.numericLoose = cfg.NumericLoose
+	for _, spec := range cfg.ArrayKeys {
+		path, field, err := parseArrayKey(spec)
+		if err != nil {
+			return fmt.Errorf("invalid -array-key: %w", err)
+		}
+		if checker.Compare.unorderedArrays[path] {
+			return fmt.Errorf("-array-key %s: the array is already compared unordered by -unordered-array-field", path)
+		}
+		checker.Compare.arrayKeys[path] = field
+	}
+	if cfg.CompareCacheSize > 0 {
+		checker.Compare.cache = newDiffCache(cfg.CompareCacheSize)
+	}
+	for _, ts := range cfg.TimeSeries {
+		namespace, spec, err := parseTimeSeriesSpec(ts)
+		if err != nil {
+			return fmt.Errorf("invalid -timeseries: %w", err)
+		}
+		if checker.TimeSeries == nil {
+			checker.TimeSeries = make(map[string]timeSeriesSpec)
+		}
+		checker.TimeSeries[namespace] = spec
+	}
+	for _, ns := range cfg.Capped {
+		if checker.Capped == nil {
+			checker.Capped = make(map[string]bool)
+		}
+		checker.Capped[ns] = true
+	}
+	for _, bucket := range cfg.GridFS {
+		namespace, err := parseGridFSBucket(bucket)
+		if err != nil {
+			return fmt.Errorf("invalid -gridfs: %w", err)
+		}
+		if checker.GridFS == nil {
+			checker.GridFS = make(map[string]bool)
+		}
+		checker.GridFS[namespace] = true
+	}
+	if cfg.Collation != "" {
+		checker.Compare.collator, err = parseCollation(cfg.Collation)
+		if err != nil {
+			return fmt.Errorf("invalid -collation: %w", err)
+		}
+	}
+	var maskKey []byte
+	if cfg.MaskKeyFile != "" {
+		if cfg.MaskStyle != maskHash {
+			return fmt.Errorf("-mask-key-file requires -mask-style %s", maskHash)
+		}
+		data, err := os.ReadFile(cfg.MaskKeyFile)
+		if err != nil {
+			return fmt.Errorf("invalid -mask-key-file: %w", err)
+		}
+		if maskKey = []byte(strings.TrimSpace(string(data))); len(maskKey) == 0 {
+			return fmt.Errorf("invalid -mask-key-file: %s is empty", cfg.MaskKeyFile)
+		}
+	}
+	checker.Compare.mask, err = newMasker(cfg.MaskFields, cfg.MaskStyle, maskKey)
+	if err != nil {
+		return fmt.Errorf("invalid -mask-style: %w", err)
+	}
+	if len(cfg.CategoryRegexes) > 0 {
+		checker.CategoryRegexes, err = compilePatterns(cfg.CategoryRegexes)
+		if err != nil {
+			return fmt.Errorf("invalid -category-regex: %w", err)
+		}
+	}
+	if cfg.OtelEndpoint != "" {
+		tp, err := newTracerProvider(context.Background(), cfg.OtelEndpoint)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tp.Shutdown(ctx); err != nil {
+				logger.Printf("Failed to flush traces: %v", err)
+			}
+		}()
+		checker.Tracer = tp.Tracer("error_checker")
+	}
 
-		message := record[3]
+	manifest := newManifest(cfg.Command, cfg, meta)
+	saveManifest := func(input *hashingReader) error {
+		if cfg.Manifest == "" {
+			return nil
+		}
+		return manifest.write(cfg.Manifest, input)
+	}
 
-		if !strings.Contains(message, "Isolated retry still failed") {
-			continue
+	if singleCheck {
+		res, err := checker.checkOne(context.TODO(), cfg.CheckNS, cfg.CheckID)
+		if err != nil {
+			return err
 		}
+		printResult(stdout, res, checker.Color)
+		return saveManifest(nil)
+	}
 
-		// Extract Namespace
-		nsMatch := nsRegex.FindStringSubmatch(message)
-		if len(nsMatch) < 2 {
-			// Could not find namespace
-			continue
+	// Open CSV, or the ids file; a full scan reads no input
+	var f io.Reader
+	var hashed *hashingReader
+	if cfg.FullScan == "" {
+		input := logName(cfg)
+		var rc io.ReadCloser
+		if cfg.IDsFile != "" {
+			input = cfg.IDsFile
+			rc, err = openInput(context.Background(), input)
+		} else {
+			rc, err = openLog(context.Background(), cfg)
 		}
-		namespace := nsMatch[1]
+		if err != nil {
+			return fmt.Errorf("cannot open input file: %w", err)
+		}
+		defer rc.Close()
+		f = rc
+		if cfg.Manifest != "" {
+			hashed = newHashingReader(rc, redactURI(input))
+			f = hashed
+		}
+	}
 
-		// Extract ID
-		idMatch := idRegex.FindStringSubmatch(message)
-		fmt.Printf("idMatch: %v\n", idMatch)
+	if cfg.LogFile != "" && cfg.Mode == modeDocuments {
+		if err := checker.preflight(context.Background(), cfg.LogFile, cfg.Precount); err != nil {
+			return fmt.Errorf("precount: %w", err)
+		}
+	}
 
-		var idVal interface{}
-		if len(idMatch) >= 2 {
-			idJSON := idMatch[1]
-			// Need to parse Extended JSON
-			// UnmarshalExtJSON is available in mongo-driver/bson
-			// But it expects keys to be quoted. The string extracted should be standard JSON.
+	if cfg.StateFile != "" {
+		checker.State, err = LoadState(cfg.StateFile)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+	}
 
-			// The sample has `{\""$oid\"":\""...\""}` inside the CSV value.
-			// CSV Reader cleans up the `""` -> `"`.
-			// However, it seems the file has literal backslashes escaping the quotes as well: `\"`.
-			// So we get `{\" $oid...`. We need to strip those backslashes.
-			idJSONClean := strings.ReplaceAll(idJSON, `\"`, `"`)
+	out, err := openOutput(cfg.OutFile, stdout)
+	if err != nil {
+		return fmt.Errorf("cannot open output: %w", err)
+	}
+	defer out.Close()
 
-			var id primitive.ObjectID
-			err := id.UnmarshalJSON([]byte(idJSONClean))
-			if err != nil {
-				log.Printf("Line %d: Failed to parse ID JSON '%s' (cleaned: '%s'): %v", lineNum, idJSON, idJSONClean, err)
-				continue
+	if cfg.Mode == modeCounts {
+		namespaces, err := checker.Namespaces(f)
+		if err != nil {
+			return err
+		}
+		counts := checker.CheckCounts(context.TODO(), namespaces)
+		if cfg.Output == "json" {
+			if err := writeCountReport(out, meta, counts); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+		} else {
+			printCountReport(out, counts)
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return saveManifest(hashed)
+	}
+
+	if cfg.Mode == modeChangeStream {
+		namespaces, err := checker.Namespaces(f)
+		if err != nil {
+			return err
+		}
+		if len(namespaces) == 0 {
+			return fmt.Errorf("no namespaces found in the log")
+		}
+		srcStream, ok := checker.Src.(changeStreamer)
+		if !ok {
+			return fmt.Errorf("source cannot be tailed")
+		}
+		destStream, ok := checker.Dest.(changeStreamer)
+		if !ok {
+			return fmt.Errorf("destination cannot be tailed")
+		}
+		report, err := checker.RunChangeStream(context.TODO(), namespaces, srcStream, destStream, cfg.ChangeStreamDuration, cfg.ChangeStreamTimeout)
+		if err != nil {
+			return err
+		}
+		if cfg.Output == "json" {
+			if err := writeChangeStreamReport(out, meta, report); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
 			}
-			// For finding, we can usually use the raw BSON or specific _id field
-			// If it's just an OID, `raw` usually contains `_id`? No, the string is just the value of `_id`.
-			// So `raw` IS the value of `_id`.
-			idVal = id
+		} else {
+			printChangeStreamReport(out, report)
 		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return saveManifest(hashed)
+	}
 
-		if idVal == nil {
-			continue
+	if cfg.Mode == modeIndexes {
+		namespaces, err := checker.Namespaces(f)
+		if err != nil {
+			return err
+		}
+		diffs, err := checker.CheckIndexes(context.TODO(), namespaces)
+		if err != nil {
+			return err
 		}
+		if cfg.Output == "json" {
+			if err := writeIndexReport(out, meta, namespaces, diffs); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+		} else {
+			printIndexReport(out, namespaces, diffs)
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return saveManifest(hashed)
+	}
 
-		// Perform Check
-		// Split namespace
-		parts := strings.SplitN(namespace, ".", 2)
-		if len(parts) != 2 {
-			log.Printf("Line %d: Invalid namespace %s", lineNum, namespace)
-			continue
+	var jw *jsonReportWriter
+	if cfg.Output == "json" {
+		jw, err = newJSONReportWriter(out, checker.DumpMaxBytes)
+		if err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
 		}
-		dbName, colName := parts[0], parts[1]
+		jw.Meta = meta
+		checker.DiscrepancySink = jw.WriteResult
+	}
 
-		res := checkDoc(context.TODO(), srcClient, destClient, dbName, colName, idVal)
-		res.Namespace = namespace
+	if cfg.SplitOutput != "" {
+		so, err := newSplitOutput(cfg.SplitOutput, checker.DumpMaxBytes)
+		if err != nil {
+			return fmt.Errorf("cannot create split output: %w", err)
+		}
+		defer so.Close()
+		checker.SplitOutput = so
+	}
 
-		// Update stats
-		if _, ok := statsMap[namespace]; !ok {
-			statsMap[namespace] = &Stats{}
+	if cfg.SkipLog != "" {
+		sl, err := newSkipLog(cfg.SkipLog)
+		if err != nil {
+			return fmt.Errorf("cannot create skip log: %w", err)
 		}
-		s := statsMap[namespace]
-		s.TotalChecks++
+		defer sl.Close()
+		checker.SkipLog = sl
+	}
 
-		switch res.Status {
-		case "Match":
-			s.Matches++
-		case "Mismatch":
-			s.Mismatches++
-			discrepancyList = append(discrepancyList, res)
-		case "MissingInSource":
-			s.MissingInSource++
-			discrepancyList = append(discrepancyList, res)
-		case "MissingInDest":
-			s.MissingInDest++
-			discrepancyList = append(discrepancyList, res)
-		case "Error":
-			s.Errors++
-			log.Printf("Line %d: Error checking doc: %v", lineNum, res.Details)
+	if cfg.ResultsURI != "" {
+		// Its own deadline: the source and dest one may well have passed
+		// during the preflight, precount and warm-up
+		resultsCtx, resultsCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		resultsClient, err := connectMongo(resultsCtx, cfg.ResultsURI, compatMongoDB, cfg.SRVTimeout)
+		resultsCancel()
+		if err != nil {
+			return connectError("results", err)
 		}
+		defer resultsClient.Disconnect(context.Background())
+		db, col, _ := splitNamespace(cfg.ResultsCollection)
+		runID := primitive.NewObjectID().Hex()
+		rw := newResultsWriter(collectionInserter{resultsClient.Database(db).Collection(col)}, runID)
+		defer rw.Close()
+		checker.Results = rw
+		logger.Printf("Writing results to %s under run id %s", cfg.ResultsCollection, runID)
 	}
 
-	// Print Report
-	fmt.Println("\n=== Analysis Report ===")
-	for ns, s := range statsMap {
-		fmt.Printf("\nNamespace: %s\n", ns)
-		fmt.Printf("  Total Checks: %d\n", s.TotalChecks)
-		fmt.Printf("  Matches: %d\n", s.Matches)
-		fmt.Printf("  Mismatches: %d\n", s.Mismatches)
-		fmt.Printf("  Missing in Source: %d\n", s.MissingInSource)
-		fmt.Printf("  Missing in Dest: %d\n", s.MissingInDest)
-		fmt.Printf("  Errors: %d\n", s.Errors)
+	if cfg.HealthAddr != "" {
+		if cfg.HealthStall <= 0 {
+			return fmt.Errorf("invalid -health-stall %v: must be positive", cfg.HealthStall)
+		}
+		if checker.Progress == nil {
+			checker.Progress = &Progress{}
+		}
+		srv, err := newHealthServer(checker.Progress, cfg.HealthStall, healthClusters).serve(cfg.HealthAddr)
+		if err != nil {
+			return fmt.Errorf("cannot serve health endpoints: %w", err)
+		}
+		defer srv.Close()
+		logger.Printf("Serving /healthz and /readyz on %s", cfg.HealthAddr)
 	}
 
-	if len(discrepancyList) > 0 {
-		fmt.Println("\n=== Discrepancies ===")
-		for _, d := range discrepancyList {
-			fmt.Printf("[%s] ID: %v | Status: %s | Details: %s\n", d.Namespace, d.ID, d.Status, d.Details)
+	if cfg.RepairScript != "" {
+		rf, err := os.Create(cfg.RepairScript)
+		if err != nil {
+			return fmt.Errorf("cannot create repair script: %w", err)
 		}
+		defer rf.Close()
+		checker.Repair = newRepairScript(rf)
 	}
-}
 
-func connectMongo(ctx context.Context, uri string) (*mongo.Client, error) {
-	clientOptions := options.Client().ApplyURI(uri)
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		return nil, err
+	switch {
+	case cfg.FullScan != "":
+		err = checker.RunFullScan(context.TODO(), cfg.FullScan, src, destScan)
+	case cfg.IDsFile != "":
+		err = checker.RunIDs(context.TODO(), f)
+	default:
+		err = checker.Run(context.TODO(), f)
+	}
+	for _, ns := range cfg.Capped {
+		if err != nil {
+			break
+		}
+		err = checker.RunCapped(context.TODO(), ns, src, destScan)
 	}
-	// Ping to verify
-	err = client.Ping(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if checker.SplitOutput != nil {
+		if err := checker.SplitOutput.Close(); err != nil {
+			return fmt.Errorf("failed to write split output: %w", err)
+		}
+	}
+
+	if checker.SkipLog != nil {
+		if err := checker.SkipLog.Close(); err != nil {
+			return fmt.Errorf("failed to write skip log: %w", err)
+		}
 	}
-	return client, nil
-}
 
-func checkDoc(ctx context.Context, src, dest *mongo.Client, db, col string, id interface{}) CheckResult {
-	var srcDoc, destDoc bson.Raw
-	var srcMissing, destMissing bool
+	if checker.Results != nil {
+		if err := checker.Results.Close(); err != nil {
+			return fmt.Errorf("failed to write results collection: %w", err)
+		}
+		logger.Printf("Wrote %d results to %s", checker.Results.written, cfg.ResultsCollection)
+		if n := checker.Results.dropped; n > 0 {
+			logger.Printf("Dropped %d results: the results cluster fell more than %d results behind", n, resultsQueueLimit)
+		}
+	}
 
-	// Find in Source
-	err := src.Database(db).Collection(col).FindOne(ctx, bson.M{"_id": id}).Decode(&srcDoc)
-	if err == mongo.ErrNoDocuments {
-		srcMissing = true
-	} else if err != nil {
-		return CheckResult{ID: id, Status: "Error", Details: fmt.Sprintf("Source error: %v", err)}
+	if checker.Repair != nil {
+		if err := checker.Repair.Flush(); err != nil {
+			return fmt.Errorf("failed to write repair script: %w", err)
+		}
+		logger.Printf("Wrote %d repair statements to %s", checker.Repair.count, cfg.RepairScript)
 	}
 
-	// Find in Dest
-	err = dest.Database(db).Collection(col).FindOne(ctx, bson.M{"_id": id}).Decode(&destDoc)
-	if err == mongo.ErrNoDocuments {
-		destMissing = true
-	} else if err != nil {
-		return CheckResult{ID: id, Status: "Error", Details: fmt.Sprintf("Dest error: %v", err)}
+	if checker.StatsFile != "" {
+		if err := checker.FlushStats(true); err != nil {
+			logger.Printf("Failed to write stats file: %v", err)
+		}
 	}
 
-	// If both are missing, that's a match (both sides agree the doc doesn't exist)
-	if srcMissing && destMissing {
-		return CheckResult{ID: id, Status: "Match", Details: "Document missing from both databases"}
+	if checker.State != nil {
+		if err := checker.State.Save(); err != nil {
+			logger.Printf("Failed to save state: %v", err)
+		}
 	}
 
-	// If only one is missing, that's a discrepancy
-	if srcMissing {
-		return CheckResult{ID: id, Status: "MissingInSource"}
+	if jw != nil {
+		if err := jw.Finish(checker); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else if err := writeTextReport(out, checker, reportTmpl); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
 	}
-	if destMissing {
-		return CheckResult{ID: id, Status: "MissingInDest"}
+	if err := out.Close(); err != nil {
+		return err
 	}
+	if err := saveManifest(hashed); err != nil {
+		return err
+	}
+	return runError(checker, cfg.AllowEmpty)
+}
 
-	// Compare documents (both exist)
-	// bson.Raw represents the raw bytes. We can compare bytes directly if key order is guaranteed same,
-	// but MongoDB doesn't guarantee key order is preserved across replications/moves exactly the same way always?
-	// Actually, usually it does, but canonical comparison is safer.
-	// However, simplest check is bytes equal. If not, unmarshal to maps and DeepEqual.
+// runError returns the error a finished run exits with: its early stop, a
+// log of which no line matched unless allowEmpty, or a failed sign-off
+func runError(c *Checker, allowEmpty bool) error {
+	if c.StopReason != "" {
+		return fmt.Errorf("run stopped: %s", c.StopReason)
+	}
+	if c.NoMatches() && !allowEmpty {
+		return errNoMatches
+	}
+	return signOffError(c.SignOff())
+}
 
-	if string(srcDoc) == string(destDoc) {
-		return CheckResult{ID: id, Status: "Match"}
+// openLog opens the log to read: the -logfile path or URL, or the log of
+// -k8s-pod, as CSV with a header
+func openLog(ctx context.Context, cfg Config) (io.ReadCloser, error) {
+	if cfg.K8sPod == "" {
+		if cfg.K8sNamespace != "" || cfg.K8sContainer != "" {
+			return nil, fmt.Errorf("-k8s-namespace and -k8s-container require -k8s-pod")
+		}
+		return openInput(ctx, cfg.LogFile)
+	}
+	if cfg.LogFile != "" {
+		return nil, fmt.Errorf("-k8s-pod cannot be combined with -logfile")
 	}
+	return openPodLog(ctx, cfg.K8sNamespace, cfg.K8sPod, cfg.K8sContainer)
+}
 
-	// Deep comparison
-	var srcMap, destMap map[string]interface{}
-	_ = bson.Unmarshal(srcDoc, &srcMap)   // Ignorning error as we just decoded it
-	_ = bson.Unmarshal(destDoc, &destMap) // Ignorning error as we just decoded it
+// logName names the log for the manifest: the -logfile path or URL, or
+// k8s://<namespace>/<pod>[/<container>]
+func logName(cfg Config) string {
+	if cfg.K8sPod == "" {
+		return cfg.LogFile
+	}
+	name := "k8s://" + cfg.K8sNamespace + "/" + cfg.K8sPod
+	if cfg.K8sContainer != "" {
+		name += "/" + cfg.K8sContainer
+	}
+	return name
+}
 
-	if fmt.Sprintf("%v", srcMap) == fmt.Sprintf("%v", destMap) {
-		return CheckResult{ID: id, Status: "Match"}
+// lineFilterOf compiles the -filter-regex or -case-sensitive line filter
+func lineFilterOf(cfg Config) (*regexp.Regexp, error) {
+	if cfg.FilterRegex != "" && cfg.CaseSensitive {
+		return nil, fmt.Errorf("-case-sensitive applies to the default marker; write the case of -filter-regex into the pattern, with (?i) for any case")
 	}
+	re, err := newLineFilter(cfg.FilterRegex, cfg.CaseSensitive)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -filter-regex: %w", err)
+	}
+	return re, nil
+}
 
-	return CheckResult{ID: id, Status: "Mismatch"}
+// collectionDBsOf loads the -collection-db-map file, if any, and checks
+// -default-db
+func collectionDBsOf(cfg Config) (map[string]string, error) {
+	if cfg.DefaultDB != "" && (strings.Contains(cfg.DefaultDB, ".") || !validNamespace(cfg.DefaultDB+".col")) {
+		return nil, fmt.Errorf("invalid -default-db %q", cfg.DefaultDB)
+	}
+	if cfg.CollectionDBMap == "" {
+		return nil, nil
+	}
+	f, err := os.Open(cfg.CollectionDBMap)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dbs, err := loadCollectionDBs(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -collection-db-map: %w", err)
+	}
+	return dbs, nil
+}
+
+// parseWorkers parses -workers: a positive count or "auto"
+func parseWorkers(s string) (int, bool, error) {
+	if s == "auto" {
+		return 0, true, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, false, fmt.Errorf("invalid -workers %q: must be a positive number or auto", s)
+	}
+	return n, false, nil
 }
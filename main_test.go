@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestParsing(t *testing.T) {
@@ -80,3 +87,111 @@ func TestParsing(t *testing.T) {
 		t.Logf("Successfully parsed ID: %v", raw)
 	}
 }
+
+func TestVersionShortCircuits(t *testing.T) {
+	var out strings.Builder
+	// An unreachable source would make run block on connecting if -version
+	// did not exit first.
+	err := run([]string{"-version", "-source", "mongodb://192.0.2.1:1", "-dest", "mongodb://192.0.2.1:1", "-logfile", "missing.csv"}, &out)
+	if err != nil {
+		t.Fatalf("run -version: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "error_checker "+version) {
+		t.Errorf("unexpected version output %q", out.String())
+	}
+}
+
+func TestExtractCommand(t *testing.T) {
+	oid := primitive.NewObjectID()
+	path := filepath.Join(t.TempDir(), "log.csv")
+	if err := os.WriteFile(path, []byte(logFile(logLine("db.col", oid), "2025-10-15,pod,proc,unrelated")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := run([]string{"extract", "-logfile", path}, &out); err != nil {
+		t.Fatalf("run extract: %v", err)
+	}
+	want := `db.col,{"$oid":"` + oid.Hex() + `"}` + "\n"
+	if out.String() != want {
+		t.Errorf("extract output = %q, want %q", out.String(), want)
+	}
+
+	// The output is accepted by -ids-file
+	c := NewChecker(newFakeSource(), newFakeSource())
+	if err := c.RunIDs(context.Background(), strings.NewReader(out.String())); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.StatsMap["db.col"]; s == nil || s.TotalChecks != 1 {
+		t.Errorf("RunIDs on extract output: stats = %+v, want 1 check", s)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var out strings.Builder
+	if err := run([]string{"bogus"}, &out); !errors.Is(err, errUsage) {
+		t.Errorf("run bogus = %v, want errUsage", err)
+	}
+	if !strings.Contains(out.String(), "Commands:") {
+		t.Errorf("expected the command list, got %q", out.String())
+	}
+}
+
+func TestCompareBytesConflicts(t *testing.T) {
+	for _, flag := range [][]string{{"-numeric-loose"}, {"-compare-root", "payload"}, {"-checksum-field", "sum"}} {
+		args := append([]string{"-logfile", "log.csv", "-source", "mongodb://192.0.2.1:1", "-dest", "mongodb://192.0.2.2:1", "-compare-mode", "bytes"}, flag...)
+		var out strings.Builder
+		if err := run(args, &out); err == nil || !strings.Contains(err.Error(), flag[0]) {
+			t.Errorf("-compare-mode bytes with %s: got %v, want an error naming it", flag[0], err)
+		}
+	}
+}
+
+// stderrOf returns what fn writes to stderr, directly or through the
+// standard logger
+func stderrOf(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stderr := os.Stderr
+	os.Stderr = f
+	log.SetOutput(f)
+	defer func() {
+		os.Stderr = stderr
+		log.SetOutput(stderr)
+	}()
+	fn()
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestQuietWritesNothingToStderr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.csv")
+	// The header-like first row and the unparsable id are both logged
+	if err := os.WriteFile(path, []byte(logFile(strings.Replace(logLine("db.col", primitive.NewObjectID()), `\""$oid\"":`, "", 1))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The same cluster on both sides is warned about before connecting,
+	// which fails fast on the closed port
+	uri := "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100"
+	runs := [][]string{
+		{"extract", "-logfile", path},
+		{"-selftest"},
+		{"-source", uri, "-dest", uri, "-allow-same-endpoint", "-logfile", path},
+	}
+	for _, args := range runs {
+		if loud := stderrOf(t, func() { run(args, io.Discard) }); loud == "" {
+			t.Errorf("%v: nothing on stderr; the quiet run below proves nothing", args)
+		}
+		args = append(args, "-quiet")
+		if got := stderrOf(t, func() { run(args, io.Discard) }); got != "" {
+			t.Errorf("%v wrote to stderr:\n%s", args, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// runManifest records what a run was given, so that the same reconciliation
+// can be repeated later and shown to be the one that ran
+type runManifest struct {
+	Build     BuildInfo `json:"build"`
+	Command   string    `json:"command"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// Args are the flags given on the command line, as -name=value
+	Args []string `json:"args"`
+	// Flags is the effective value of every flag, defaults included
+	Flags map[string]string `json:"flags"`
+	Input *manifestInput    `json:"input,omitempty"`
+}
+
+// manifestInput identifies the log or ids file a run read
+type manifestInput struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"` // of the content read, after decompression
+	Bytes  int64  `json:"bytes"`
+	// Partial is set when the run stopped before the end of the input, so
+	// that the hash and size cover only the part it read
+	Partial bool `json:"partial,omitempty"`
+}
+
+// newManifest returns the manifest of a run described by meta. Credentials
+// are already redacted from the flag values in cfg.
+func newManifest(cmd string, cfg Config, meta jsonMetadata) *runManifest {
+	m := &runManifest{
+		Build:     meta.Build,
+		Command:   cmd,
+		StartTime: meta.StartTime,
+		Args:      []string{},
+		Flags:     cfg.Flags,
+	}
+	for _, name := range cfg.SetFlags {
+		m.Args = append(m.Args, fmt.Sprintf("-%s=%s", name, cfg.Flags[name]))
+	}
+	return m
+}
+
+// write saves the manifest to path, completing it with the end time and
+// the hash of input, if any
+func (m *runManifest) write(path string, input *hashingReader) error {
+	m.EndTime = time.Now().UTC()
+	if input != nil {
+		m.Input = &manifestInput{Path: input.path, SHA256: hex.EncodeToString(input.h.Sum(nil)), Bytes: input.n, Partial: !input.eof}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// hashingReader hashes the input as the run reads it. What a run stopping
+// early leaves unread is not read just to be hashed, which could take as
+// long as the run itself.
+type hashingReader struct {
+	r    io.Reader
+	path string
+	h    hash.Hash
+	n    int64
+	eof  bool // the whole input was read
+}
+
+func newHashingReader(r io.Reader, path string) *hashingReader {
+	return &hashingReader{r: r, path: path, h: sha256.New()}
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	hr.n += int64(n)
+	if err == io.EOF {
+		hr.eof = true
+	}
+	return n, err
+}
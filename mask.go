@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Mask styles
+const (
+	maskFixed = "fixed" // every value becomes maskToken
+	maskHash  = "hash"  // every value becomes a keyed hash, so equal values stay recognizable
+)
+
+// maskKeyBytes is the size of the random key of the hash style when no
+// -mask-key-file is given
+const maskKeyBytes = 32
+
+// maskToken replaces masked values in the fixed style
+const maskToken = "***"
+
+// masker hides the values of configured fields in report output. Paths are
+// dotted field paths without array indexes, as for -unordered-array-field,
+// and cover everything below them. A nil masker masks nothing.
+type masker struct {
+	paths map[string]bool
+	style string
+	key   []byte // of the HMAC of the hash style
+}
+
+// newMasker returns a masker for paths, or nil when there are none. The hash
+// style is an HMAC keyed with key, or with a random key of its own when key
+// is empty, so that hashes only compare within one run.
+func newMasker(paths []string, style string, key []byte) (*masker, error) {
+	if style != maskFixed && style != maskHash {
+		return nil, fmt.Errorf("%q is neither %s nor %s", style, maskFixed, maskHash)
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	m := &masker{paths: make(map[string]bool), style: style, key: key}
+	for _, p := range paths {
+		m.paths[p] = true
+	}
+	if style == maskHash && len(m.key) == 0 {
+		m.key = make([]byte, maskKeyBytes)
+		if _, err := rand.Read(m.key); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// masks reports whether the field at path, or one of its parents, is masked
+func (m *masker) masks(path string) bool {
+	if m == nil {
+		return false
+	}
+	p := schemaPath(path)
+	for {
+		if m.paths[p] {
+			return true
+		}
+		i := strings.LastIndexByte(p, '.')
+		if i < 0 {
+			return false
+		}
+		p = p[:i]
+	}
+}
+
+// token returns the replacement of a masked value
+func (m *masker) token(v bson.RawValue) string {
+	if m.style == maskFixed {
+		return maskToken
+	}
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte{byte(v.Type)})
+	mac.Write(v.Value)
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// format renders the value at path for a report, with masked fields hidden
+func (m *masker) format(path string, v bson.RawValue) string {
+	if m == nil {
+		return v.String()
+	}
+	if m.masks(path) {
+		return fmt.Sprintf("%q", m.token(v))
+	}
+	masked, err := bson.Marshal(bson.D{{Key: "v", Value: m.value(path, v)}})
+	if err != nil {
+		return v.String()
+	}
+	return bson.Raw(masked).Lookup("v").String()
+}
+
+// doc returns a copy of doc with masked fields replaced by their token
+func (m *masker) doc(doc bson.Raw) bson.Raw {
+	if m == nil || doc == nil {
+		return doc
+	}
+	masked, err := bson.Marshal(m.document("", doc))
+	if err != nil {
+		return doc
+	}
+	return masked
+}
+
+func (m *masker) document(prefix string, doc bson.Raw) bson.D {
+	elems, _ := doc.Elements()
+	out := make(bson.D, 0, len(elems))
+	for _, e := range elems {
+		out = append(out, bson.E{Key: e.Key(), Value: m.value(joinPath(prefix, e.Key()), e.Value())})
+	}
+	return out
+}
+
+// value masks the value at path, descending into documents and arrays
+func (m *masker) value(path string, v bson.RawValue) interface{} {
+	if m.masks(path) {
+		return m.token(v)
+	}
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		return m.document(path, v.Document())
+	case bsontype.Array:
+		vals, _ := v.Array().Values()
+		out := make(bson.A, len(vals))
+		for i, ev := range vals {
+			out[i] = m.value(fmt.Sprintf("%s.%d", path, i), ev)
+		}
+		return out
+	}
+	return v
+}
+
+// result masks the id and documents of a result for output. The id is
+// masked when the lookup field is.
+func (m *masker) result(res CheckResult, lookupField string) CheckResult {
+	if m == nil {
+		return res
+	}
+	if m.masks(lookupField) {
+		if data, err := bson.Marshal(bson.D{{Key: "v", Value: res.ID}}); err == nil {
+			res.ID = m.token(bson.Raw(data).Lookup("v"))
+		}
+	}
+	res.SourceDoc = m.doc(res.SourceDoc)
+	res.DestDoc = m.doc(res.DestDoc)
+	return res
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMaskedFieldsNeverInOutput(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	changed, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{
+		{Key: "_id", Value: changed},
+		{Key: "email", Value: "alice@example.com"},
+		{Key: "contacts", Value: bson.A{bson.D{{Key: "ssn", Value: "123-45-6789"}}}},
+		{Key: "n", Value: 1},
+	})
+	dest.insert("db.col", bson.D{
+		{Key: "_id", Value: changed},
+		{Key: "email", Value: "bob@example.com"},
+		{Key: "n", Value: 2},
+	})
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}, {Key: "email", Value: "carol@example.com"}})
+	secrets := []string{"alice", "bob", "carol", "123-45-6789"}
+
+	for _, style := range []string{maskFixed, maskHash} {
+		c := NewChecker(src, dest)
+		c.DumpDocs, c.DumpMissing, c.PrettyDiff = true, true, true
+		var err error
+		if c.Compare.mask, err = newMasker([]string{"email", "contacts.ssn"}, style, nil); err != nil {
+			t.Fatal(err)
+		}
+		input := logFile(logLine("db.col", changed), logLine("db.col", missing))
+		if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		s := c.StatsMap["db.col"]
+		if s.Mismatches != 1 || s.MissingInDest != 1 {
+			t.Fatalf("%s: masking changed the comparison: %+v", style, s)
+		}
+		if d := c.DiscrepancyList[0].Diffs; len(d) != 3 {
+			t.Errorf("%s: got diffs %v, want email, contacts and n", style, d)
+		}
+
+		var text, js bytes.Buffer
+		printReport(&text, c)
+		for _, d := range c.DiscrepancyList {
+			printResult(&text, d, false)
+		}
+		if err := writeJSONReport(&js, c); err != nil {
+			t.Fatalf("writeJSONReport: %v", err)
+		}
+		for _, out := range []string{text.String(), js.String()} {
+			for _, secret := range secrets {
+				if strings.Contains(out, secret) {
+					t.Errorf("%s: %q leaked into the report:\n%s", style, secret, out)
+				}
+			}
+		}
+		if !strings.Contains(text.String(), "n: source") {
+			t.Errorf("%s: unmasked diff missing:\n%s", style, text.String())
+		}
+	}
+
+	// Hashes are stable, and differ between values
+	m, _ := newMasker([]string{"x"}, maskHash, nil)
+	a, _ := bson.Marshal(bson.D{{Key: "x", Value: "alice"}})
+	b, _ := bson.Marshal(bson.D{{Key: "x", Value: "bob"}})
+	alice := m.format("x", bson.Raw(a).Lookup("x"))
+	if alice != m.format("x", bson.Raw(a).Lookup("x")) || alice == m.format("x", bson.Raw(b).Lookup("x")) {
+		t.Error("hash masks are not stable per value")
+	}
+	// They depend on the key: random per masker, or the one given
+	other, _ := newMasker([]string{"x"}, maskHash, nil)
+	if alice == other.format("x", bson.Raw(a).Lookup("x")) {
+		t.Error("hash masks of two runs without a key are equal")
+	}
+	k1, _ := newMasker([]string{"x"}, maskHash, []byte("secret"))
+	k2, _ := newMasker([]string{"x"}, maskHash, []byte("secret"))
+	if k1.format("x", bson.Raw(a).Lookup("x")) != k2.format("x", bson.Raw(a).Lookup("x")) {
+		t.Error("hash masks with the same key differ")
+	}
+
+	if _, err := newMasker([]string{"x"}, "rot13", nil); err == nil {
+		t.Error("expected an error for an unknown mask style")
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// openOutput opens the report destination. An empty path means stdout and a
+// path ending in .gz is gzip-compressed transparently.
+func openOutput(path string, stdout io.Writer) (io.WriteCloser, error) {
+	if path == "" {
+		return nopWriteCloser{stdout}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// gzipFile closes both the gzip stream and the underlying file
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.f.Close()
+		return err
+	}
+	return g.f.Close()
+}
+
+// jsonReportWriter streams a JSON report: discrepancies are encoded one by
+// one as they are found, and the per-namespace statistics are appended when
+// the run finishes, so the report never has to be held in memory.
+type jsonReportWriter struct {
+	// Meta describes the run; it is written by Finish, so callers may fill
+	// it in until then. StartTime is set when the writer is created.
+	Meta jsonMetadata
+
+	w            *bufio.Writer
+	enc          *json.Encoder
+	dumpMaxBytes int
+	count        int
+	err          error // first write error, returned by Finish; later writes are skipped
+}
+
+// newJSONReportWriter writes the schema version and opens the discrepancy array
+func newJSONReportWriter(w io.Writer, dumpMaxBytes int) (*jsonReportWriter, error) {
+	jw := &jsonReportWriter{
+		Meta:         newJSONMetadata(),
+		w:            bufio.NewWriter(w),
+		dumpMaxBytes: dumpMaxBytes,
+	}
+	jw.enc = json.NewEncoder(jw.w)
+	_, err := fmt.Fprintf(jw.w, `{"schemaVersion":%d,"discrepancies":[`, reportSchemaVersion)
+	return jw, err
+}
+
+// WriteResult appends one result to the discrepancy array
+func (jw *jsonReportWriter) WriteResult(res CheckResult) {
+	if jw.count > 0 {
+		jw.writeString(",")
+	}
+	jw.count++
+	jw.encode(newJSONResult(res, jw.dumpMaxBytes))
+}
+
+// writeString writes s unless an earlier write failed, keeping the first error
+func (jw *jsonReportWriter) writeString(s string) {
+	if jw.err == nil {
+		_, jw.err = jw.w.WriteString(s)
+	}
+}
+
+// encode writes v as JSON unless an earlier write failed, keeping the first error
+func (jw *jsonReportWriter) encode(v interface{}) {
+	if jw.err == nil {
+		jw.err = jw.enc.Encode(v)
+	}
+}
+
+// field writes the member name of the top-level object with value v
+func (jw *jsonReportWriter) field(name string, v interface{}) {
+	jw.writeString(`,"` + name + `":`)
+	jw.encode(v)
+}
+
+// Finish closes the discrepancy array and writes the run metadata and
+// statistics. It returns the first error of the whole report.
+func (jw *jsonReportWriter) Finish(c *Checker) error {
+	jw.Meta.EndTime = time.Now().UTC()
+	jw.writeString(`],"metadata":`)
+	jw.encode(jw.Meta)
+	jw.field("rowsRead", c.RowsRead)
+	jw.field("matchedLines", c.MatchedLines)
+	jw.field("truncated", c.Truncated)
+	if c.StopReason != "" {
+		jw.field("stopReason", c.StopReason)
+	}
+	if c.LogAge.Count > 0 {
+		jw.field("logAge", c.LogAge.json())
+	}
+	if c.TimeHistogram != nil {
+		jw.field("timeHistogram", c.TimeHistogram.json())
+	}
+	jw.field("headerRowsSkipped", c.HeaderRowsSkipped)
+	jw.field("oversizedLines", c.OversizedLines)
+	jw.field("unresolvedNamespaces", c.UnresolvedNamespaces)
+	if len(c.SkippedLines) > 0 {
+		jw.field("skippedLines", c.SkippedLines)
+	}
+	jw.field("dedupEvictions", c.DedupEvictions())
+	jw.field("compareCacheHits", c.CompareCacheHits())
+	jw.field("namespaces", c.StatsMap)
+	offenders := topOffenders(c.StatsMap, c.TopN)
+	if offenders == nil {
+		offenders = []offender{}
+	}
+	jw.field("topOffenders", offenders)
+	uncovered := zeroCoverage(c.StatsMap)
+	if uncovered == nil {
+		uncovered = []string{}
+	}
+	jw.field("zeroCoverage", uncovered)
+	if diffs := c.CollationDiffs(); len(diffs) > 0 {
+		jw.field("collationDiffs", diffs)
+	}
+	if plans := c.QueryPlans(); len(plans) > 0 {
+		jw.field("queryPlans", plans)
+	}
+	if list := c.SignOff(); len(list) > 0 {
+		jw.field("signOff", list)
+	}
+	jw.writeString("}\n")
+	if jw.err != nil {
+		return jw.err
+	}
+	return jw.w.Flush()
+}
+
+// splitFileNames are the files -split-output writes, by result status.
+// Discrepancies of the other statuses go to other.json.
+var splitFileNames = map[string]string{
+	StatusMismatch:        "mismatches.json",
+	StatusMissingInDest:   "missing-in-dest.json",
+	StatusMissingInSource: "missing-in-source.json",
+	StatusError:           "errors.json",
+	StatusTimeout:         "errors.json",
+}
+
+// splitOtherFile receives the discrepancies splitFileNames does not route
+const splitOtherFile = "other.json"
+
+// splitOutput streams every result other than a Match into a JSON array
+// file chosen by its status, so that each kind of result can be handed to
+// whoever handles it without splitting the report afterwards
+type splitOutput struct {
+	files        map[string]*splitFile // by file name
+	dumpMaxBytes int
+	err          error // first write error, returned by Close
+}
+
+// splitFile is one streamed JSON array
+type splitFile struct {
+	f     *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	count int
+}
+
+// newSplitOutput creates dir and opens every split file in it, so that a
+// status without results still gets an empty array
+func newSplitOutput(dir string, dumpMaxBytes int) (*splitOutput, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	so := &splitOutput{files: make(map[string]*splitFile), dumpMaxBytes: dumpMaxBytes}
+	for _, name := range append(slices.Sorted(maps.Values(splitFileNames)), splitOtherFile) {
+		if so.files[name] != nil {
+			continue
+		}
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			so.Close()
+			return nil, err
+		}
+		sf := &splitFile{f: f, w: bufio.NewWriter(f)}
+		sf.enc = json.NewEncoder(sf.w)
+		sf.w.WriteString("[")
+		so.files[name] = sf
+	}
+	return so, nil
+}
+
+// WriteResult appends res to the file of its status. Matches, and the
+// checks of documents out of scope, are dropped.
+func (so *splitOutput) WriteResult(res CheckResult) {
+	if so.err != nil || res.Status == StatusMatch || outOfScopeStatus(res.Status) {
+		return
+	}
+	name, ok := splitFileNames[res.Status]
+	if !ok {
+		name = splitOtherFile
+	}
+	sf := so.files[name]
+	if sf.count > 0 {
+		sf.w.WriteString(",")
+	}
+	sf.count++
+	so.err = sf.enc.Encode(newJSONResult(res, so.dumpMaxBytes))
+}
+
+// Close terminates the arrays and closes the files. Later calls do nothing.
+func (so *splitOutput) Close() error {
+	err := so.err
+	files := so.files
+	so.files = nil
+	for _, sf := range files {
+		sf.w.WriteString("]\n")
+		if ferr := sf.w.Flush(); err == nil {
+			err = ferr
+		}
+		if cerr := sf.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
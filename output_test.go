@@ -0,0 +1,184 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGzipJSONReport(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	missing, mismatch := primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 2}})
+
+	path := filepath.Join(t.TempDir(), "report.json.gz")
+	out, err := openOutput(path, io.Discard)
+	if err != nil {
+		t.Fatalf("openOutput: %v", err)
+	}
+	jw, err := newJSONReportWriter(out, 0)
+	if err != nil {
+		t.Fatalf("newJSONReportWriter: %v", err)
+	}
+
+	c := NewChecker(src, dest)
+	c.DiscrepancySink = jw.WriteResult
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", missing), logLine("db.col", mismatch)))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(c.DiscrepancyList) != 0 {
+		t.Errorf("streamed discrepancies should not be kept in memory, got %d", len(c.DiscrepancyList))
+	}
+	if err := jw.Finish(c); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("report is not gzipped: %v", err)
+	}
+	var report jsonReport
+	if err := json.NewDecoder(zr).Decode(&report); err != nil {
+		t.Fatalf("decompressed report is not valid JSON: %v", err)
+	}
+	if len(report.Discrepancies) != 2 || report.Namespaces["db.col"].TotalChecks != 2 || report.RowsRead != 2 {
+		t.Errorf("unexpected report contents: %+v", report)
+	}
+}
+
+func TestSplitOutput(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, mismatch, onlySrc, onlyDest := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 2}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: onlySrc}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: onlyDest}})
+
+	dir := filepath.Join(t.TempDir(), "split")
+	so, err := newSplitOutput(dir, 0)
+	if err != nil {
+		t.Fatalf("newSplitOutput: %v", err)
+	}
+	// The dest fails the lookup of one more id
+	failing := primitive.NewObjectID()
+	c := NewChecker(src, &failingSource{docSource: dest, ids: map[interface{}]bool{failing: true}})
+	c.SplitOutput = so
+	lines := []string{logLine("db.col", match), logLine("db.col", mismatch), logLine("db.col", onlySrc), logLine("db.col", onlyDest), logLine("db.col", failing)}
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := so.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := map[string]string{
+		"mismatches.json":        StatusMismatch,
+		"missing-in-dest.json":   StatusMissingInDest,
+		"missing-in-source.json": StatusMissingInSource,
+		"errors.json":            StatusError,
+	}
+	for name, status := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var results []jsonResult
+		if err := json.Unmarshal(data, &results); err != nil {
+			t.Fatalf("%s is not a JSON array: %v\n%s", name, err, data)
+		}
+		if len(results) != 1 || results[0].Status != status {
+			t.Errorf("%s = %+v, want one %s result", name, results, status)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "other.json")); strings.TrimSpace(string(data)) != "[]" {
+		t.Errorf("other.json = %s, want an empty array", data)
+	}
+	// The combined report still lists every discrepancy
+	if len(c.DiscrepancyList) != 3 {
+		t.Errorf("%d discrepancies in the report, want 3", len(c.DiscrepancyList))
+	}
+
+	// Documents out of scope are not written, under -direction source or
+	// otherwise
+	dir = filepath.Join(t.TempDir(), "split")
+	if so, err = newSplitOutput(dir, 0); err != nil {
+		t.Fatalf("newSplitOutput: %v", err)
+	}
+	c = NewChecker(src, dest)
+	c.Direction = directionSource
+	c.SplitOutput = so
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", onlyDest)))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	so.WriteResult(CheckResult{Namespace: "db.col", ID: onlySrc, Status: StatusSkippedOld})
+	so.WriteResult(CheckResult{Namespace: "db.col", ID: onlySrc, Status: StatusOutsideCapWindow})
+	so.WriteResult(CheckResult{Namespace: "db.col", ID: onlySrc, Status: StatusMissingInBoth})
+	if err := so.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if c.StatsMap["db.col"].NotInSource != 1 {
+		t.Fatalf("stats %+v, want the dest-only id NotInSource", c.StatsMap["db.col"])
+	}
+	var other []jsonResult
+	data, _ := os.ReadFile(filepath.Join(dir, "other.json"))
+	if err := json.Unmarshal(data, &other); err != nil || len(other) != 1 || other[0].Status != StatusMissingInBoth {
+		t.Errorf("other.json = %s, want the MissingInBoth result alone", data)
+	}
+}
+
+// failingSource fails the lookups of the given ids
+type failingSource struct {
+	docSource
+	ids map[interface{}]bool
+}
+
+func (f *failingSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	if f.ids[filter.(bson.M)["_id"]] {
+		return nil, errors.New("query failed")
+	}
+	return f.docSource.FindOne(ctx, db, col, filter)
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+var errWriteFailed = errors.New("disk full")
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errWriteFailed }
+
+func TestJSONReportWriteError(t *testing.T) {
+	jw, err := newJSONReportWriter(failingWriter{}, 0)
+	if err != nil {
+		t.Fatalf("newJSONReportWriter: %v", err)
+	}
+	c := NewChecker(newFakeSource(), newFakeSource())
+	// More statistics than the write buffer holds, so that writing them fails
+	for i := 0; i < 200; i++ {
+		c.stats(fmt.Sprintf("db.col%d", i)).TotalChecks++
+	}
+	if err := jw.Finish(c); !errors.Is(err, errWriteFailed) {
+		t.Errorf("Finish = %v, want %v", err, errWriteFailed)
+	}
+}
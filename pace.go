@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// checkPacer spaces out the checks of one worker, or of the reading
+// goroutine when there is no pool: before every check but the first it
+// waits delay plus a random jitter drawn from [0, jitter]. Workers pace
+// independently, so their queries do not line up into bursts.
+type checkPacer struct {
+	delay, jitter time.Duration
+	randN         func(n int64) int64 // returns a value in [0, n)
+	sleep         func(ctx context.Context, d time.Duration) error
+	started       bool
+}
+
+// newPacer returns a pacer for one worker, or nil when no delay is set
+func (c *Checker) newPacer() *checkPacer {
+	if c.InterCheckDelay <= 0 && c.InterCheckJitter <= 0 {
+		return nil
+	}
+	return &checkPacer{delay: c.InterCheckDelay, jitter: c.InterCheckJitter, randN: rand.Int64N, sleep: sleepCtx}
+}
+
+// next returns the wait before the next check
+func (p *checkPacer) next() time.Duration {
+	d := max(p.delay, 0)
+	if p.jitter > 0 {
+		d += time.Duration(p.randN(int64(p.jitter) + 1))
+	}
+	return d
+}
+
+// wait sleeps before a check, returning early when ctx is cancelled
+func (p *checkPacer) wait(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	if !p.started {
+		p.started = true
+		return
+	}
+	p.sleep(ctx, p.next())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// aggregator runs aggregation pipelines
+type aggregator interface {
+	Aggregate(ctx context.Context, db, col string, pipeline interface{}) ([]bson.Raw, error)
+}
+
+func (m mongoSource) Aggregate(ctx context.Context, db, col string, pipeline interface{}) ([]bson.Raw, error) {
+	if m.session != nil {
+		ctx = mongo.NewSessionContext(ctx, m.session)
+	}
+	opts := options.Aggregate()
+	if m.maxTime > 0 {
+		opts.SetMaxTime(m.maxTime)
+	}
+	cur, err := m.client.Database(db).Collection(col).Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var docs []bson.Raw
+	for cur.Next(ctx) {
+		docs = append(docs, append(bson.Raw(nil), cur.Current...))
+	}
+	return docs, cur.Err()
+}
+
+// pipelineSource fetches documents through an aggregation pipeline, so they
+// can be reshaped (e.g. derived fields dropped) before comparison. The lookup
+// filter becomes a leading $match stage. Counts are delegated unchanged.
+type pipelineSource struct {
+	docSource
+	agg    aggregator
+	stages bson.A
+}
+
+func (p pipelineSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	pipeline := append(bson.A{bson.D{{Key: "$match", Value: filter}}}, p.stages...)
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: 1}})
+	docs, err := p.agg.Aggregate(ctx, db, col, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return docs[0], nil
+}
+
+// loadPipeline reads aggregation stages from an Extended JSON array file
+func loadPipeline(path string) (bson.A, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stages bson.A
+	if err := bson.UnmarshalExtJSON(data, false, &stages); err != nil {
+		return nil, fmt.Errorf("invalid pipeline in %s: %w", path, err)
+	}
+	return stages, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Aggregate supports the subset of stages the tests use: $match (equality),
+// $project with exclusions only, and $limit.
+func (f *fakeSource) Aggregate(ctx context.Context, db, col string, pipeline interface{}) ([]bson.Raw, error) {
+	f.calls.Add(1)
+	docs := f.docs[db+"."+col]
+	for _, stage := range pipeline.(bson.A) {
+		op := stage.(bson.D)[0]
+		var next []bson.Raw
+		switch op.Key {
+		case "$match":
+			for _, d := range docs {
+				if matchesFilter(d, op.Value.(bson.M)) {
+					next = append(next, d)
+				}
+			}
+		case "$project":
+			excluded := make(map[string]bool)
+			for _, e := range op.Value.(bson.D) {
+				excluded[e.Key] = true
+			}
+			for _, d := range docs {
+				var kept bson.D
+				elems, _ := d.Elements()
+				for _, e := range elems {
+					if !excluded[e.Key()] {
+						kept = append(kept, bson.E{Key: e.Key(), Value: e.Value()})
+					}
+				}
+				raw, _ := bson.Marshal(kept)
+				next = append(next, raw)
+			}
+		case "$limit":
+			next = docs
+			if n := int(op.Value.(int)); len(next) > n {
+				next = next[:n]
+			}
+		default:
+			return nil, fmt.Errorf("fake Aggregate: unsupported stage %s", op.Key)
+		}
+		docs = next
+	}
+	return docs, nil
+}
+
+func TestDestPipelineProject(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.json")
+	if err := os.WriteFile(path, []byte(`[{"$project": {"fullName": 0}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stages, err := loadPipeline(path)
+	if err != nil {
+		t.Fatalf("loadPipeline: %v", err)
+	}
+
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("db.users", bson.D{{Key: "_id", Value: id}, {Key: "first", Value: "Ada"}, {Key: "last", Value: "Lovelace"}})
+	// The destination stores a denormalized field absent from the source
+	dest.insert("db.users", bson.D{{Key: "_id", Value: id}, {Key: "first", Value: "Ada"}, {Key: "last", Value: "Lovelace"}, {Key: "fullName", Value: "Ada Lovelace"}})
+
+	if res := NewChecker(src, dest).checkDoc(context.Background(), "db", "users", id); res.Status != StatusMismatch {
+		t.Fatalf("without the pipeline the derived field should mismatch, got %s", res.Status)
+	}
+
+	c := NewChecker(src, pipelineSource{docSource: dest, agg: dest, stages: stages})
+	if res := c.checkDoc(context.Background(), "db", "users", id); res.Status != StatusMatch {
+		t.Errorf("with the pipeline = %s %v, want Match", res.Status, res.Diffs)
+	}
+	if res := c.checkDoc(context.Background(), "db", "users", primitive.NewObjectID()); res.Status != StatusMatch || res.Details == "" {
+		t.Errorf("unknown id through the pipeline = %s, want missing from both", res.Status)
+	}
+}
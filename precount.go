@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// estimateSampleBytes is how much of the start of a log estimateChecks reads
+const estimateSampleBytes = 1 << 20
+
+// estimateChecks estimates how many lines of the log at path a run checks,
+// scaling the share of lines matching filter in a sample of its start to
+// the file size. exact is set when the sample covered the whole file.
+func estimateChecks(path string, filter *regexp.Regexp) (n int64, exact bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	sample := make([]byte, estimateSampleBytes)
+	read, err := io.ReadFull(f, sample)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, false, err
+	}
+	sample = sample[:read]
+	exact = int64(read) >= info.Size()
+	if !exact {
+		// Leave out the line cut by the end of the sample
+		if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+			sample = sample[:i+1]
+		}
+	}
+	if len(sample) == 0 {
+		return 0, exact, nil
+	}
+	var matching int64
+	for line := range bytes.Lines(sample) {
+		if filter.Match(line) {
+			matching++
+		}
+	}
+	if exact {
+		return matching, true, nil
+	}
+	return matching * info.Size() / int64(len(sample)), false, nil
+}
+
+// countChecks reads the whole CSV log in r and counts the lines a run would
+// check, honoring HasHeader and MaxLines, without looking
+// anything up
+func (c *Checker) countChecks(r io.Reader) (int64, error) {
+	scratch := &Checker{HasHeader: c.HasHeader, MaxLines: c.MaxLines, MaxLineBytes: c.MaxLineBytes, SearchColumns: c.SearchColumns, Logger: log.New(io.Discard, "", 0)}
+	var n int64
+	err := scratch.readLog(r, func(lineNum int, record []string) {
+		if message, ok := scratch.messageOf(lineNum, record); ok && c.selected(message) {
+			n++
+		}
+	})
+	return n, err
+}
+
+// preflight sets ExpectedChecks before a run over the log at path, and logs
+// it: counted in a first pass over the log with precount, and otherwise
+// estimated, for a local uncompressed log only
+func (c *Checker) preflight(ctx context.Context, path string, precount bool) error {
+	if precount {
+		rc, err := openInput(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		n, err := c.countChecks(rc)
+		if err != nil {
+			return err
+		}
+		c.ExpectedChecks = n
+		c.Logger.Printf("Precount: %d lines to check", n)
+		return nil
+	}
+	if strings.Contains(path, "://") || compressed(path) {
+		return nil
+	}
+	n, exact, err := estimateChecks(path, c.LineFilter)
+	if err != nil {
+		c.Logger.Printf("Cannot estimate the lines to check: %v", err)
+		return nil
+	}
+	if c.MaxLines > 0 && n > int64(c.MaxLines) {
+		n = int64(c.MaxLines)
+	}
+	c.ExpectedChecks = n
+	if exact {
+		c.Logger.Printf("Preflight: %d lines to check", n)
+	} else {
+		c.Logger.Printf("Preflight: about %d lines to check, estimated from the first %d KB of the log (-precount counts them exactly)", n, estimateSampleBytes>>10)
+	}
+	return nil
+}
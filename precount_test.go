@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCountChecks(t *testing.T) {
+	lines := []string{
+		logLine("db.col", primitive.NewObjectID()),
+		`2025-10-15T17:32:48.521Z,dsync,col,"INFO retrying batch"`,
+		logLine("db.col", primitive.NewObjectID()),
+		// A repeated header is not a data row
+		"Date,Pod Name,@processKey,Message",
+		logLine("db.other", primitive.NewObjectID()),
+	}
+	log := logFile(lines...)
+	path := filepath.Join(t.TempDir(), "log.csv")
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChecker(nil, nil)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n, err := c.countChecks(f)
+	if err != nil {
+		t.Fatalf("countChecks: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("countChecks = %d, want 3", n)
+	}
+	if c.RowsRead != 0 || c.HeaderRowsSkipped != 0 {
+		t.Errorf("the counting pass changed the checker: %d rows, %d headers", c.RowsRead, c.HeaderRowsSkipped)
+	}
+
+	c.MaxLines = 2
+	if n, _ := c.countChecks(strings.NewReader(log)); n != 1 {
+		t.Errorf("countChecks with -max-lines 2 = %d, want 1", n)
+	}
+
+	// A log that fits in the sample is counted exactly
+	if n, exact, err := estimateChecks(path, c.LineFilter); err != nil || !exact || n != 3 {
+		t.Errorf("estimateChecks = %d, %v, %v; want exactly 3", n, exact, err)
+	}
+	if err := c.preflight(t.Context(), path, true); err != nil || c.ExpectedChecks != 1 {
+		t.Errorf("preflight with -precount: %v, %d expected checks, want 1", err, c.ExpectedChecks)
+	}
+}
+
+func TestEstimateChecks(t *testing.T) {
+	// Twice the sample, half of whose lines are retry failures
+	var b strings.Builder
+	for b.Len() < 2*estimateSampleBytes {
+		b.WriteString(logLine("db.col", primitive.NewObjectID()) + "\n")
+		b.WriteString(`2025-10-15T17:32:48.521Z,dsync,col,"INFO retrying batch ` + strings.Repeat("x", 150) + `"` + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "log.csv")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := int64(strings.Count(b.String(), retryFailedMarker))
+	n, exact, err := estimateChecks(path, NewChecker(nil, nil).LineFilter)
+	if err != nil || exact {
+		t.Fatalf("estimateChecks = %d, %v, %v; want an estimate", n, exact, err)
+	}
+	if n < want*95/100 || n > want*105/100 {
+		t.Errorf("estimate %d, want about %d", n, want)
+	}
+}
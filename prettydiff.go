@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// maxDiffCells bounds the line-matching table of a unified diff; larger
+// documents are shown as a whole replacement instead
+const maxDiffCells = 4000000
+
+// ANSI escapes used to colorize a diff on a terminal
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+	ansiReset = "\x1b[0m"
+)
+
+// docLines renders a document as indented canonical Extended JSON, one line
+// per field, so that documents differing in a field differ in a line
+func docLines(doc bson.Raw) []string {
+	data, err := bson.MarshalExtJSONIndent(doc, true, false, "", "  ")
+	if err != nil {
+		return []string{fmt.Sprintf("<invalid document: %v>", err)}
+	}
+	return strings.Split(string(data), "\n")
+}
+
+// unifiedDocDiff renders the difference between the source and dest
+// documents in the format of diff -u
+func unifiedDocDiff(srcDoc, destDoc bson.Raw) string {
+	return unifiedDiff(docLines(srcDoc), docLines(destDoc), "source", "dest")
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// editScript returns the shortest edit script turning a into b, computed
+// from their longest common subsequence
+func editScript(a, b []string) []diffOp {
+	if len(a)*len(b) > maxDiffCells {
+		ops := make([]diffOp, 0, len(a)+len(b))
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff renders the changes from a to b as hunks with diffContext
+// lines of context. It returns "" when a and b are equal.
+func unifiedDiff(a, b []string, nameA, nameB string) string {
+	ops := editScript(a, b)
+	var sb strings.Builder
+	// lineA and lineB are the 1-based line numbers reached before ops[k]
+	lineA, lineB := 1, 1
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			lineA++
+			lineB++
+			k++
+			continue
+		}
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+
+		// Extend the hunk until more than 2*diffContext unchanged lines
+		// separate a change from the next one
+		start := max(k-diffContext, 0)
+		for start < k && ops[start].kind != ' ' {
+			start++
+		}
+		end := k
+		for end < len(ops) {
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				end = min(end+diffContext, next)
+				break
+			}
+			for next < len(ops) && ops[next].kind != ' ' {
+				next++
+			}
+			end = next
+		}
+
+		before := k - start
+		startA, startB := lineA-before, lineB-before
+		var countA, countB int
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB)
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&sb, "%c%s\n", op.kind, op.line)
+		}
+		lineA, lineB = startA+countA, startB+countB
+		k = end
+	}
+	return sb.String()
+}
+
+// printPrettyDiff writes a unified diff indented under its result, with ANSI
+// colors when color is set
+func printPrettyDiff(w io.Writer, diff string, color bool) {
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if color {
+			switch {
+			case strings.HasPrefix(line, "@@"):
+				line = ansiCyan + line + ansiReset
+			case strings.HasPrefix(line, "-"):
+				line = ansiRed + line + ansiReset
+			case strings.HasPrefix(line, "+"):
+				line = ansiGreen + line + ansiReset
+			}
+		}
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPrettyDiff(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	fields := bson.D{{Key: "_id", Value: id}}
+	for i := 0; i < 10; i++ {
+		fields = append(fields, bson.E{Key: string(rune('a' + i)), Value: int32(i)})
+	}
+	src.insert("db.col", fields)
+	changed := append(bson.D{}, fields...)
+	changed[2].Value = int32(100)                  // b
+	changed = append(changed[:9], changed[10:]...) // drop i
+	dest.insert("db.col", changed)
+
+	c := NewChecker(src, dest)
+	c.PrettyDiff = true
+	res := c.checkDoc(context.Background(), "db", "col", id)
+	if res.Status != StatusMismatch {
+		t.Fatalf("status = %s, want Mismatch", res.Status)
+	}
+	for _, want := range []string{
+		"--- source\n+++ dest\n",
+		"\n   \"b\": {\n-    \"$numberInt\": \"1\"\n+    \"$numberInt\": \"100\"\n   },\n",
+		"\n-  \"i\": {\n-    \"$numberInt\": \"8\"\n-  },\n",
+	} {
+		if !strings.Contains(res.PrettyDiff, want) {
+			t.Errorf("diff missing %q:\n%s", want, res.PrettyDiff)
+		}
+	}
+	if strings.Contains(res.PrettyDiff, `"e"`) {
+		t.Errorf("unchanged field far from any change shown:\n%s", res.PrettyDiff)
+	}
+
+	var out strings.Builder
+	printResult(&out, res, true)
+	if !strings.Contains(out.String(), ansiGreen+`+    "$numberInt": "100"`+ansiReset) {
+		t.Errorf("added line not colored:\n%q", out.String())
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	a := strings.Split("1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20", " ")
+	b := append([]string{}, a...)
+	b[1] = "two"
+	b[17] = "eighteen"
+	want := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -15,6 +15,6 @@
+ 15
+ 16
+ 17
+-18
++eighteen
+ 19
+ 20
+`
+	if got := unifiedDiff(a, b, "a", "b"); got != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got := unifiedDiff(a, a, "a", "b"); got != "" {
+		t.Errorf("diff of equal inputs = %q, want empty", got)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "sync/atomic"
+
+// Progress lets callers observe a run while it is in progress.
+//
+// The counters are updated atomically and may be read from any goroutine
+// at any time. OnResult is called once per checked id, after its result
+// has been recorded, from the goroutine that performed the check; it must
+// be safe for concurrent use and should return quickly, since it runs on
+// the checking path.
+type Progress struct {
+	Rows          atomic.Int64 // Data rows read from the log
+	Checked       atomic.Int64 // Ids checked against both sides
+	Discrepancies atomic.Int64 // Checks that produced a discrepancy
+	Errors        atomic.Int64 // Checks that failed with an error
+
+	OnResult func(CheckResult)
+}
+
+// observe counts a result and fires the callback
+func (p *Progress) observe(res CheckResult, discrepancy bool) {
+	p.Checked.Add(1)
+	if discrepancy {
+		p.Discrepancies.Add(1)
+	}
+	if failedStatus(res.Status) {
+		p.Errors.Add(1)
+	}
+	if p.OnResult != nil {
+		p.OnResult(res)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProgressOnResult(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}})
+
+	seen := make(map[primitive.ObjectID]int)
+	c := NewChecker(src, dest)
+	c.Progress = &Progress{OnResult: func(res CheckResult) {
+		seen[res.ID.(primitive.ObjectID)]++
+	}}
+
+	input := logFile(
+		logLine("db.col", match),
+		logLine("db.col", missing),
+		`2025-10-15T17:32:48.521Z,dsync,col,"INF unrelated line"`,
+	)
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(seen) != 2 || seen[match] != 1 || seen[missing] != 1 {
+		t.Errorf("OnResult calls per id = %v, want exactly one per checked id", seen)
+	}
+	if got := c.Progress.Rows.Load(); got != 3 {
+		t.Errorf("Rows = %d, want 3", got)
+	}
+	if got := c.Progress.Checked.Load(); got != 2 {
+		t.Errorf("Checked = %d, want 2", got)
+	}
+	if got := c.Progress.Discrepancies.Load(); got != 1 {
+		t.Errorf("Discrepancies = %d, want 1", got)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// repairScript writes a mongosh script that would bring dest in line with
+// source: an insertOne for every MissingInDest and a replaceOne for every
+// Mismatch. Nothing is written to the databases; an operator reviews the
+// script and runs it with mongosh.
+type repairScript struct {
+	mu    sync.Mutex // statements come from concurrent workers
+	w     *bufio.Writer
+	count int
+	err   error // first write error, returned by Flush
+}
+
+// newRepairScript writes the script header to w
+func newRepairScript(w io.Writer) *repairScript {
+	rs := &repairScript{w: bufio.NewWriter(w)}
+	_, rs.err = fmt.Fprintf(rs.w, "// Repair script written by error_checker %s at %s.\n"+
+		"// Each statement copies the source version of a document to dest. Review\n"+
+		"// it, then run it against the destination cluster: mongosh <dest-uri> <file>\n\n",
+		currentBuild().Version, time.Now().UTC().Format(time.RFC3339))
+	return rs
+}
+
+// Insert records the insertion of a document missing in dest
+func (rs *repairScript) Insert(db, col string, id interface{}, srcDoc bson.Raw) {
+	rs.statement(db, col, id, StatusMissingInDest, "insertOne", srcDoc)
+}
+
+// Replace records the replacement of the dest document whose _id is destID
+// by the source version
+func (rs *repairScript) Replace(db, col string, id, destID interface{}, srcDoc bson.Raw) {
+	rs.statement(db, col, id, StatusMismatch, "replaceOne", bson.D{{Key: "_id", Value: destID}}, srcDoc)
+}
+
+// statement writes one collection method call whose arguments are Extended
+// JSON documents, parsed back in mongosh with EJSON.parse so that every BSON
+// type survives
+func (rs *repairScript) statement(db, col string, id interface{}, status, method string, args ...interface{}) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.err != nil {
+		return
+	}
+	fmt.Fprintf(rs.w, "// %s.%s id %s: %s\n", db, col, extJSONValue(id), status)
+	fmt.Fprintf(rs.w, "db.getSiblingDB(%s).getCollection(%s).%s(", jsString(db), jsString(col), method)
+	for i, arg := range args {
+		data, err := bson.MarshalExtJSON(arg, true, false)
+		if err != nil {
+			rs.err = fmt.Errorf("%s.%s id %v: %w", db, col, id, err)
+			return
+		}
+		if i > 0 {
+			rs.w.WriteString(", ")
+		}
+		fmt.Fprintf(rs.w, "EJSON.parse(%s)", jsString(string(data)))
+	}
+	_, rs.err = rs.w.WriteString(");\n\n")
+	rs.count++
+}
+
+// Flush writes any buffered statements and returns the first write error
+func (rs *repairScript) Flush() error {
+	if rs.err != nil {
+		return rs.err
+	}
+	return rs.w.Flush()
+}
+
+// jsString quotes s as a JavaScript string literal. A JSON string is one, as
+// encoding/json escapes the line separators JavaScript does not allow.
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
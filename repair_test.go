@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// repairStatement matches one statement of a repair script and captures
+// the database, collection, method and argument list
+var repairStatement = regexp.MustCompile(`^db\.getSiblingDB\(("(?:[^"\\]|\\.)*")\)\.getCollection\(("(?:[^"\\]|\\.)*")\)\.(insertOne|replaceOne)\((.*)\);$`)
+
+// ejsonArg matches one EJSON.parse argument, capturing its string literal
+var ejsonArg = regexp.MustCompile(`EJSON\.parse\(("(?:[^"\\]|\\.)*")\)`)
+
+func TestRepairScript(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	missing, changed, same := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	missingDoc := bson.D{{Key: "_id", Value: missing}, {Key: "n", Value: int64(1)}, {Key: "q", Value: `it's "quoted"` + "\n"}}
+	changedDoc := bson.D{{Key: "_id", Value: changed}, {Key: "at", Value: primitive.NewDateTimeFromTime(primitive.NewObjectID().Timestamp())}}
+	src.insert("db.col", missingDoc)
+	src.insert("db.col", changedDoc)
+	dest.insert("db.col", bson.D{{Key: "_id", Value: changed}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: same}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: same}})
+
+	var out bytes.Buffer
+	c := NewChecker(src, dest)
+	c.Repair = newRepairScript(&out)
+	input := logFile(logLine("db.col", missing), logLine("db.col", changed), logLine("db.col", same))
+	if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := c.Repair.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	type call struct {
+		db, col, method string
+		args            []bson.Raw
+	}
+	var calls []call
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		m := repairStatement.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("not a repair statement: %s", line)
+		}
+		var cl call
+		json.Unmarshal([]byte(m[1]), &cl.db)
+		json.Unmarshal([]byte(m[2]), &cl.col)
+		cl.method = m[3]
+		args := ejsonArg.FindAllStringSubmatch(m[4], -1)
+		for _, a := range args {
+			var ext string
+			if err := json.Unmarshal([]byte(a[1]), &ext); err != nil {
+				t.Fatalf("argument is not a string literal: %s", a[1])
+			}
+			var doc bson.Raw
+			if err := bson.UnmarshalExtJSON([]byte(ext), true, &doc); err != nil {
+				t.Fatalf("argument is not Extended JSON: %s: %v", ext, err)
+			}
+			cl.args = append(cl.args, doc)
+		}
+		calls = append(calls, cl)
+	}
+
+	if len(calls) != 2 || c.Repair.count != 2 {
+		t.Fatalf("got %d statements (count %d), want 2:\n%s", len(calls), c.Repair.count, out.String())
+	}
+	want, _ := bson.Marshal(missingDoc)
+	if cl := calls[0]; cl.db != "db" || cl.col != "col" || cl.method != "insertOne" || len(cl.args) != 1 || !bytes.Equal(cl.args[0], want) {
+		t.Errorf("unexpected insert %+v", cl)
+	}
+	want, _ = bson.Marshal(changedDoc)
+	filter, _ := bson.Marshal(bson.D{{Key: "_id", Value: changed}})
+	if cl := calls[1]; cl.method != "replaceOne" || len(cl.args) != 2 || !bytes.Equal(cl.args[0], filter) || !bytes.Equal(cl.args[1], want) {
+		t.Errorf("unexpected replace %+v", cl)
+	}
+}
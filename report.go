@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// printReport writes the human readable analysis report, rendered with the
+// built-in template
+func printReport(w io.Writer, c *Checker) {
+	writeTextReport(w, c, defaultReport)
+}
+
+// printRecentErrors lists the last errors of the run, oldest first
+func printRecentErrors(w io.Writer, r *errorRing) {
+	if r == nil || r.total == 0 {
+		return
+	}
+	errs := r.Errors()
+	fmt.Fprintf(w, "\n=== Recent Errors (last %d of %d) ===\n", len(errs), r.total)
+	for _, e := range errs {
+		if e.Namespace == "" {
+			fmt.Fprintf(w, "Line %d: %s\n", e.Line, e.Message)
+		} else {
+			fmt.Fprintf(w, "Line %d [%s]: %s\n", e.Line, e.Namespace, e.Message)
+		}
+	}
+}
+
+// printResult writes a single check result, including its field differences
+// and its unified diff, colorized when color is set
+func printResult(w io.Writer, res CheckResult, color bool) {
+	fmt.Fprintf(w, "[%s] ID: %s | Status: %s | Details: %s\n", res.Namespace, formatID(res.ID), res.Status, res.Details)
+	for _, d := range res.Diffs {
+		fmt.Fprintf(w, "  %s\n", d)
+	}
+	if res.PrettyDiff != "" {
+		printPrettyDiff(w, res.PrettyDiff, color)
+	}
+}
+
+// offender is a namespace ranked by its number of discrepancies
+type offender struct {
+	Namespace     string `json:"namespace"`
+	Discrepancies int    `json:"discrepancies"`
+}
+
+// topOffenders returns up to n namespaces with discrepancies, most first
+func topOffenders(statsMap map[string]*Stats, n int) []offender {
+	var list []offender
+	for ns, s := range statsMap {
+		if d := s.Discrepancies(); d > 0 {
+			list = append(list, offender{Namespace: ns, Discrepancies: d})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Discrepancies != list[j].Discrepancies {
+			return list[i].Discrepancies > list[j].Discrepancies
+		}
+		return list[i].Namespace < list[j].Namespace
+	})
+	if n >= 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func printTopOffenders(w io.Writer, list []offender) {
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Top Offenders ===")
+	for i, o := range list {
+		fmt.Fprintf(w, "%d. %s: %d discrepancies\n", i+1, o.Namespace, o.Discrepancies)
+	}
+}
+
+// zeroCoverage returns the namespaces of the log that no check covered:
+// every line was unparsable, skipped or failed with an error. Their stats
+// exist, but nothing about them was verified.
+func zeroCoverage(statsMap map[string]*Stats) []string {
+	var list []string
+	for ns, s := range statsMap {
+		if s.Covered() == 0 {
+			list = append(list, ns)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func printZeroCoverage(w io.Writer, statsMap map[string]*Stats) {
+	list := zeroCoverage(statsMap)
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Zero-Coverage Namespaces ===")
+	for _, ns := range list {
+		s := statsMap[ns]
+		fmt.Fprintf(w, "%s: %d unparsable ids, %d errors, %d timeouts, %d skipped\n", ns, s.ParseFailures, s.Errors, s.Timeouts, s.Skipped)
+	}
+}
+
+// printCategories writes the error category tallies, overall and per namespace
+func printCategories(w io.Writer, statsMap map[string]*Stats) {
+	totals := make(map[string]int)
+	for _, s := range statsMap {
+		for cat, n := range s.Categories {
+			totals[cat] += n
+		}
+	}
+	if len(totals) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\n=== Error Categories ===")
+	for _, cat := range sortedByCount(totals) {
+		fmt.Fprintf(w, "%s: %d\n", cat, totals[cat])
+	}
+	for ns, s := range statsMap {
+		if len(s.Categories) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\nNamespace: %s\n", ns)
+		for _, cat := range sortedByCount(s.Categories) {
+			fmt.Fprintf(w, "  %s: %d\n", cat, s.Categories[cat])
+		}
+	}
+}
+
+// sortedByCount returns the keys of counts, highest count first
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// reportSchemaVersion is the schemaVersion of JSON reports. It changes only
+// when a field is renamed, removed or changes type; new fields may be added
+// without a change.
+const reportSchemaVersion = 1
+
+// jsonReport is the document written by -output json
+type jsonReport struct {
+	SchemaVersion        int                `json:"schemaVersion"`
+	Metadata             jsonMetadata       `json:"metadata"`
+	RowsRead             int                `json:"rowsRead"`
+	MatchedLines         int                `json:"matchedLines"`
+	Truncated            bool               `json:"truncated"`
+	StopReason           string             `json:"stopReason,omitempty"`
+	LogAge               *jsonAgeStats      `json:"logAge,omitempty"`
+	TimeHistogram        *jsonTimeHistogram `json:"timeHistogram,omitempty"`
+	HeaderRowsSkipped    int                `json:"headerRowsSkipped"`
+	OversizedLines       int                `json:"oversizedLines"`
+	UnresolvedNamespaces int                `json:"unresolvedNamespaces"`
+	SkippedLines         map[string]int     `json:"skippedLines,omitempty"`
+	DedupEvictions       int                `json:"dedupEvictions"`
+	CompareCacheHits     int                `json:"compareCacheHits"`
+	Namespaces           map[string]*Stats  `json:"namespaces"`
+	TopOffenders         []offender         `json:"topOffenders"`
+	ZeroCoverage         []string           `json:"zeroCoverage"`
+	CollationDiffs       []CollationDiff    `json:"collationDiffs,omitempty"`
+	QueryPlans           []queryPlan        `json:"queryPlans,omitempty"`
+	SignOff              []signOff          `json:"signOff,omitempty"`
+	Discrepancies        []jsonResult       `json:"discrepancies"`
+}
+
+// jsonMetadata describes the run that produced a report
+type jsonMetadata struct {
+	Build     BuildInfo         `json:"build"`
+	StartTime time.Time         `json:"startTime"`
+	EndTime   time.Time         `json:"endTime"`
+	Source    string            `json:"source,omitempty"` // redacted URI
+	Dest      string            `json:"dest,omitempty"`   // redacted URI or dump path
+	Flags     map[string]string `json:"flags,omitempty"`  // every flag in effect, URIs redacted
+}
+
+// newJSONMetadata returns the metadata of a run starting now
+func newJSONMetadata() jsonMetadata {
+	now := time.Now().UTC()
+	return jsonMetadata{Build: currentBuild(), StartTime: now, EndTime: now}
+}
+
+// jsonResult is a CheckResult with its id and documents as Extended JSON
+type jsonResult struct {
+	Namespace string          `json:"namespace"`
+	Line      int             `json:"line,omitempty"`
+	ID        json.RawMessage `json:"id"`
+	Status    string          `json:"status"`
+	Details   string          `json:"details,omitempty"`
+	ErrClass  string          `json:"errClass,omitempty"`
+	Diffs     []FieldDiff     `json:"diffs,omitempty"`
+	SourceDoc json.RawMessage `json:"sourceDoc,omitempty"`
+	DestDoc   json.RawMessage `json:"destDoc,omitempty"`
+
+	PrettyDiff string `json:"prettyDiff,omitempty"`
+}
+
+// writeJSONReport writes the report of a finished run as a single JSON document
+func writeJSONReport(w io.Writer, c *Checker) error {
+	jw, err := newJSONReportWriter(w, c.DumpMaxBytes)
+	if err != nil {
+		return err
+	}
+	for _, d := range c.DiscrepancyList {
+		jw.WriteResult(d)
+	}
+	return jw.Finish(c)
+}
+
+func newJSONResult(res CheckResult, dumpMaxBytes int) jsonResult {
+	jr := jsonResult{
+		Namespace: res.Namespace,
+		Line:      res.Line,
+		ID:        extJSONValue(res.ID),
+		Status:    res.Status,
+		Details:   res.Details,
+		ErrClass:  res.ErrClass,
+		Diffs:     res.Diffs,
+
+		PrettyDiff: res.PrettyDiff,
+	}
+	if res.SourceDoc != nil {
+		jr.SourceDoc = dumpDoc(res.SourceDoc, dumpMaxBytes)
+	}
+	if res.DestDoc != nil {
+		jr.DestDoc = dumpDoc(res.DestDoc, dumpMaxBytes)
+	}
+	return jr
+}
+
+// extJSONValue renders a single value as canonical Extended JSON
+func extJSONValue(v interface{}) json.RawMessage {
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, true, false)
+	if err != nil {
+		quoted, _ := json.Marshal(fmt.Sprintf("%v", v))
+		return quoted
+	}
+	var wrapper struct {
+		V json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		quoted, _ := json.Marshal(fmt.Sprintf("%v", v))
+		return quoted
+	}
+	return wrapper.V
+}
+
+// formatID renders an id for the text report. Scalars print as is; compound
+// ids, arrays and documents, as relaxed Extended JSON, which %v would
+// flatten into an ambiguous [tenant-1 42].
+func formatID(id interface{}) string {
+	switch id.(type) {
+	case bson.A, bson.D:
+		data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: id}}, false, false)
+		if err == nil {
+			return string(data[len(`{"v":`) : len(data)-1])
+		}
+	}
+	return fmt.Sprint(id)
+}
+
+// dumpDoc renders a document as canonical Extended JSON, which round-trips
+// through bson.UnmarshalExtJSON. Documents larger than maxBytes of BSON are
+// replaced by a marker recording their size.
+func dumpDoc(doc bson.Raw, maxBytes int) json.RawMessage {
+	if maxBytes > 0 && len(doc) > maxBytes {
+		return json.RawMessage(fmt.Sprintf(`{"truncated":true,"bsonBytes":%d}`, len(doc)))
+	}
+	data, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		quoted, _ := json.Marshal(fmt.Sprintf("unrenderable document: %v", err))
+		return quoted
+	}
+	return data
+}
+
+// printIndexReport writes the result of -mode indexes
+func printIndexReport(w io.Writer, namespaces []string, diffs []IndexDiff) {
+	fmt.Fprintln(w, "\n=== Index Report ===")
+	fmt.Fprintf(w, "Namespaces checked: %d\n", len(namespaces))
+	fmt.Fprintf(w, "Index differences: %d\n", len(diffs))
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Index Differences ===")
+	for _, d := range diffs {
+		fmt.Fprintln(w, d)
+		for _, fd := range d.Diffs {
+			fmt.Fprintf(w, "  %s\n", fd)
+		}
+	}
+}
+
+// jsonIndexReport is the document written by -mode indexes -output json
+type jsonIndexReport struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Metadata      jsonMetadata `json:"metadata"`
+	Namespaces    []string     `json:"namespaces"`
+	IndexDiffs    []IndexDiff  `json:"indexDiffs"`
+}
+
+func writeIndexReport(w io.Writer, meta jsonMetadata, namespaces []string, diffs []IndexDiff) error {
+	meta.EndTime = time.Now().UTC()
+	if diffs == nil {
+		diffs = []IndexDiff{}
+	}
+	return json.NewEncoder(w).Encode(jsonIndexReport{
+		SchemaVersion: reportSchemaVersion,
+		Metadata:      meta,
+		Namespaces:    namespaces,
+		IndexDiffs:    diffs,
+	})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDumpDocsRoundTrip(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	srcDoc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "n", Value: int64(42)},
+		{Key: "at", Value: primitive.NewDateTimeFromTime(time.Unix(1700000000, 0))},
+		{Key: "dec", Value: primitive.NewDecimal128(0, 15)},
+	}
+	src.insert("db.col", srcDoc)
+	dest.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "n", Value: int32(42)}})
+
+	c := NewChecker(src, dest)
+	c.DumpDocs = true
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", id)))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := writeJSONReport(&out, c); err != nil {
+		t.Fatalf("writeJSONReport: %v", err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].Status != StatusMismatch {
+		t.Fatalf("expected one Mismatch, got %+v", report.Discrepancies)
+	}
+
+	var roundTrip bson.Raw
+	if err := bson.UnmarshalExtJSON(report.Discrepancies[0].SourceDoc, true, &roundTrip); err != nil {
+		t.Fatalf("dumped source doc is not Extended JSON: %v", err)
+	}
+	want, _ := bson.Marshal(srcDoc)
+	if !bytes.Equal(roundTrip, want) {
+		t.Errorf("source doc did not round-trip:\ngot  %s\nwant %s", roundTrip, bson.Raw(want))
+	}
+	if report.Discrepancies[0].DestDoc == nil {
+		t.Error("dest doc was not dumped")
+	}
+}
+
+func TestDumpDocMaxBytes(t *testing.T) {
+	doc, _ := bson.Marshal(bson.D{{Key: "blob", Value: strings.Repeat("x", 100)}})
+	got := string(dumpDoc(doc, 50))
+	if !strings.Contains(got, `"truncated":true`) || strings.Contains(got, "xxx") {
+		t.Errorf("oversized document was not replaced by a marker: %s", got)
+	}
+	if got := string(dumpDoc(doc, 0)); !strings.Contains(got, "xxx") {
+		t.Errorf("uncapped dump lost the document: %s", got)
+	}
+}
+
+func TestTopOffenders(t *testing.T) {
+	statsMap := map[string]*Stats{
+		"db.a": {Mismatches: 1},
+		"db.b": {Mismatches: 2, MissingInDest: 3},
+		"db.c": {MissingInSource: 5},
+		"db.d": {Matches: 100},
+		"db.e": {IDTypeMismatches: 1},
+	}
+	got := topOffenders(statsMap, 3)
+	want := []offender{{"db.b", 5}, {"db.c", 5}, {"db.a", 1}}
+	if len(got) != len(want) {
+		t.Fatalf("topOffenders = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("topOffenders[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	var out strings.Builder
+	printTopOffenders(&out, got)
+	if !strings.Contains(out.String(), "1. db.b: 5 discrepancies") {
+		t.Errorf("unexpected text output:\n%s", out.String())
+	}
+}
+
+func TestZeroCoverage(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("db.ok", bson.D{{Key: "_id", Value: id}})
+	dest.insert("db.ok", bson.D{{Key: "_id", Value: id}})
+
+	// Every line of db.bad has an id that does not parse
+	bad := `2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed retryErr=""E11000 duplicate key error collection: db.bad index: _id_"" id=""{\""$oid\"":\""6938\""}"" key=1"`
+	c := NewChecker(src, dest)
+	c.Logger = log.New(io.Discard, "", 0)
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.ok", id), bad, bad))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s := c.StatsMap["db.bad"]; s == nil || s.ParseFailures != 2 || s.TotalChecks != 0 {
+		t.Fatalf("db.bad stats = %+v, want 2 parse failures and no checks", s)
+	}
+	if got := zeroCoverage(c.StatsMap); len(got) != 1 || got[0] != "db.bad" {
+		t.Errorf("zeroCoverage = %v, want [db.bad]", got)
+	}
+
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "=== Zero-Coverage Namespaces ===\ndb.bad: 2 unparsable ids, 0 errors, 0 timeouts, 0 skipped\n") {
+		t.Errorf("report does not list db.bad as zero-coverage:\n%s", out.String())
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONReport(&buf, c); err != nil {
+		t.Fatalf("writeJSONReport: %v", err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if len(report.ZeroCoverage) != 1 || report.ZeroCoverage[0] != "db.bad" {
+		t.Errorf("JSON zeroCoverage = %v, want [db.bad]", report.ZeroCoverage)
+	}
+}
+
+func TestJSONReportSchema(t *testing.T) {
+	c := NewChecker(newFakeSource(), newFakeSource())
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", primitive.NewObjectID())))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var out bytes.Buffer
+	if err := writeJSONReport(&out, c); err != nil {
+		t.Fatalf("writeJSONReport: %v", err)
+	}
+
+	var report map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	isNumber := func(v interface{}) bool { _, ok := v.(float64); return ok }
+	isBool := func(v interface{}) bool { _, ok := v.(bool); return ok }
+	isObject := func(v interface{}) bool { _, ok := v.(map[string]interface{}); return ok }
+	isArray := func(v interface{}) bool { _, ok := v.([]interface{}); return ok }
+	fields := map[string]func(interface{}) bool{
+		"schemaVersion":     isNumber,
+		"metadata":          isObject,
+		"discrepancies":     isArray,
+		"rowsRead":          isNumber,
+		"truncated":         isBool,
+		"dedupEvictions":    isNumber,
+		"headerRowsSkipped": isNumber,
+		"namespaces":        isObject,
+		"topOffenders":      isArray,
+		"zeroCoverage":      isArray,
+	}
+	for name, check := range fields {
+		v, ok := report[name]
+		if !ok {
+			t.Errorf("missing top-level field %q", name)
+		} else if !check(v) {
+			t.Errorf("field %q has unexpected type %T", name, v)
+		}
+	}
+	if v := report["schemaVersion"]; v != float64(reportSchemaVersion) {
+		t.Errorf("schemaVersion = %v, want %d", v, reportSchemaVersion)
+	}
+
+	meta := report["metadata"].(map[string]interface{})
+	for _, name := range []string{"startTime", "endTime"} {
+		s, ok := meta[name].(string)
+		if _, err := time.Parse(time.RFC3339Nano, s); !ok || err != nil {
+			t.Errorf("metadata.%s = %v, want an RFC 3339 time", name, meta[name])
+		}
+	}
+	if !isObject(meta["build"]) {
+		t.Errorf("metadata.build = %v, want an object", meta["build"])
+	}
+}
+
+func TestReportTemplate(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}})
+	c := NewChecker(src, dest)
+	c.Logger = log.New(io.Discard, "", 0)
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", match), logLine("db.col", missing)))); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "slack.tmpl")
+	text := `{{range $ns, $s := .StatsMap}}*{{$ns}}*: {{$s.Matches}}/{{$s.TotalChecks}} ok
+{{end}}{{range .DiscrepancyList}}• {{formatID .ID}} {{.Status}}
+{{end}}`
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := loadReportTemplate(path)
+	if err != nil {
+		t.Fatalf("loadReportTemplate: %v", err)
+	}
+	var out strings.Builder
+	if err := writeTextReport(&out, c, tmpl); err != nil {
+		t.Fatalf("writeTextReport: %v", err)
+	}
+	want := "*db.col*: 1/2 ok\n• " + formatID(missing) + " MissingInDest\n"
+	if out.String() != want {
+		t.Errorf("report = %q, want %q", out.String(), want)
+	}
+
+	// A broken template is refused when it is loaded
+	if err := os.WriteFile(path, []byte(`{{range .StatsMap}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadReportTemplate(path); err == nil {
+		t.Error("loadReportTemplate accepted a broken template")
+	}
+
+	// Templates see the outcome of the run, not the Checker's clients
+	for _, text := range []string{`{{.Src}}`, `{{.Dest.FindOne}}`} {
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tmpl, err := loadReportTemplate(path)
+		if err != nil {
+			t.Fatalf("loadReportTemplate: %v", err)
+		}
+		if err := writeTextReport(io.Discard, c, tmpl); err == nil {
+			t.Errorf("template %s reached the Checker", text)
+		}
+	}
+}
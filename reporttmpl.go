@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// reportData is what a report template is executed with: a read-only view
+// of the outcome of a run, under the names of the Checker fields and
+// methods it is taken from, so that a template can neither reach the
+// clients nor change the run
+type reportData struct {
+	StatsMap        map[string]*Stats
+	DiscrepancyList []CheckResult
+
+	RowsRead             int
+	MatchedLines         int
+	NoMatches            bool
+	Truncated            bool
+	HeaderRowsSkipped    int
+	OversizedLines       int
+	MaxLineBytes         int
+	UnresolvedNamespaces int
+	SkippedLines         map[string]int
+	StopReason           string
+	StopFlag             string
+	LogAge               *ageStats
+	TimeHistogram        *timeHistogram
+
+	DedupCacheSize   int
+	DedupEvictions   int
+	CompareCacheHits int
+	CollationDiffs   []CollationDiff
+	QueryPlans       []queryPlan
+	SignOff          []signOff
+
+	TopN         int
+	Color        bool
+	DumpMaxBytes int
+
+	RecentErrors      []recentError
+	RecentErrorsTotal int
+	recentErrors      *errorRing
+}
+
+// newReportData returns the view of c a report template is executed with
+func newReportData(c *Checker) reportData {
+	logAge := c.LogAge
+	d := reportData{
+		StatsMap:             c.StatsMap,
+		DiscrepancyList:      c.DiscrepancyList,
+		RowsRead:             c.RowsRead,
+		MatchedLines:         c.MatchedLines,
+		NoMatches:            c.NoMatches(),
+		Truncated:            c.Truncated,
+		HeaderRowsSkipped:    c.HeaderRowsSkipped,
+		OversizedLines:       c.OversizedLines,
+		MaxLineBytes:         c.MaxLineBytes,
+		UnresolvedNamespaces: c.UnresolvedNamespaces,
+		SkippedLines:         c.SkippedLines,
+		StopReason:           c.StopReason,
+		StopFlag:             c.StopFlag,
+		LogAge:               &logAge,
+		TimeHistogram:        c.TimeHistogram,
+		DedupCacheSize:       c.DedupCacheSize,
+		DedupEvictions:       c.DedupEvictions(),
+		CompareCacheHits:     c.CompareCacheHits(),
+		CollationDiffs:       c.CollationDiffs(),
+		QueryPlans:           c.QueryPlans(),
+		SignOff:              c.SignOff(),
+		TopN:                 c.TopN,
+		Color:                c.Color,
+		DumpMaxBytes:         c.DumpMaxBytes,
+		recentErrors:         c.recentErrors,
+	}
+	if r := c.recentErrors; r != nil && r.total > 0 {
+		d.RecentErrors, d.RecentErrorsTotal = r.Errors(), r.total
+	}
+	return d
+}
+
+// reportFuncs are the functions available to report templates. The *Text
+// ones render a whole section of the built-in report.
+var reportFuncs = template.FuncMap{
+	"formatID":      formatID,
+	"sortedByCount": sortedByCount,
+	"topOffenders":  topOffenders,
+	"zeroCoverage":  zeroCoverage,
+	"dumpDoc": func(doc bson.Raw, maxBytes int) string {
+		return string(dumpDoc(doc, maxBytes))
+	},
+	"round": func(d time.Duration) time.Duration {
+		return d.Round(time.Second)
+	},
+	"inc": func(i int) int {
+		return i + 1
+	},
+	"topOffendersText": func(statsMap map[string]*Stats, n int) string {
+		return sectionText(func(w io.Writer) { printTopOffenders(w, topOffenders(statsMap, n)) })
+	},
+	"zeroCoverageText": func(statsMap map[string]*Stats) string {
+		return sectionText(func(w io.Writer) { printZeroCoverage(w, statsMap) })
+	},
+	"collationDiffsText": func(diffs []CollationDiff) string {
+		return sectionText(func(w io.Writer) { printCollationDiffs(w, diffs) })
+	},
+	"queryPlansText": func(plans []queryPlan) string {
+		return sectionText(func(w io.Writer) { printQueryPlans(w, plans) })
+	},
+	"skippedLinesText": func(skipped map[string]int) string {
+		return sectionText(func(w io.Writer) { printSkippedLines(w, skipped) })
+	},
+	"timeHistogramText": func(h *timeHistogram) string {
+		return sectionText(func(w io.Writer) { printTimeHistogram(w, h) })
+	},
+	"signOffText": func(list []signOff) string {
+		return sectionText(func(w io.Writer) { printSignOff(w, list) })
+	},
+	"categoriesText": func(statsMap map[string]*Stats) string {
+		return sectionText(func(w io.Writer) { printCategories(w, statsMap) })
+	},
+	"recentErrorsText": func(d reportData) string {
+		return sectionText(func(w io.Writer) { printRecentErrors(w, d.recentErrors) })
+	},
+	"prettyDiffText": func(diff string, color bool) string {
+		return sectionText(func(w io.Writer) { printPrettyDiff(w, diff, color) })
+	},
+}
+
+// sectionText returns what print writes
+func sectionText(print func(w io.Writer)) string {
+	var b strings.Builder
+	print(&b)
+	return b.String()
+}
+
+// defaultReportTemplate is the built-in text report. Sections start with a
+// blank line and every line ends with a newline.
+const defaultReportTemplate = `
+=== Analysis Report ===
+{{if .NoMatches}}
+WARNING: no log line matched the filter after {{.RowsRead}} data rows; nothing was checked
+{{end}}
+{{- if .Truncated}}
+WARNING: input truncated after {{.RowsRead}} data rows (-max-lines); results are partial
+{{end}}
+{{- if .HeaderRowsSkipped}}
+Repeated header rows skipped: {{.HeaderRowsSkipped}}
+{{end}}
+{{- if .OversizedLines}}
+Oversized lines skipped: {{.OversizedLines}} (-max-line-bytes {{.MaxLineBytes}})
+{{end}}
+{{- if .UnresolvedNamespaces}}
+Lines skipped, collection logged without its database: {{.UnresolvedNamespaces}} (-default-db, -collection-db-map)
+{{end}}
+{{- if .StopReason}}
+WARNING: run stopped ({{.StopFlag}}), {{.StopReason}}; results are partial
+{{end}}
+{{- with .DedupEvictions}}
+Dedup cache evictions: {{.}} (-dedup-cache-size {{$.DedupCacheSize}}); evicted ids may have been checked more than once
+{{end}}
+{{- with .CompareCacheHits}}
+Comparison cache hits: {{.}} (document pairs with the content of an earlier pair, not compared again)
+{{end}}
+{{- range $ns, $s := .StatsMap}}
+Namespace: {{$ns}}
+  Total Checks: {{$s.TotalChecks}}
+  Matches: {{$s.Matches}}
+  Mismatches: {{$s.Mismatches}}
+  Missing in Source: {{$s.MissingInSource}}
+  Missing in Dest: {{$s.MissingInDest}}
+  Errors: {{$s.Errors}}
+{{range sortedByCount $s.ErrorClasses}}    {{.}}: {{index $s.ErrorClasses .}}
+{{end}}
+{{- if $s.Timeouts}}  Timeouts: {{$s.Timeouts}}
+{{end}}
+{{- if $s.NotInSource}}  Not in Source (dest not queried): {{$s.NotInSource}}
+{{end}}
+{{- if $s.SkippedOld}}  Skipped Old (before -modified-since, dest not queried): {{$s.SkippedOld}}
+{{end}}
+{{- if $s.OutsideCapWindow}}  Outside Cap Window (capped, on one side only): {{$s.OutsideCapWindow}}
+{{end}}
+{{- if $s.MissingInBoth}}  Missing in Both: {{$s.MissingInBoth}}
+{{end}}
+{{- if $s.RootMissing}}  Compare Root Missing: {{$s.RootMissing}}
+{{end}}
+{{- if $s.DuplicateIDs}}  Duplicate _id: {{$s.DuplicateIDs}}
+{{end}}
+{{- if $s.DecodeErrors}}  Decode Errors (unreadable documents): {{$s.DecodeErrors}}
+{{end}}
+{{- if $s.MultipleMatches}}  Multiple Matches: {{$s.MultipleMatches}}
+{{end}}
+{{- if $s.IDTypeMismatches}}  _id Type Mismatches: {{$s.IDTypeMismatches}}
+{{end}}
+{{- if $s.Skipped}}  Skipped (previously matched): {{$s.Skipped}}
+{{end}}
+{{- if $s.Duplicates}}  Duplicates (already checked): {{$s.Duplicates}}
+{{end}}
+{{- if $s.ParseFailures}}  Unparsable Ids: {{$s.ParseFailures}}
+{{end}}
+{{- with $s.Sizes}}  Document Sizes ({{.Compared}} compared): source {{.SourceBytes}} bytes, dest {{.DestBytes}} bytes, delta {{printf "%+d" .Delta}} bytes ({{printf "%+.2f" .DeltaPercent}}%, mean {{printf "%+.1f" .MeanDelta}} per document); {{.Grown}} grew, {{.Shrunk}} shrank
+{{end}}
+{{- with $s.Attempts}}  Failures by Retry Attempt:
+{{range $a, $n := .}}    attempt {{$a}}: {{$n}}
+{{end}}
+{{- end}}
+{{- end}}
+{{- if .LogAge.Count}}
+Log Entry Age at Check ({{.LogAge.Count}} entries): min {{round .LogAge.Min}}, median {{round .LogAge.Median}}, max {{round .LogAge.Max}}
+{{end}}
+{{- skippedLinesText .SkippedLines}}
+{{- timeHistogramText .TimeHistogram}}
+{{- topOffendersText .StatsMap .TopN}}
+{{- zeroCoverageText .StatsMap}}
+{{- collationDiffsText .CollationDiffs}}
+{{- queryPlansText .QueryPlans}}
+{{- signOffText .SignOff}}
+{{- categoriesText .StatsMap}}
+{{- recentErrorsText .}}
+{{- with .DiscrepancyList}}
+=== Discrepancies ===
+{{range .}}[{{.Namespace}}] {{with .Line}}Line: {{.}} | {{end}}ID: {{formatID .ID}} | Status: {{.Status}} | Details: {{.Details}}
+{{with .PrettyDiff}}{{prettyDiffText . $.Color}}{{end}}
+{{- with .SourceDoc}}  Source: {{dumpDoc . $.DumpMaxBytes}}
+{{end}}
+{{- with .DestDoc}}  Dest:   {{dumpDoc . $.DumpMaxBytes}}
+{{end}}
+{{- end}}
+{{- end}}`
+
+// defaultReport is the parsed defaultReportTemplate
+var defaultReport = template.Must(template.New("report").Funcs(reportFuncs).Parse(defaultReportTemplate))
+
+// loadReportTemplate parses the -report-template file at path, so that a
+// broken template fails the run before it starts
+func loadReportTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("report").Funcs(reportFuncs).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid -report-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// writeTextReport renders the report of c with tmpl
+func writeTextReport(w io.Writer, c *Checker, tmpl *template.Template) error {
+	return tmpl.Execute(w, newReportData(c))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Results writer limits: the largest number of results inserted at once
+// into the -results-collection, the most results queued before further ones
+// are dropped, and the time one batch may take to insert
+const (
+	resultsBatchSize     = 500
+	resultsQueueLimit    = 100000
+	resultsInsertTimeout = 30 * time.Second
+)
+
+// resultsInserter is where results are inserted: a collection
+type resultsInserter interface {
+	InsertMany(ctx context.Context, docs []interface{}) error
+}
+
+// collectionInserter is the resultsInserter of a collection
+type collectionInserter struct {
+	col *mongo.Collection
+}
+
+func (ci collectionInserter) InsertMany(ctx context.Context, docs []interface{}) error {
+	_, err := ci.col.InsertMany(ctx, docs)
+	return err
+}
+
+// resultDoc is the document a result is stored as in the results collection
+type resultDoc struct {
+	RunID     string      `bson:"runId"`
+	Time      time.Time   `bson:"time"`
+	Namespace string      `bson:"namespace"`
+	Line      int         `bson:"line,omitempty"`
+	ID        interface{} `bson:"id"`
+	Status    string      `bson:"status"`
+	Details   string      `bson:"details,omitempty"`
+	ErrClass  string      `bson:"errClass,omitempty"`
+}
+
+// resultsWriter inserts every result of a run, tagged with its run id, into
+// a collection, so that drift can be queried across runs. Results are queued
+// and inserted in batches by a goroutine of its own: a slow results cluster
+// grows the queue, up to limit results, rather than slowing the checks down;
+// past it, results are dropped and counted.
+type resultsWriter struct {
+	runID   string
+	ins     resultsInserter
+	limit   int
+	timeout time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []interface{}
+	closed  bool
+	err     error // first insert error; later results are dropped
+	written int
+	dropped int // results dropped because the queue was full
+
+	done chan struct{}
+}
+
+// newResultsWriter starts inserting the results of run runID into ins
+func newResultsWriter(ins resultsInserter, runID string) *resultsWriter {
+	rw := &resultsWriter{runID: runID, ins: ins, limit: resultsQueueLimit, timeout: resultsInsertTimeout, done: make(chan struct{})}
+	rw.cond = sync.NewCond(&rw.mu)
+	go rw.loop()
+	return rw
+}
+
+// WriteResult queues res for insertion, or drops it when the queue is full.
+// It never blocks on the database.
+func (rw *resultsWriter) WriteResult(res CheckResult) {
+	doc := resultDoc{RunID: rw.runID, Time: time.Now().UTC(), Namespace: res.Namespace,
+		Line: res.Line, ID: res.ID, Status: res.Status, Details: res.Details, ErrClass: res.ErrClass}
+	rw.mu.Lock()
+	switch {
+	case rw.err != nil || rw.closed:
+	case len(rw.pending) >= rw.limit:
+		rw.dropped++
+	default:
+		rw.pending = append(rw.pending, doc)
+		rw.cond.Signal()
+	}
+	rw.mu.Unlock()
+}
+
+// loop inserts the queued results, up to resultsBatchSize at a time, until
+// the writer is closed and the queue drained
+func (rw *resultsWriter) loop() {
+	defer close(rw.done)
+	for {
+		rw.mu.Lock()
+		for len(rw.pending) == 0 && !rw.closed {
+			rw.cond.Wait()
+		}
+		if len(rw.pending) == 0 {
+			rw.mu.Unlock()
+			return
+		}
+		n := min(len(rw.pending), resultsBatchSize)
+		batch := rw.pending[:n:n]
+		rw.pending = rw.pending[n:]
+		rw.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), rw.timeout)
+		err := rw.ins.InsertMany(ctx, batch)
+		cancel()
+
+		rw.mu.Lock()
+		if err != nil {
+			rw.err, rw.pending = err, nil
+		} else {
+			rw.written += n
+		}
+		rw.mu.Unlock()
+	}
+}
+
+// Close waits for the queued results to be inserted and returns the first
+// insert error
+func (rw *resultsWriter) Close() error {
+	rw.mu.Lock()
+	rw.closed = true
+	rw.cond.Signal()
+	rw.mu.Unlock()
+	<-rw.done
+	return rw.err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeCollection is a results collection in memory
+type fakeCollection struct {
+	mu      sync.Mutex
+	docs    []resultDoc
+	batches int
+	err     error
+}
+
+func (fc *fakeCollection) InsertMany(ctx context.Context, docs []interface{}) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.err != nil {
+		return fc.err
+	}
+	fc.batches++
+	for _, d := range docs {
+		fc.docs = append(fc.docs, d.(resultDoc))
+	}
+	return nil
+}
+
+func TestResultsWriter(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	match, mismatch, onlySrc := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: match}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 1}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: mismatch}, {Key: "v", Value: 2}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: onlySrc}})
+
+	col := &fakeCollection{}
+	rw := newResultsWriter(col, "run1")
+	c := NewChecker(src, dest)
+	c.Results = rw
+	lines := []string{logLine("db.col", match), logLine("db.col", mismatch), logLine("db.col", onlySrc)}
+	if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Every result is inserted, matches included
+	want := map[primitive.ObjectID]string{match: StatusMatch, mismatch: StatusMismatch, onlySrc: StatusMissingInDest}
+	if len(col.docs) != len(want) || rw.written != len(want) {
+		t.Fatalf("%d results inserted (%d counted), want %d", len(col.docs), rw.written, len(want))
+	}
+	for _, d := range col.docs {
+		if d.RunID != "run1" || d.Namespace != "db.col" || d.Time.IsZero() || d.Status != want[d.ID.(primitive.ObjectID)] {
+			t.Errorf("inserted %+v", d)
+		}
+	}
+}
+
+func TestResultsWriterBatches(t *testing.T) {
+	col := &fakeCollection{}
+	rw := newResultsWriter(col, "run1")
+	for i := 0; i < 3*resultsBatchSize; i++ {
+		rw.WriteResult(CheckResult{Namespace: "db.col", ID: i, Status: StatusMatch})
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(col.docs) != 3*resultsBatchSize || col.batches < 3 {
+		t.Errorf("%d results in %d batches, want %d in at least 3", len(col.docs), col.batches, 3*resultsBatchSize)
+	}
+
+	// An insert error is returned by Close, and later results are dropped
+	col = &fakeCollection{err: errors.New("not authorized")}
+	rw = newResultsWriter(col, "run2")
+	rw.WriteResult(CheckResult{Namespace: "db.col", ID: 1, Status: StatusMatch})
+	if err := rw.Close(); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("Close after a failed insert returned %v", err)
+	}
+}
+
+// blockingCollection is a results collection whose inserts wait for release,
+// or for their deadline
+type blockingCollection struct {
+	release  chan struct{}
+	deadline bool
+}
+
+func (bc *blockingCollection) InsertMany(ctx context.Context, docs []interface{}) error {
+	_, bc.deadline = ctx.Deadline()
+	select {
+	case <-bc.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestResultsWriterLimits(t *testing.T) {
+	// Past the queue limit, results are dropped and counted
+	col := &blockingCollection{release: make(chan struct{})}
+	rw := newResultsWriter(col, "run1")
+	rw.limit = 10
+	for i := 0; i < 30; i++ {
+		rw.WriteResult(CheckResult{Namespace: "db.col", ID: i, Status: StatusMatch})
+	}
+	rw.mu.Lock()
+	queued, dropped := len(rw.pending), rw.dropped
+	rw.mu.Unlock()
+	if queued > rw.limit || queued+dropped < 20 {
+		t.Errorf("%d results queued and %d dropped past a limit of %d", queued, dropped, rw.limit)
+	}
+	close(col.release)
+	if err := rw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if rw.written+rw.dropped != 30 || rw.dropped == 0 {
+		t.Errorf("%d results written and %d dropped, want 30 in all with some dropped", rw.written, rw.dropped)
+	}
+	if !col.deadline {
+		t.Error("batch inserted without a deadline")
+	}
+
+	// An insert that outlives its timeout fails the writer
+	col = &blockingCollection{release: make(chan struct{})}
+	rw = newResultsWriter(col, "run2")
+	rw.timeout = 10 * time.Millisecond
+	rw.WriteResult(CheckResult{Namespace: "db.col", ID: 1, Status: StatusMatch})
+	if err := rw.Close(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close after a stuck insert returned %v, want a deadline error", err)
+	}
+}
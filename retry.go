@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// backoff computes retry delays with full jitter: each delay is drawn
+// uniformly from [0, min(max, base*2^attempt)], so workers retrying the same
+// throttled cluster spread out instead of retrying in lockstep.
+type backoff struct {
+	base, max time.Duration
+	randN     func(n int64) int64 // returns a value in [0, n)
+}
+
+func newBackoff(base, max time.Duration) backoff {
+	return backoff{base: base, max: max, randN: rand.Int64N}
+}
+
+// delay returns the wait before retry number attempt (0-based)
+func (b backoff) delay(attempt int) time.Duration {
+	ceiling := b.max
+	if attempt < 62 && b.base<<attempt > 0 && b.base<<attempt < b.max {
+		ceiling = b.base << attempt
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(b.randN(int64(ceiling) + 1))
+}
+
+// retryingSource retries lookups that fail with a network or timeout error.
+// The driver does not surface a server-recommended retry delay, so every
+// wait comes from the jittered backoff.
+type retryingSource struct {
+	docSource
+	retries int
+	backoff backoff
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryingSource(src docSource, retries int, b backoff) retryingSource {
+	return retryingSource{docSource: src, retries: retries, backoff: b, sleep: sleepCtx}
+}
+
+func (r retryingSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	var doc bson.Raw
+	err := r.do(ctx, func() (err error) {
+		doc, err = r.docSource.FindOne(ctx, db, col, filter)
+		return err
+	})
+	return doc, err
+}
+
+func (r retryingSource) CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error) {
+	var n int64
+	err := r.do(ctx, func() (err error) {
+		n, err = r.docSource.CountDocuments(ctx, db, col, filter, limit)
+		return err
+	})
+	return n, err
+}
+
+// do runs op, retrying transient failures up to r.retries times
+func (r retryingSource) do(ctx context.Context, op func() error) error {
+	err := op()
+	for attempt := 0; attempt < r.retries && retryable(err); attempt++ {
+		if serr := r.sleep(ctx, r.backoff.delay(attempt)); serr != nil {
+			return err
+		}
+		err = op()
+	}
+	return err
+}
+
+// retryable reports whether err is worth retrying
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch classifyError(err) {
+	case ErrClassNetwork, ErrClassTimeout:
+		return true
+	}
+	return false
+}
+
+// sleepCtx waits for d or until ctx is done
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
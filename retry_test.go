@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBackoffJitterBounds(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, time.Second)
+	ceilings := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for attempt, ceiling := range ceilings {
+		distinct := make(map[time.Duration]bool)
+		for i := 0; i < 200; i++ {
+			d := b.delay(attempt)
+			if d < 0 || d > ceiling {
+				t.Fatalf("delay(%d) = %v, want within [0, %v]", attempt, d, ceiling)
+			}
+			distinct[d] = true
+		}
+		if len(distinct) < 10 {
+			t.Errorf("delay(%d) is not jittered: %d distinct values", attempt, len(distinct))
+		}
+	}
+	// Huge attempt numbers must not overflow past the cap
+	if d := b.delay(100); d < 0 || d > time.Second {
+		t.Errorf("delay(100) = %v, want within [0, 1s]", d)
+	}
+}
+
+// flakySource fails the first failures lookups with err
+type flakySource struct {
+	docSource
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakySource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return f.docSource.FindOne(ctx, db, col, filter)
+}
+
+func TestRetryingSource(t *testing.T) {
+	var slept []time.Duration
+	sleep := func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	b := backoff{base: 10 * time.Millisecond, max: time.Second, randN: rand.New(rand.NewPCG(1, 2)).Int64N}
+
+	flaky := &flakySource{docSource: newFakeSource(), failures: 2, err: mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}}
+	r := retryingSource{docSource: flaky, retries: 3, backoff: b, sleep: sleep}
+	if _, err := r.FindOne(context.Background(), "db", "col", bson.M{"_id": 1}); err != mongo.ErrNoDocuments {
+		t.Errorf("FindOne after transient failures = %v, want ErrNoDocuments", err)
+	}
+	if flaky.calls != 3 || len(slept) != 2 {
+		t.Errorf("calls = %d, sleeps = %d; want 3, 2", flaky.calls, len(slept))
+	}
+
+	// Non-transient errors are returned at once
+	flaky = &flakySource{docSource: newFakeSource(), failures: 5, err: mongo.CommandError{Code: codeUnauthorized}}
+	r.docSource = flaky
+	if _, err := r.FindOne(context.Background(), "db", "col", bson.M{"_id": 1}); err == nil || flaky.calls != 1 {
+		t.Errorf("auth error: err = %v after %d calls, want an error after 1", err, flaky.calls)
+	}
+}
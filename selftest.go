@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultSelfTestDB prefixes the throwaway databases of -selftest. The
+// source side uses <prefix>_src and the dest side <prefix>_dest, so both
+// may live on one cluster.
+const defaultSelfTestDB = "error_checker_selftest"
+
+// selfTestNamespace is the namespace named in the synthetic log
+const selfTestNamespace = "selftest.docs"
+
+// selfTestExpected is what the check of the synthetic log must report
+var selfTestExpected = Stats{
+	TotalChecks:     5,
+	Matches:         2, // identical, and missing from both
+	Mismatches:      1,
+	MissingInSource: 1,
+	MissingInDest:   1,
+	Duplicates:      1,
+	ParseFailures:   1,
+}
+
+// selfTestSide is one side of a self-test: where its documents are looked up,
+// and how they are seeded and cleaned up
+type selfTestSide struct {
+	source docSource
+	db     string
+	insert func(ctx context.Context, db, col string, docs []interface{}) error
+	drop   func(ctx context.Context, db string) error
+	empty  func(ctx context.Context, db string) (bool, error)
+}
+
+// runSelfTest seeds known-divergent documents on both sides, checks a
+// synthetic log of them through the whole read, extract, check and report
+// flow, and fails unless the expected statistics come out. Without -source
+// and -dest the documents are held in memory; otherwise they are written to
+// throwaway databases, which must be empty and are dropped afterwards.
+func runSelfTest(cfg Config, stdout io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	logger := runLogger(cfg)
+	prefix := cfg.SelfTestDB
+	var src, dest selfTestSide
+	switch {
+	case cfg.Source == "" && cfg.Dest == "":
+		mem := newMemSource()
+		src, dest = mem.side(prefix+"_src"), mem.side(prefix+"_dest")
+	case cfg.Source != "" && cfg.Dest != "":
+		if err := validateURIs(cfg); err != nil {
+			return err
+		}
+		srcClient, err := connectMongo(ctx, cfg.Source, cfg.Compat, cfg.SRVTimeout)
+		if err != nil {
+			return connectError("source", err)
+		}
+		defer srcClient.Disconnect(context.Background())
+		destClient, err := connectMongo(ctx, cfg.Dest, cfg.Compat, cfg.SRVTimeout)
+		if err != nil {
+			return connectError("destination", err)
+		}
+		defer destClient.Disconnect(context.Background())
+		src, dest = mongoSide(srcClient, prefix+"_src"), mongoSide(destClient, prefix+"_dest")
+	default:
+		fmt.Fprintln(stdout, "Usage: error_checker -selftest [-source <uri> -dest <uri>]")
+		return errUsage
+	}
+
+	for _, side := range []selfTestSide{src, dest} {
+		empty, err := side.empty(ctx, side.db)
+		if err != nil {
+			return fmt.Errorf("self-test: %w", err)
+		}
+		if !empty {
+			return fmt.Errorf("self-test database %s is not empty; pass -selftest-db with an unused name", side.db)
+		}
+	}
+	defer func() {
+		for _, side := range []selfTestSide{src, dest} {
+			if err := side.drop(context.Background(), side.db); err != nil {
+				logger.Printf("Failed to drop self-test database %s: %v", side.db, err)
+			}
+		}
+	}()
+
+	logData, err := seedSelfTest(ctx, src, dest)
+	if err != nil {
+		return fmt.Errorf("self-test: failed to seed documents: %w", err)
+	}
+
+	// The ids extracted from the log are the ones it logged
+	extractor := NewChecker(nil, nil)
+	extractor.Logger = log.New(io.Discard, "", 0)
+	var extracted bytes.Buffer
+	if err := extractor.Extract(strings.NewReader(logData), &extracted); err != nil {
+		return fmt.Errorf("self-test: extract: %w", err)
+	}
+	var failures []string
+	if n := strings.Count(extracted.String(), "\n"); n != selfTestExpected.TotalChecks+selfTestExpected.Duplicates {
+		failures = append(failures, fmt.Sprintf("extract listed %d ids, want %d", n, selfTestExpected.TotalChecks+selfTestExpected.Duplicates))
+	}
+
+	checker := NewChecker(renamedSource{src.source, src.db}, renamedSource{dest.source, dest.db})
+	checker.Logger = logger
+	// The log repeats an id, which dedup must count as a duplicate
+	checker.DedupCacheSize = 100
+	if err := checker.Run(ctx, strings.NewReader(logData)); err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+	printReport(stdout, checker)
+
+	failures = append(failures, verifySelfTest(checker.StatsMap)...)
+	if len(failures) > 0 {
+		return fmt.Errorf("self-test failed: %s", strings.Join(failures, "; "))
+	}
+	fmt.Fprintln(stdout, "\nSelf-test passed")
+	return nil
+}
+
+// seedSelfTest inserts the self-test documents and returns the log that
+// reports them: one id per outcome, a repeated line, an unparsable id and an
+// unrelated line
+func seedSelfTest(ctx context.Context, src, dest selfTestSide) (string, error) {
+	_, col, _ := splitNamespace(selfTestNamespace)
+	same, changed, onlySrc, onlyDest, neither := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	srcDocs := []interface{}{
+		bson.D{{Key: "_id", Value: same}, {Key: "name", Value: "same"}, {Key: "n", Value: 1}},
+		bson.D{{Key: "_id", Value: changed}, {Key: "name", Value: "changed"}, {Key: "n", Value: 1}},
+		bson.D{{Key: "_id", Value: onlySrc}, {Key: "name", Value: "source only"}},
+	}
+	destDocs := []interface{}{
+		bson.D{{Key: "_id", Value: same}, {Key: "name", Value: "same"}, {Key: "n", Value: 1}},
+		bson.D{{Key: "_id", Value: changed}, {Key: "name", Value: "changed"}, {Key: "n", Value: 2}},
+		bson.D{{Key: "_id", Value: onlyDest}, {Key: "name", Value: "dest only"}},
+	}
+	if err := src.insert(ctx, src.db, col, srcDocs); err != nil {
+		return "", fmt.Errorf("source: %w", err)
+	}
+	if err := dest.insert(ctx, dest.db, col, destDocs); err != nil {
+		return "", fmt.Errorf("destination: %w", err)
+	}
+
+	line := func(id string) string {
+		return fmt.Sprintf(`%s,selftest,docs,"ERR Isolated retry still failed retryErr=""E11000 duplicate key error collection: %s index: _id_"" id=""{\""$oid\"":\""%s\""}"" key=1"`,
+			time.Now().UTC().Format(time.RFC3339Nano), selfTestNamespace, id)
+	}
+	lines := []string{
+		"Date,Pod Name,@processKey,Message",
+		line(same.Hex()),
+		line(changed.Hex()),
+		line(onlySrc.Hex()),
+		line(onlyDest.Hex()),
+		line(neither.Hex()),
+		line(same.Hex()),   // repeated
+		line("not-an-oid"), // unparsable
+		`2025-10-15T17:32:48.521Z,selftest,docs,"INF batch written"`,
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// verifySelfTest compares the statistics of the self-test namespace with
+// selfTestExpected
+func verifySelfTest(statsMap map[string]*Stats) []string {
+	got, ok := statsMap[selfTestNamespace]
+	if !ok || len(statsMap) != 1 {
+		return []string{fmt.Sprintf("expected statistics for %s only, got %d namespaces", selfTestNamespace, len(statsMap))}
+	}
+	want := selfTestExpected
+	var failures []string
+	for _, f := range []struct {
+		name      string
+		got, want int
+	}{
+		{"total checks", got.TotalChecks, want.TotalChecks},
+		{"matches", got.Matches, want.Matches},
+		{"mismatches", got.Mismatches, want.Mismatches},
+		{"missing in source", got.MissingInSource, want.MissingInSource},
+		{"missing in dest", got.MissingInDest, want.MissingInDest},
+		{"errors", got.Errors, want.Errors},
+		{"duplicates", got.Duplicates, want.Duplicates},
+		{"unparsable ids", got.ParseFailures, want.ParseFailures},
+	} {
+		if f.got != f.want {
+			failures = append(failures, fmt.Sprintf("%s = %d, want %d", f.name, f.got, f.want))
+		}
+	}
+	return failures
+}
+
+// renamedSource looks documents up in database db whatever database is
+// asked for, so that both sides of a self-test can share a cluster
+type renamedSource struct {
+	docSource
+	db string
+}
+
+func (r renamedSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	return r.docSource.FindOne(ctx, r.db, col, filter)
+}
+
+func (r renamedSource) CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error) {
+	return r.docSource.CountDocuments(ctx, r.db, col, filter, limit)
+}
+
+// mongoSide is a self-test side in database db of a live cluster
+func mongoSide(client *mongo.Client, db string) selfTestSide {
+	return selfTestSide{
+		source: mongoSource{client: client},
+		db:     db,
+		insert: func(ctx context.Context, db, col string, docs []interface{}) error {
+			_, err := client.Database(db).Collection(col).InsertMany(ctx, docs)
+			return err
+		},
+		drop: func(ctx context.Context, db string) error {
+			return client.Database(db).Drop(ctx)
+		},
+		empty: func(ctx context.Context, db string) (bool, error) {
+			names, err := client.Database(db).ListCollectionNames(ctx, bson.D{})
+			return len(names) == 0, err
+		},
+	}
+}
+
+// memSource is an in-memory docSource matching filters of top-level
+// equality conditions
+type memSource struct {
+	mu   sync.Mutex
+	docs map[string][]bson.Raw // by namespace
+}
+
+func newMemSource() *memSource {
+	return &memSource{docs: make(map[string][]bson.Raw)}
+}
+
+// side is a self-test side in database db of the memory source
+func (m *memSource) side(db string) selfTestSide {
+	return selfTestSide{
+		source: m,
+		db:     db,
+		insert: func(ctx context.Context, db, col string, docs []interface{}) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for _, d := range docs {
+				raw, err := bson.Marshal(d)
+				if err != nil {
+					return err
+				}
+				m.docs[db+"."+col] = append(m.docs[db+"."+col], raw)
+			}
+			return nil
+		},
+		drop: func(ctx context.Context, db string) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for ns := range m.docs {
+				if strings.HasPrefix(ns, db+".") {
+					delete(m.docs, ns)
+				}
+			}
+			return nil
+		},
+		empty: func(ctx context.Context, db string) (bool, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for ns := range m.docs {
+				if strings.HasPrefix(ns, db+".") {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+	}
+}
+
+// find returns the documents of a namespace matching filter
+func (m *memSource) find(db, col string, filter interface{}) ([]bson.Raw, error) {
+	conds, ok := filter.(bson.M)
+	if !ok {
+		return nil, fmt.Errorf("unsupported filter %T", filter)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []bson.Raw
+	for _, doc := range m.docs[db+"."+col] {
+		if memMatches(doc, conds) {
+			found = append(found, doc)
+		}
+	}
+	return found, nil
+}
+
+// memMatches reports whether doc has every field of filter with an equal value
+func memMatches(doc bson.Raw, filter bson.M) bool {
+	for key, want := range filter {
+		got, err := doc.LookupErr(strings.Split(key, ".")...)
+		if err != nil {
+			return false
+		}
+		wrapped, err := bson.Marshal(bson.D{{Key: "v", Value: want}})
+		if err != nil || !got.Equal(bson.Raw(wrapped).Lookup("v")) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *memSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	found, err := m.find(db, col, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return found[0], nil
+}
+
+func (m *memSource) CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error) {
+	found, err := m.find(db, col, filter)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(len(found))
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	return n, nil
+}
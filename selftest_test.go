@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSelfTestInMemory(t *testing.T) {
+	var out strings.Builder
+	if err := run([]string{"-selftest", "-quiet"}, &out); err != nil {
+		t.Fatalf("run -selftest: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "=== Analysis Report ===") || !strings.HasSuffix(out.String(), "Self-test passed\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	if err := run([]string{"-selftest", "-source", "mongodb://127.0.0.1:1"}, &out); !errors.Is(err, errUsage) {
+		t.Errorf("-selftest with only -source: %v, want errUsage", err)
+	}
+}
+
+func TestVerifySelfTest(t *testing.T) {
+	want := selfTestExpected
+	if failures := verifySelfTest(map[string]*Stats{selfTestNamespace: &want}); len(failures) != 0 {
+		t.Errorf("expected stats failed: %v", failures)
+	}
+
+	got := selfTestExpected
+	got.Mismatches, got.Matches = 0, 3
+	failures := verifySelfTest(map[string]*Stats{selfTestNamespace: &got})
+	if len(failures) != 2 || failures[0] != "matches = 3, want 2" || failures[1] != "mismatches = 0, want 1" {
+		t.Errorf("failures = %v", failures)
+	}
+	if failures := verifySelfTest(map[string]*Stats{}); len(failures) != 1 {
+		t.Errorf("missing namespace: failures = %v", failures)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errSignOff reports that a namespace fell short of its match-rate
+// threshold; the process exits with status 2
+var errSignOff = errors.New("match rate below threshold")
+
+// parseMatchRate parses a match rate in percent, such as 99.99 or 99.99%
+func parseMatchRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || rate < 0 || rate > 100 {
+		return 0, fmt.Errorf("%q is not a percentage between 0 and 100", s)
+	}
+	return rate, nil
+}
+
+// parseNSMatchRate parses an -ns-min-match-rate value, <db.collection>=<rate>
+func parseNSMatchRate(s string) (string, float64, error) {
+	namespace, rate, ok := strings.Cut(s, "=")
+	if !ok || !validNamespace(namespace) {
+		return "", 0, fmt.Errorf("%q is not of the form <db.collection>=<rate>", s)
+	}
+	r, err := parseMatchRate(rate)
+	return namespace, r, err
+}
+
+// scopedChecks is the number of checks of a namespace, those of documents
+// out of scope under -direction source, -modified-since or -capped aside
+func (s *Stats) scopedChecks() int {
+	return s.TotalChecks - s.NotInSource - s.SkippedOld - s.OutsideCapWindow
+}
+
+// MatchRate is the percentage of the scoped checks of a namespace that
+// matched. Errors count against it: they verified nothing.
+func (s *Stats) MatchRate() float64 {
+	checks := s.scopedChecks()
+	if checks == 0 {
+		return 0
+	}
+	return 100 * float64(s.Matches) / float64(checks)
+}
+
+// signOff is the verdict on a namespace with a match-rate threshold
+type signOff struct {
+	Namespace    string  `json:"namespace"`
+	Checks       int     `json:"checks"`
+	MatchRate    float64 `json:"matchRate"`
+	MinMatchRate float64 `json:"minMatchRate"`
+	Pass         bool    `json:"pass"`
+}
+
+// SignOff returns the verdict on every namespace with a threshold, sorted:
+// those of the log under MinMatchRate, and those of NSMinMatchRate. A
+// namespace with no check, absent from the log included, fails.
+func (c *Checker) SignOff() []signOff {
+	thresholds := make(map[string]float64)
+	if c.MinMatchRate > 0 {
+		for ns := range c.StatsMap {
+			thresholds[ns] = c.MinMatchRate
+		}
+	}
+	for ns, rate := range c.NSMinMatchRate {
+		thresholds[ns] = rate
+	}
+
+	var list []signOff
+	for ns, min := range thresholds {
+		v := signOff{Namespace: ns, MinMatchRate: min}
+		if s := c.StatsMap[ns]; s != nil {
+			v.Checks = s.scopedChecks()
+			v.MatchRate = s.MatchRate()
+		}
+		// The tolerance absorbs the rounding of rates such as 9999/10000
+		v.Pass = v.Checks > 0 && v.MatchRate >= min-1e-9
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Namespace < list[j].Namespace })
+	return list
+}
+
+// signOffError returns errSignOff, naming the namespaces that failed, or
+// nil if all passed
+func signOffError(list []signOff) error {
+	var failed []string
+	for _, v := range list {
+		if !v.Pass {
+			failed = append(failed, v.Namespace)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errSignOff, strings.Join(failed, ", "))
+}
+
+func printSignOff(w io.Writer, list []signOff) {
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Match-Rate Sign-Off ===")
+	for _, v := range list {
+		verdict := "PASS"
+		if !v.Pass {
+			verdict = "FAIL"
+		}
+		if v.Checks == 0 {
+			fmt.Fprintf(w, "%s: no checks (min %g%%) %s\n", v.Namespace, v.MinMatchRate, verdict)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %.4f%% of %d checks matched (min %g%%) %s\n", v.Namespace, v.MatchRate, v.Checks, v.MinMatchRate, verdict)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignOff(t *testing.T) {
+	c := NewChecker(nil, nil)
+	// Just above, at and just below 99.99%
+	c.StatsMap["db.above"] = &Stats{TotalChecks: 100000, Matches: 99991}
+	c.StatsMap["db.at"] = &Stats{TotalChecks: 10000, Matches: 9999}
+	c.StatsMap["db.below"] = &Stats{TotalChecks: 10000, Matches: 9998}
+	c.StatsMap["db.strict"] = &Stats{TotalChecks: 10000, Matches: 9999}
+	c.MinMatchRate = 99.99
+	c.NSMinMatchRate = map[string]float64{"db.strict": 100, "db.absent": 50}
+
+	want := map[string]bool{"db.above": true, "db.at": true, "db.below": false, "db.strict": false, "db.absent": false}
+	list := c.SignOff()
+	if len(list) != len(want) {
+		t.Fatalf("sign-off %+v, want %d namespaces", list, len(want))
+	}
+	for _, v := range list {
+		if v.Pass != want[v.Namespace] {
+			t.Errorf("%s: %.4f%% of %d checks against %g%%: pass %v, want %v", v.Namespace, v.MatchRate, v.Checks, v.MinMatchRate, v.Pass, want[v.Namespace])
+		}
+	}
+
+	err := signOffError(list)
+	if !errors.Is(err, errSignOff) || !strings.Contains(err.Error(), "db.absent, db.below, db.strict") {
+		t.Errorf("signOffError = %v, want the failed namespaces", err)
+	}
+	var out strings.Builder
+	printReport(&out, c)
+	for _, line := range []string{"db.at: 99.9900% of 10000 checks matched (min 99.99%) PASS", "db.below: 99.9800% of 10000 checks matched (min 99.99%) FAIL", "db.absent: no checks (min 50%) FAIL"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("report lacks %q:\n%s", line, out.String())
+		}
+	}
+
+	// Without thresholds there is nothing to sign off
+	c.MinMatchRate, c.NSMinMatchRate = 0, nil
+	if list := c.SignOff(); len(list) != 0 || signOffError(list) != nil {
+		t.Errorf("sign-off without thresholds: %+v", list)
+	}
+}
+
+func TestParseMatchRate(t *testing.T) {
+	for s, want := range map[string]float64{"99.99": 99.99, "99.99%": 99.99, " 100 ": 100, "0": 0} {
+		if got, err := parseMatchRate(s); err != nil || got != want {
+			t.Errorf("parseMatchRate(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "abc", "101", "-1"} {
+		if _, err := parseMatchRate(s); err == nil {
+			t.Errorf("parseMatchRate(%q) succeeded", s)
+		}
+	}
+	if _, _, err := parseNSMatchRate("nodot=99"); err == nil {
+		t.Error("parseNSMatchRate accepted a namespace without a dot")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// Reason codes of skipped lines. They are stable: tooling reading the
+// -skip-log or the report relies on them.
+const (
+	SkipCSVError          = "SKIP_CSV_ERROR"          // the CSV reader rejected the row
+	SkipOversized         = "SKIP_OVERSIZED"          // longer than -max-line-bytes
+	SkipHeader            = "SKIP_HEADER"             // a header row repeated mid-file
+	SkipNoColumn          = "SKIP_NO_COLUMN"          // the message column, or a -search-columns one, is missing
+	SkipFiltered          = "SKIP_FILTERED"           // the message does not match the filter
+	SkipNoNamespace       = "SKIP_NO_NS"              // no valid namespace found
+	SkipUnresolvedNS      = "SKIP_UNRESOLVED_NS"      // a collection logged without its database
+	SkipNoID              = "SKIP_NO_ID"              // no id in the message
+	SkipIDParse           = "SKIP_ID_PARSE"           // an id was found but could not be parsed
+	SkipDuplicate         = "SKIP_DUPLICATE"          // the id was already checked in the run
+	SkipPreviouslyMatched = "SKIP_PREVIOUSLY_MATCHED" // matched in an earlier run (-state-file)
+	SkipCapped            = "SKIP_CAPPED"             // the id of a -capped collection, reconciled by its id diff
+)
+
+// skipLog writes the line number and reason code of every skipped line to
+// the -skip-log file, as CSV
+type skipLog struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newSkipLog(path string) (*skipLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	sl := &skipLog{f: f, w: bufio.NewWriter(f)}
+	sl.w.WriteString("line,reason\n")
+	return sl, nil
+}
+
+func (sl *skipLog) write(lineNum int, reason string) {
+	sl.w.WriteString(strconv.Itoa(lineNum))
+	sl.w.WriteByte(',')
+	sl.w.WriteString(reason)
+	sl.w.WriteByte('\n')
+}
+
+// Close flushes the log and closes its file
+func (sl *skipLog) Close() error {
+	err := sl.w.Flush()
+	if cerr := sl.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// skip records that line lineNum was skipped for reason
+func (c *Checker) skip(lineNum int, reason string) {
+	if c.SkippedLines == nil {
+		c.SkippedLines = make(map[string]int)
+	}
+	c.SkippedLines[reason]++
+	if c.SkipLog != nil {
+		c.SkipLog.write(lineNum, reason)
+	}
+}
+
+func printSkippedLines(w io.Writer, skipped map[string]int) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n=== Skipped Lines by Reason ===")
+	for _, reason := range slices.Sorted(maps.Keys(skipped)) {
+		fmt.Fprintf(w, "%s: %d\n", reason, skipped[reason])
+	}
+}
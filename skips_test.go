@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSkipReasons(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: id}})
+	checked := logLine("db.col", id)
+
+	lines := []struct {
+		line, reason string
+	}{
+		{checked, ""},
+		{"2025-10-15T17:32:48.521Z,dsync,col,batch applied", SkipFiltered},
+		{"2025-10-15T17:32:48.521Z,dsync", SkipCSVError}, // the lines after it keep their number
+		{strings.Replace(checked, "collection: db.col", "index", 1), SkipNoNamespace},
+		{strings.Replace(checked, "collection: db.col", "collection: col", 1), SkipUnresolvedNS},
+		{strings.Replace(checked, id.Hex(), "zz", 1), SkipIDParse},
+		{`2025-10-15T17:32:48.521Z,dsync,col,"ERR Isolated retry still failed retryErr=""E11000 duplicate key error collection: db.col index: _id_"""`, SkipNoID},
+		{checked, SkipDuplicate},
+		{"Date,Pod Name,@processKey,Message", SkipHeader},
+		{"2025-10-15T17:32:48.521Z,dsync", SkipCSVError},
+	}
+	var input []string
+	var want []string
+	for i, l := range lines {
+		input = append(input, l.line)
+		if l.reason != "" {
+			want = append(want, strconv.Itoa(i+2)+","+l.reason)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "skips.csv")
+	sl, err := newSkipLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewChecker(src, dest)
+	c.DedupCacheSize = 10
+	c.SkipLog = sl
+	if err := c.Run(context.Background(), strings.NewReader(logFile(input...))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := sl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "line,reason\n"+strings.Join(want, "\n")+"\n" {
+		t.Errorf("skip log:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+	if len(c.SkippedLines) != len(lines)-2 || c.SkippedLines[SkipFiltered] != 1 || c.SkippedLines[SkipCSVError] != 2 {
+		t.Errorf("skipped lines %v, want one of each reason and two CSV errors", c.SkippedLines)
+	}
+	// Recent Errors agrees with the skip log on the line of a CSV error
+	if errs := c.recentErrors.Errors(); len(errs) == 0 || errs[0].Line != 4 {
+		t.Errorf("recent errors %+v, want the CSV error of line 4 first", errs)
+	}
+
+	var out strings.Builder
+	printReport(&out, c)
+	if !strings.Contains(out.String(), "=== Skipped Lines by Reason ===\nSKIP_CSV_ERROR: 2\nSKIP_DUPLICATE: 1\n") {
+		t.Errorf("report does not list the skipped lines:\n%s", out.String())
+	}
+
+	// A -search-columns column the row lacks
+	c = NewChecker(src, dest)
+	c.SearchColumns = []int{3, 4}
+	if err := c.Run(context.Background(), strings.NewReader(logFile(checked))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if c.SkippedLines[SkipNoColumn] != 1 {
+		t.Errorf("skipped lines %v, want %s", c.SkippedLines, SkipNoColumn)
+	}
+}
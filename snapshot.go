@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// snapshotMinWireVersion is the wire version of MongoDB 5.0, the first to
+// serve snapshot reads outside transactions
+const snapshotMinWireVersion = 13
+
+// clusterTimeRegex matches a cluster time written as <t>,<i>, <t>:<i> or
+// Timestamp(<t>, <i>)
+var clusterTimeRegex = regexp.MustCompile(`^(?:Timestamp\(\s*)?(\d+)\s*[,:]\s*(\d+)\s*\)?$`)
+
+// parseClusterTime parses an -at-cluster-time value: a timestamp as
+// <seconds>,<increment>, Timestamp(<seconds>, <increment>) or Extended JSON
+// {"$timestamp":{...}}, or an RFC 3339 time, taken as its first increment
+func parseClusterTime(s string) (primitive.Timestamp, error) {
+	if m := clusterTimeRegex.FindStringSubmatch(s); m != nil {
+		t, terr := strconv.ParseUint(m[1], 10, 32)
+		i, ierr := strconv.ParseUint(m[2], 10, 32)
+		if terr == nil && ierr == nil {
+			return primitive.Timestamp{T: uint32(t), I: uint32(i)}, nil
+		}
+	}
+	if v, err := parseID(s); err == nil {
+		if ts, ok := v.(primitive.Timestamp); ok {
+			return ts, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil && t.Unix() > 0 && t.Unix() <= 1<<32-1 {
+		return primitive.Timestamp{T: uint32(t.Unix()), I: 1}, nil
+	}
+	return primitive.Timestamp{}, fmt.Errorf("%q is not a cluster time (<seconds>,<increment>, Timestamp(...), {\"$timestamp\":...} or an RFC 3339 time)", s)
+}
+
+// snapshotSupport reports why the server that sent the hello response
+// cannot serve snapshot reads, or nil if it can: they need MongoDB 5.0 and
+// a replica set or sharded cluster.
+func snapshotSupport(hello bson.Raw) error {
+	wire, _ := hello.Lookup("maxWireVersion").AsInt64OK()
+	if wire < snapshotMinWireVersion {
+		return fmt.Errorf("snapshot reads require MongoDB 5.0 or later (server wire version %d)", wire)
+	}
+	_, replSet := hello.Lookup("setName").StringValueOK()
+	msg, _ := hello.Lookup("msg").StringValueOK()
+	if !replSet && msg != "isdbgrid" {
+		return fmt.Errorf("snapshot reads require a replica set or sharded cluster, not a standalone server")
+	}
+	return nil
+}
+
+// checkSnapshotSupport asks the server whether it can serve snapshot reads
+func checkSnapshotSupport(ctx context.Context, client *mongo.Client) error {
+	hello, err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Raw()
+	if err != nil {
+		return fmt.Errorf("hello: %w", err)
+	}
+	return snapshotSupport(hello)
+}
+
+// newSnapshotSource wraps client so that every read goes through a single
+// snapshot session pinned to cluster time at: each find and count carries
+// readConcern {level: "snapshot", atClusterTime: at}. The server only keeps
+// history for minSnapshotHistoryWindowInSeconds (5 minutes by default), so
+// older times fail with SnapshotTooOld.
+func newSnapshotSource(client *mongo.Client, at primitive.Timestamp) (mongoSource, error) {
+	m := mongoSource{client: client}
+	sess, err := client.StartSession(options.Session().SetSnapshot(true))
+	if err != nil {
+		return m, fmt.Errorf("failed to start snapshot session: %w", err)
+	}
+	// The driver would otherwise take the time of the first read; presetting
+	// it pins every read, the first included
+	sess.(mongo.XSession).ClientSession().SnapshotTime = &at
+	m.session = sess
+	return m, nil
+}
+
+// openMongoSource wraps client for reading: pinned to cluster time at when
+// snapshot is set, once the server confirmed it serves snapshot reads, and
+// otherwise as newMongoSource does
+func openMongoSource(ctx context.Context, client *mongo.Client, causal, snapshot bool, at primitive.Timestamp) (mongoSource, error) {
+	if !snapshot {
+		return newMongoSource(client, causal)
+	}
+	if err := checkSnapshotSupport(ctx, client); err != nil {
+		return mongoSource{client: client}, fmt.Errorf("-at-cluster-time: %w", err)
+	}
+	return newSnapshotSource(client, at)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestParseClusterTime(t *testing.T) {
+	want := primitive.Timestamp{T: 1700000000, I: 5}
+	for _, s := range []string{
+		"1700000000,5",
+		"1700000000:5",
+		"Timestamp(1700000000, 5)",
+		`{"$timestamp":{"t":1700000000,"i":5}}`,
+	} {
+		got, err := parseClusterTime(s)
+		if err != nil || got != want {
+			t.Errorf("parseClusterTime(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	got, err := parseClusterTime(time.Unix(1700000000, 0).UTC().Format(time.RFC3339))
+	if err != nil || got != (primitive.Timestamp{T: 1700000000, I: 1}) {
+		t.Errorf("RFC 3339 time: got %v, %v", got, err)
+	}
+	for _, s := range []string{"", "yesterday", "1700000000", "99999999999,1", `{"$oid":"693885e2f227ce8067db8d33"}`} {
+		if _, err := parseClusterTime(s); err == nil {
+			t.Errorf("parseClusterTime(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestSnapshotSupport(t *testing.T) {
+	tests := []struct {
+		name  string
+		hello bson.D
+		ok    bool
+	}{
+		{"replica set 7.0", bson.D{{Key: "maxWireVersion", Value: int32(21)}, {Key: "setName", Value: "rs0"}}, true},
+		{"mongos 5.0", bson.D{{Key: "maxWireVersion", Value: int32(13)}, {Key: "msg", Value: "isdbgrid"}}, true},
+		{"replica set 4.4", bson.D{{Key: "maxWireVersion", Value: int32(9)}, {Key: "setName", Value: "rs0"}}, false},
+		{"standalone", bson.D{{Key: "maxWireVersion", Value: int32(21)}}, false},
+	}
+	for _, tt := range tests {
+		raw, _ := bson.Marshal(tt.hello)
+		if err := snapshotSupport(raw); (err == nil) != tt.ok {
+			t.Errorf("%s: snapshotSupport = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSnapshotSourceReadConcern(t *testing.T) {
+	ctx := context.Background()
+	// mongo.Connect does not contact the server, so an unreachable host is fine here
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100"))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	at := primitive.Timestamp{T: 1700000000, I: 5}
+	m, err := newSnapshotSource(client, at)
+	if err != nil {
+		t.Fatalf("newSnapshotSource: %v", err)
+	}
+	defer m.close(ctx)
+
+	// A snapshot session with a preset time sends readConcern
+	// {level: "snapshot", atClusterTime: at} with every read
+	cs := m.session.(mongo.XSession).ClientSession()
+	if !cs.Snapshot {
+		t.Error("session does not read from a snapshot")
+	}
+	if cs.SnapshotTime == nil || *cs.SnapshotTime != at {
+		t.Errorf("snapshot time = %v, want %v", cs.SnapshotTime, at)
+	}
+	if cs.Consistent {
+		t.Error("snapshot session is also causally consistent")
+	}
+
+	// The support check needs the server; with none it fails rather than
+	// letting the run start
+	if _, err := openMongoSource(ctx, client, false, true, at); err == nil {
+		t.Error("expected openMongoSource to fail against an unreachable server")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StateStore is the sidecar file used by incremental mode. It records the
+// last known status of every checked id so that the next run only has to
+// re-check ids that were not previously confirmed as Match.
+type StateStore struct {
+	path    string
+	Results map[string]string `json:"results"` // idKey -> Status
+}
+
+// LoadState reads the state file at path. A missing file yields an empty store.
+func LoadState(path string) (*StateStore, error) {
+	s := &StateStore{path: path, Results: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if s.Results == nil {
+		s.Results = make(map[string]string)
+	}
+	return s, nil
+}
+
+// PreviouslyMatched reports whether the id was confirmed as Match in a previous run
+func (s *StateStore) PreviouslyMatched(namespace string, id interface{}) bool {
+	return s.Results[idKey(namespace, id)] == StatusMatch
+}
+
+// Record stores the outcome of a check
+func (s *StateStore) Record(res CheckResult) {
+	s.Results[idKey(res.Namespace, res.ID)] = res.Status
+}
+
+// Save writes the store back to its file
+func (s *StateStore) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// idKey builds a stable key for a namespace/id pair using canonical Extended JSON,
+// so ids of different BSON types never collide.
+func idKey(namespace string, id interface{}) string {
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: id}}, true, false)
+	if err != nil {
+		return fmt.Sprintf("%s|%v", namespace, id)
+	}
+	return namespace + "|" + string(data)
+}
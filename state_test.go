@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIncrementalSkipsPreviouslyMatched(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	matched, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: matched}})
+	dest.insert("db.col", bson.D{{Key: "_id", Value: matched}})
+	src.insert("db.col", bson.D{{Key: "_id", Value: missing}})
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	input := logFile(logLine("db.col", matched), logLine("db.col", missing))
+
+	run := func(force bool) *Checker {
+		state, err := LoadState(statePath)
+		if err != nil {
+			t.Fatalf("LoadState: %v", err)
+		}
+		c := NewChecker(src, dest)
+		c.State = state
+		c.ForceRecheck = force
+		if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if err := state.Save(); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		return c
+	}
+
+	first := run(false)
+	if s := first.StatsMap["db.col"]; s.TotalChecks != 2 || s.Skipped != 0 {
+		t.Fatalf("first run: got %+v, want 2 checks and no skips", *s)
+	}
+
+	second := run(false)
+	s := second.StatsMap["db.col"]
+	if s.TotalChecks != 1 || s.Skipped != 1 || s.MissingInDest != 1 {
+		t.Errorf("second run: got %+v, want only the missing id re-checked", *s)
+	}
+
+	forced := run(true)
+	if s := forced.StatsMap["db.col"]; s.TotalChecks != 2 || s.Skipped != 0 {
+		t.Errorf("forced run: got %+v, want every id re-checked", *s)
+	}
+}
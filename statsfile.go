@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statsSnapshot is the document written to -stats-file
+type statsSnapshot struct {
+	UpdatedAt      time.Time         `json:"updatedAt"`
+	RowsRead       int               `json:"rowsRead"`
+	ExpectedChecks int64             `json:"expectedChecks,omitempty"`
+	Done           bool              `json:"done"`
+	Namespaces     map[string]*Stats `json:"namespaces"`
+}
+
+// maybeFlushStats rewrites StatsFile once StatsInterval has passed since the
+// last write. It runs on the checking path, so the snapshot never races with
+// the updates to StatsMap.
+func (c *Checker) maybeFlushStats() {
+	if c.StatsFile == "" || time.Since(c.statsFlushed) < c.StatsInterval {
+		return
+	}
+	if err := c.FlushStats(false); err != nil {
+		c.Logger.Printf("Failed to write stats file: %v", err)
+	}
+}
+
+// FlushStats writes the current statistics to StatsFile. done marks the
+// final snapshot of a run.
+func (c *Checker) FlushStats(done bool) error {
+	c.statsFlushed = time.Now()
+	data, err := json.MarshalIndent(statsSnapshot{
+		UpdatedAt:      c.statsFlushed.UTC(),
+		RowsRead:       c.RowsRead,
+		ExpectedChecks: c.ExpectedChecks,
+		Done:           done,
+		Namespaces:     c.StatsMap,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.StatsFile, data, 0644)
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers see either the old or the new content,
+// never a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
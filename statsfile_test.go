@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stats.json")
+	for _, content := range []string{`{"v":1}`, `{"v":2}`} {
+		if err := writeFileAtomic(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("content = %s, want %s", data, content)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "stats.json"), nil, 0644); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestFlushStats(t *testing.T) {
+	c := NewChecker(newFakeSource(), newFakeSource())
+	c.StatsFile = filepath.Join(t.TempDir(), "stats.json")
+	c.stats("db.col").Matches = 3
+	if err := c.FlushStats(true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(c.StatsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap statsSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatal(err)
+	}
+	if !snap.Done || snap.Namespaces["db.col"].Matches != 3 {
+		t.Errorf("snapshot = %s", data)
+	}
+}
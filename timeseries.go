@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// timeSeriesSpec names the fields of a time-series collection that identify
+// a measurement: its timeField and, optionally, its metaField. The log
+// message of a failed measurement write carries their values as
+// <timeField>="..." and <metaField>="...".
+type timeSeriesSpec struct {
+	TimeField string
+	MetaField string
+}
+
+// parseTimeSeriesSpec parses "<db.collection>=<timeField>[,<metaField>]"
+func parseTimeSeriesSpec(s string) (string, timeSeriesSpec, error) {
+	namespace, fields, ok := strings.Cut(s, "=")
+	if !ok || !validNamespace(namespace) {
+		return "", timeSeriesSpec{}, fmt.Errorf("%q is not of the form <db.collection>=<timeField>[,<metaField>]", s)
+	}
+	timeField, metaField, _ := strings.Cut(fields, ",")
+	spec := timeSeriesSpec{TimeField: strings.TrimSpace(timeField), MetaField: strings.TrimSpace(metaField)}
+	if spec.TimeField == "" {
+		return "", timeSeriesSpec{}, fmt.Errorf("%q has no timeField", s)
+	}
+	return namespace, spec, nil
+}
+
+// measurementKey extracts the time and metadata of the measurement logged
+// in message. The key, a document of the time and meta fields, identifies
+// the measurement in reports and is the filter that looks it up.
+func (spec timeSeriesSpec) measurementKey(message string) (bson.D, error) {
+	raw, ok := extractFieldValue(message, spec.TimeField)
+	if !ok {
+		return nil, fmt.Errorf("time-series field %s not found in message", spec.TimeField)
+	}
+	t, err := parseTimeValue(raw)
+	if err != nil {
+		return nil, fmt.Errorf("time-series field %s: %w", spec.TimeField, err)
+	}
+	key := bson.D{{Key: spec.TimeField, Value: t}}
+	if spec.MetaField == "" {
+		return key, nil
+	}
+	raw, ok = extractFieldValue(message, spec.MetaField)
+	if !ok {
+		return nil, fmt.Errorf("time-series field %s not found in message", spec.MetaField)
+	}
+	// The metadata is Extended JSON; a bare word is taken as a string
+	meta, err := parseID(raw)
+	if err != nil {
+		meta = raw
+	}
+	return append(key, bson.E{Key: spec.MetaField, Value: meta}), nil
+}
+
+// parseTimeValue parses an RFC 3339 timestamp or an Extended JSON date
+func parseTimeValue(s string) (primitive.DateTime, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return primitive.NewDateTimeFromTime(t), nil
+	}
+	v, err := parseID(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither an RFC 3339 time nor an Extended JSON date", s)
+	}
+	dt, ok := v.(primitive.DateTime)
+	if !ok {
+		return 0, fmt.Errorf("%q is not a date", s)
+	}
+	return dt, nil
+}
+
+// shellCallRegex matches the start of a mongo shell constructor call
+var shellCallRegex = regexp.MustCompile(`^(?:new )?[A-Z][A-Za-z]*\(`)
+
+// fieldStart returns the offset of the value of the first name= in message
+// that is not the tail of a longer name, such as retryid= or doc.id= for id.
+// It runs for every log line, so it scans rather than compiling a regex.
+func fieldStart(message, name string) (int, bool) {
+	key := name + "="
+	for from := 0; ; {
+		i := strings.Index(message[from:], key)
+		if i < 0 {
+			return 0, false
+		}
+		i += from
+		if i == 0 || !isNameByte(message[i-1]) {
+			return i + len(key), true
+		}
+		from = i + 1
+	}
+}
+
+// isNameByte reports whether b may be part of a logged field name
+func isNameByte(b byte) bool {
+	return b == '_' || b == '$' || b == '.' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// extractFieldValue returns the value logged as name=value in message. The
+// value may be quoted, and a JSON object value may contain quotes itself.
+// A value the log backslash-escaped is unescaped as by unescapeLogged.
+func extractFieldValue(message, name string) (string, bool) {
+	start, ok := fieldStart(message, name)
+	if !ok {
+		return "", false
+	}
+	rest := message[start:]
+	quoted := false
+	for _, quote := range []string{`\"`, `"`} {
+		if r, ok := strings.CutPrefix(rest, quote); ok {
+			rest, quoted = r, true
+			break
+		}
+	}
+	rest = unescapeLogged(rest)
+	if strings.HasPrefix(rest, "{") {
+		return balancedJSON(rest)
+	}
+	// A shell constructor such as ObjectId("...") runs to its closing paren
+	if loc := shellCallRegex.FindStringIndex(rest); loc != nil {
+		if end := strings.IndexByte(rest[loc[1]:], ')'); end >= 0 {
+			return rest[:loc[1]+end+1], true
+		}
+	}
+	if quoted {
+		end := strings.IndexByte(rest, '"')
+		if end < 0 {
+			return "", false
+		}
+		return rest[:end], true
+	}
+	if end := strings.IndexAny(rest, " \t"); end >= 0 {
+		rest = rest[:end]
+	}
+	return rest, rest != ""
+}
+
+// compareMeasurement looks the measurement identified by key up on both
+// sides and compares the measurement documents
+func (c *Checker) compareMeasurement(ctx context.Context, db, col string, key bson.D) CheckResult {
+	filter := bson.M{}
+	for _, e := range key {
+		filter[e.Key] = e.Value
+	}
+
+	var docs [2]bson.Raw
+	var ids [2]interface{}
+	var missing [2]bool
+	for i, side := range []docSource{c.Src, c.Dest} {
+		name := [2]string{"Source", "Dest"}[i]
+		doc, err := side.FindOne(ctx, db, col, filter)
+		if err == mongo.ErrNoDocuments {
+			missing[i] = true
+			continue
+		}
+		if err != nil {
+			return CheckResult{ID: key, Status: StatusError, Details: fmt.Sprintf("%s error: %v", name, err), ErrClass: classifyError(err)}
+		}
+		// Several measurements may share a time and metadata
+		n, err := side.CountDocuments(ctx, db, col, filter, 2)
+		if err != nil {
+			return CheckResult{ID: key, Status: StatusError, Details: fmt.Sprintf("%s count error: %v", name, err), ErrClass: classifyError(err)}
+		}
+		if n > 1 {
+			return CheckResult{ID: key, Status: StatusMultipleMatches,
+				Details: fmt.Sprintf("measurement is not unique: %s matches %s", strings.ToLower(name), countLabel(n))}
+		}
+		docs[i], ids[i] = doc, doc.Lookup("_id")
+	}
+	return c.compareLookups(db, col, key, docs[0], docs[1], ids[0], ids[1], missing[0], missing[1])
+}
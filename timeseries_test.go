@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMeasurementKey(t *testing.T) {
+	at := primitive.NewDateTimeFromTime(time.Date(2025, 10, 15, 17, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name    string
+		spec    string
+		message string
+		want    bson.D
+	}{
+		{"time and string meta", "m.cpu=ts,host",
+			`ERR Isolated retry still failed ts="2025-10-15T17:00:00Z" host="web1" id="{"$oid":"693885e2f227ce8067db8d33"}"`,
+			bson.D{{Key: "ts", Value: at}, {Key: "host", Value: "web1"}}},
+		{"Extended JSON date and document meta", "m.cpu=ts,meta",
+			`ERR ts="{\"$date\":\"2025-10-15T17:00:00Z\"}" meta="{\"region\":\"eu\",\"n\":1}" key=1`,
+			bson.D{{Key: "ts", Value: at}, {Key: "meta", Value: bson.D{{Key: "region", Value: "eu"}, {Key: "n", Value: int32(1)}}}}},
+		{"quote inside a meta string", "m.cpu=ts,meta",
+			`ERR ts=2025-10-15T17:00:00Z meta={"region":"e\"u"} key=1`,
+			bson.D{{Key: "ts", Value: at}, {Key: "meta", Value: bson.D{{Key: "region", Value: `e"u`}}}}},
+		{"escaped quote inside a meta string", "m.cpu=ts,meta",
+			`ERR ts=\"2025-10-15T17:00:00Z\" meta="{\"region\":\"e\\\"u\"}" key=1`,
+			bson.D{{Key: "ts", Value: at}, {Key: "meta", Value: bson.D{{Key: "region", Value: `e"u`}}}}},
+		{"unquoted values, no meta", "m.cpu=ts",
+			`ERR xts=1 ts=2025-10-15T17:00:00Z key=1`,
+			bson.D{{Key: "ts", Value: at}}},
+	}
+	for _, tt := range tests {
+		_, spec, err := parseTimeSeriesSpec(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := spec.measurementKey(tt.message)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: key = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	_, spec, _ := parseTimeSeriesSpec("m.cpu=ts,host")
+	for _, msg := range []string{`ERR host="web1"`, `ERR ts="yesterday" host="web1"`, `ERR ts="2025-10-15T17:00:00Z"`} {
+		if _, err := spec.measurementKey(msg); err == nil {
+			t.Errorf("measurementKey(%q) succeeded, want an error", msg)
+		}
+	}
+	for _, s := range []string{"m.cpu", "nodot=ts", "m.cpu=,host"} {
+		if _, _, err := parseTimeSeriesSpec(s); err == nil {
+			t.Errorf("parseTimeSeriesSpec(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestTimeSeriesCheck(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	at := time.Date(2025, 10, 15, 17, 0, 0, 0, time.UTC)
+	measurement := func(host string, v int) bson.D {
+		return bson.D{{Key: "_id", Value: host}, {Key: "ts", Value: primitive.NewDateTimeFromTime(at)}, {Key: "host", Value: host}, {Key: "v", Value: v}}
+	}
+	src.insert("m.cpu", measurement("web1", 0))
+	src.insert("m.cpu", measurement("web2", 1))
+	src.insert("m.cpu", measurement("web3", 2))
+	src.insert("m.cpu", measurement("web4", 3))
+	src.insert("m.cpu", measurement("web4", 4)) // same time and metadata
+	dest.insert("m.cpu", measurement("web1", 0))
+	dest.insert("m.cpu", measurement("web2", 5))
+	dest.insert("m.cpu", measurement("web4", 3))
+
+	line := func(host string) string {
+		return fmt.Sprintf(`2025-10-15T17:32:48.521Z,dsync,cpu,"ERR Isolated retry still failed retryErr=""E11000 duplicate key error collection: m.cpu index: _id_"" ts=""2025-10-15T17:00:00Z"" host=""%s"" key=1"`, host)
+	}
+	c := NewChecker(src, dest)
+	c.TimeSeries = map[string]timeSeriesSpec{"m.cpu": {TimeField: "ts", MetaField: "host"}}
+	if err := c.Run(context.Background(), strings.NewReader(logFile(line("web1"), line("web2"), line("web3"), line("web4")))); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	s := c.StatsMap["m.cpu"]
+	if s.Matches != 1 || s.Mismatches != 1 || s.MissingInDest != 1 || s.MultipleMatches != 1 {
+		t.Errorf("got %+v, want 1 match, 1 mismatch, 1 missing in dest and 1 multiple matches", s)
+	}
+	if id, ok := c.DiscrepancyList[0].ID.(bson.D); !ok || len(id) != 2 || id[1].Value != "web2" {
+		t.Errorf("discrepancy id = %v, want the measurement key", c.DiscrepancyList[0].ID)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTracerProvider exports spans over OTLP/HTTP to endpoint, a URL such as
+// http://localhost:4318. Callers must Shutdown the provider to flush spans.
+func newTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("invalid -otel-endpoint %q: %w", endpoint, err)
+	}
+	res := resource.NewSchemaless(
+		semconv.ServiceName("error_checker"),
+		semconv.ServiceVersion(currentBuild().Version),
+	)
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// endCheckSpan annotates a checkDoc span with its outcome and ends it
+func endCheckSpan(span trace.Span, namespace string, res CheckResult) {
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("namespace", namespace),
+			attribute.String("status", res.Status),
+		)
+		if failedStatus(res.Status) {
+			span.SetStatus(codes.Error, res.Details)
+		}
+	}
+	span.End()
+}
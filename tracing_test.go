@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingSpans(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	id := primitive.NewObjectID()
+	src.insert("db.col", bson.D{{Key: "_id", Value: id}})
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	c := NewChecker(src, dest)
+	c.Tracer = tp.Tracer("test")
+	if err := c.Run(context.Background(), strings.NewReader(logFile(logLine("db.col", id)))); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	check, root := spans[0], spans[1]
+	if root.Name() != "run" || check.Name() != "checkDoc" {
+		t.Fatalf("spans = %s, %s; want checkDoc, run", check.Name(), root.Name())
+	}
+	if check.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("checkDoc span is not a child of the run span")
+	}
+	want := map[attribute.Key]string{"namespace": "db.col", "status": StatusMissingInDest}
+	for _, kv := range check.Attributes() {
+		if w, ok := want[kv.Key]; ok && kv.Value.AsString() != w {
+			t.Errorf("attribute %s = %s, want %s", kv.Key, kv.Value.AsString(), w)
+		}
+		delete(want, kv.Key)
+	}
+	if len(want) > 0 {
+		t.Errorf("missing attributes %v", want)
+	}
+}
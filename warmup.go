@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Warm-up sizes: rounds of ping, and user databases whose collections are
+// listed; and the time the whole warm-up of one cluster may take
+const (
+	warmupPings     = 3
+	warmupDatabases = 10
+	warmupTimeout   = 10 * time.Second
+)
+
+// warmupTarget is what the warm-up exercises: a cluster, through the calls
+// that settle server selection and fill the connection pool and, on a
+// sharded cluster, the routing tables of the mongos
+type warmupTarget interface {
+	Ping(ctx context.Context) error
+	ListDatabaseNames(ctx context.Context) ([]string, error)
+	ListCollectionNames(ctx context.Context, db string) ([]string, error)
+}
+
+// clientTarget is the warmupTarget of a connected client
+type clientTarget struct {
+	client *mongo.Client
+}
+
+func (t clientTarget) Ping(ctx context.Context) error {
+	return t.client.Ping(ctx, nil)
+}
+
+func (t clientTarget) ListDatabaseNames(ctx context.Context) ([]string, error) {
+	return t.client.ListDatabaseNames(ctx, bson.D{})
+}
+
+func (t clientTarget) ListCollectionNames(ctx context.Context, db string) ([]string, error) {
+	return t.client.Database(db).ListCollectionNames(ctx, bson.D{})
+}
+
+// warmUp pings the cluster name a few times and lists the collections of its
+// first user databases, so that the first lookups of the run do not pay for
+// server selection and connection setup, nor skew the latencies -workers
+// auto sizes the pool from. Failures are logged to logger, not fatal: the
+// connection was already verified, and the run retries lookups anyway. The
+// warm-up runs under its own warmupTimeout, derived from ctx.
+func warmUp(ctx context.Context, logger *log.Logger, name string, t warmupTarget) {
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+	start := time.Now()
+	for i := 0; i < warmupPings; i++ {
+		if err := t.Ping(ctx); err != nil {
+			logger.Printf("Warm-up of %s: ping: %v", name, err)
+			return
+		}
+	}
+	dbs, err := t.ListDatabaseNames(ctx)
+	if err != nil {
+		logger.Printf("Warm-up of %s: listDatabases: %v", name, err)
+		return
+	}
+	listed := 0
+	for _, db := range dbs {
+		if listed == warmupDatabases {
+			break
+		}
+		switch db {
+		case "admin", "config", "local":
+			continue
+		}
+		if _, err := t.ListCollectionNames(ctx, db); err != nil {
+			logger.Printf("Warm-up of %s: listCollections on %s: %v", name, db, err)
+			return
+		}
+		listed++
+	}
+	logger.Printf("Warm-up of %s: %d pings, collections of %d databases listed in %v", name, warmupPings, listed, time.Since(start).Round(time.Millisecond))
+}
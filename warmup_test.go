@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeTarget records the calls of a warm-up
+type fakeTarget struct {
+	dbs     []string
+	pingErr error
+	calls   []string
+}
+
+func (t *fakeTarget) Ping(ctx context.Context) error {
+	t.calls = append(t.calls, "ping")
+	return t.pingErr
+}
+
+func (t *fakeTarget) ListDatabaseNames(ctx context.Context) ([]string, error) {
+	t.calls = append(t.calls, "listDatabases")
+	return t.dbs, nil
+}
+
+func (t *fakeTarget) ListCollectionNames(ctx context.Context, db string) ([]string, error) {
+	t.calls = append(t.calls, "listCollections "+db)
+	return nil, nil
+}
+
+func TestWarmUp(t *testing.T) {
+	var logged strings.Builder
+	logger := log.New(&logged, "", 0)
+	target := &fakeTarget{dbs: []string{"admin", "app", "config", "local", "sales"}}
+	warmUp(context.Background(), logger, "source", target)
+	want := []string{"ping", "ping", "ping", "listDatabases", "listCollections app", "listCollections sales"}
+	if !reflect.DeepEqual(target.calls, want) {
+		t.Errorf("calls %q, want %q", target.calls, want)
+	}
+	if !strings.HasPrefix(logged.String(), "Warm-up of source: 3 pings, collections of 2 databases listed in ") {
+		t.Errorf("summary not logged to the run's logger: %q", logged.String())
+	}
+
+	// Only the first databases are listed
+	target = &fakeTarget{}
+	for i := 0; i < 2*warmupDatabases; i++ {
+		target.dbs = append(target.dbs, fmt.Sprintf("db%d", i))
+	}
+	warmUp(context.Background(), logger, "dest", target)
+	if n := len(target.calls); n != warmupPings+1+warmupDatabases {
+		t.Errorf("%d calls, want %d", n, warmupPings+1+warmupDatabases)
+	}
+
+	// A failing ping ends the warm-up without failing the run
+	target = &fakeTarget{dbs: []string{"app"}, pingErr: errors.New("no server")}
+	warmUp(context.Background(), logger, "source", target)
+	if !reflect.DeepEqual(target.calls, []string{"ping"}) {
+		t.Errorf("calls %q after a failed ping, want it alone", target.calls)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Auto-tuning defaults
+const (
+	autoStartWorkers  = 2  // pool size an auto-tuned run starts with
+	defaultMaxWorkers = 16 // cap of an auto-tuned pool
+	tuneWindow        = 50 // checks observed per tuning decision
+	tuneMaxErrorRate  = 0.05
+	tuneLatencyGrowth = 1.5 // latency above this multiple of the best seen backs off
+)
+
+// checkJob is one id waiting to be checked by the pool
+type checkJob struct {
+	seq       int // order of submission
+	lineNum   int
+	namespace string
+	db, col   string
+	id        interface{}
+}
+
+// checkDone is the result of a checkJob
+type checkDone struct {
+	job     checkJob
+	res     CheckResult
+	latency time.Duration
+}
+
+// workerPool checks ids concurrently. Only the lookups run in the workers:
+// results come back to the goroutine reading the log, which records them,
+// so the Checker's statistics are never shared between goroutines.
+type workerPool struct {
+	jobs    chan checkJob
+	results chan checkDone
+	quit    chan struct{} // each value received stops one worker
+	running int           // workers started and not told to quit
+	pending int           // jobs submitted whose result was not received
+	tuner   *tuner        // nil for a fixed size pool
+
+	// With Checker.Deterministic, results are recorded in the order their
+	// jobs were submitted: those arriving ahead of an earlier one are held
+	submitted int
+	recorded  int
+	held      map[int]checkDone
+}
+
+// startPool starts the workers of a run when more than one is configured
+func (c *Checker) startPool(ctx context.Context) {
+	if c.Workers <= 1 && !c.AutoWorkers {
+		return
+	}
+	size, limit := c.Workers, c.Workers
+	if c.AutoWorkers {
+		limit = c.MaxWorkers
+		if limit < 1 {
+			limit = defaultMaxWorkers
+		}
+		size = min(autoStartWorkers, limit)
+	}
+	p := &workerPool{
+		jobs:    make(chan checkJob),
+		results: make(chan checkDone, limit),
+		quit:    make(chan struct{}, limit),
+	}
+	if c.AutoWorkers {
+		p.tuner = newTuner(size, limit)
+		c.Logger.Printf("Auto-tuning workers: starting with %d, at most %d", size, limit)
+	}
+	if c.Deterministic {
+		p.held = make(map[int]checkDone)
+	}
+	c.pool = p
+	p.resize(ctx, c, size)
+}
+
+// resize starts or stops workers until n are running
+func (p *workerPool) resize(ctx context.Context, c *Checker, n int) {
+	for ; p.running < n; p.running++ {
+		go p.work(ctx, c)
+	}
+	for ; p.running > n; p.running-- {
+		p.quit <- struct{}{}
+	}
+}
+
+func (p *workerPool) work(ctx context.Context, c *Checker) {
+	pacer := c.newPacer()
+	for {
+		select {
+		case <-p.quit:
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			pacer.wait(ctx)
+			start := time.Now()
+			res := c.checkDocSafe(ctx, job.lineNum, job.db, job.col, job.id)
+			p.results <- checkDone{job: job, res: res, latency: time.Since(start)}
+		}
+	}
+}
+
+// submit hands a job to the pool, recording the results that come back
+// while it waits for a free worker
+func (c *Checker) submit(ctx context.Context, job checkJob) {
+	p := c.pool
+	job.seq = p.submitted
+	p.submitted++
+	for {
+		select {
+		case p.jobs <- job:
+			p.pending++
+			return
+		case done := <-p.results:
+			c.receive(ctx, done)
+		}
+	}
+}
+
+// receive records a result from the pool and lets the tuner resize it
+func (c *Checker) receive(ctx context.Context, done checkDone) {
+	p := c.pool
+	p.pending--
+	if p.held == nil {
+		c.finishCheck(done.job.lineNum, done.job.namespace, done.res)
+	} else {
+		p.held[done.job.seq] = done
+		for {
+			next, ok := p.held[p.recorded]
+			if !ok {
+				break
+			}
+			delete(p.held, p.recorded)
+			p.recorded++
+			c.finishCheck(next.job.lineNum, next.job.namespace, next.res)
+		}
+	}
+	if p.tuner == nil {
+		return
+	}
+	if n, reason, ok := p.tuner.observe(done.latency, failedStatus(done.res.Status)); ok {
+		c.Logger.Printf("Workers: %d -> %d (%s)", p.running, n, reason)
+		p.resize(ctx, c, n)
+	}
+}
+
+// drainPool waits for the submitted jobs, records their results and stops
+// the workers
+func (c *Checker) drainPool(ctx context.Context) {
+	p := c.pool
+	if p == nil {
+		return
+	}
+	for p.pending > 0 {
+		c.receive(ctx, <-p.results)
+	}
+	close(p.jobs)
+	c.pool = nil
+}
+
+// tuner adjusts the size of a worker pool from the latency and error rate
+// of the checks. Every tuneWindow checks it grows the pool by one while
+// latency stays within tuneLatencyGrowth of the best window seen, shrinks
+// it by one when latency rises beyond that and halves it when more than
+// tuneMaxErrorRate of the checks failed.
+type tuner struct {
+	workers, limit int
+
+	samples int
+	errors  int
+	total   time.Duration
+	best    time.Duration // lowest mean latency of a window so far
+}
+
+func newTuner(workers, limit int) *tuner {
+	return &tuner{workers: workers, limit: limit}
+}
+
+// observe records one check. At the end of a window it returns the new pool
+// size and why, with ok set when the size changes.
+func (t *tuner) observe(latency time.Duration, failed bool) (int, string, bool) {
+	t.samples++
+	t.total += latency
+	if failed {
+		t.errors++
+	}
+	if t.samples < tuneWindow {
+		return t.workers, "", false
+	}
+	mean := t.total / time.Duration(t.samples)
+	errRate := float64(t.errors) / float64(t.samples)
+	t.samples, t.errors, t.total = 0, 0, 0
+
+	n, reason := t.workers, ""
+	switch {
+	case errRate > tuneMaxErrorRate:
+		n = max(1, t.workers/2)
+		reason = fmt.Sprintf("error rate %.0f%%", errRate*100)
+	case t.best > 0 && float64(mean) > tuneLatencyGrowth*float64(t.best):
+		n = max(1, t.workers-1)
+		reason = "latency rose to " + mean.String() + " from " + t.best.String()
+	default:
+		if t.best == 0 || mean < t.best {
+			t.best = mean
+		}
+		n = min(t.limit, t.workers+1)
+		reason = "latency stable at " + mean.String()
+	}
+	if n == t.workers {
+		return n, "", false
+	}
+	t.workers = n
+	return n, reason, true
+}
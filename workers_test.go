@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// feed sends n checks of the given latency and outcome to t and returns the
+// pool size after each tuning decision
+func feed(t *tuner, n int, latency time.Duration, failed bool) []int {
+	var sizes []int
+	for i := 0; i < n; i++ {
+		if size, _, ok := t.observe(latency, failed); ok {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+func TestTuner(t *testing.T) {
+	tn := newTuner(2, 4)
+
+	// Stable latency grows the pool one worker per window, up to the cap
+	if got := feed(tn, 4*tuneWindow, 10*time.Millisecond, false); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Fatalf("stable latency: sizes %v, want [3 4]", got)
+	}
+
+	// Latency within tuneLatencyGrowth of the best keeps the pool
+	if got := feed(tn, tuneWindow, 14*time.Millisecond, false); len(got) != 0 {
+		t.Errorf("slightly slower: sizes %v, want no change", got)
+	}
+
+	// Rising latency backs off one worker per window
+	if got := feed(tn, 2*tuneWindow, 20*time.Millisecond, false); len(got) != 2 || got[0] != 3 || got[1] != 2 {
+		t.Errorf("rising latency: sizes %v, want [3 2]", got)
+	}
+
+	// Errors halve the pool, down to one worker
+	tn = newTuner(8, 16)
+	for i := 0; i < tuneWindow; i++ {
+		failed := i%10 == 0 // 10% errors
+		if size, reason, ok := tn.observe(time.Millisecond, failed); ok && (size != 4 || !strings.Contains(reason, "error rate")) {
+			t.Errorf("errors: size %d (%s), want 4", size, reason)
+		}
+	}
+	if tn.workers != 4 {
+		t.Errorf("errors: %d workers, want 4", tn.workers)
+	}
+	tn = newTuner(1, 16)
+	if got := feed(tn, tuneWindow, time.Millisecond, true); len(got) != 0 || tn.workers != 1 {
+		t.Errorf("a single worker shrank: %v", got)
+	}
+}
+
+// lockedSource serializes a docSource that is not safe for concurrent use
+type lockedSource struct {
+	mu sync.Mutex
+	docSource
+}
+
+func (l *lockedSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.docSource.FindOne(ctx, db, col, filter)
+}
+
+func (l *lockedSource) CountDocuments(ctx context.Context, db, col string, filter interface{}, limit int64) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.docSource.CountDocuments(ctx, db, col, filter, limit)
+}
+
+func TestWorkerPool(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	var lines []string
+	for i := 0; i < 300; i++ {
+		id := primitive.NewObjectID()
+		src.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "n", Value: i}})
+		if i%3 != 0 {
+			dest.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "n", Value: i % 5}})
+		}
+		lines = append(lines, logLine("db.col", id))
+	}
+
+	for _, tc := range []struct {
+		name    string
+		workers int
+		auto    bool
+	}{{"fixed", 8, false}, {"auto", 0, true}} {
+		c := NewChecker(&lockedSource{docSource: src}, &lockedSource{docSource: dest})
+		c.Workers, c.AutoWorkers, c.MaxWorkers = tc.workers, tc.auto, 4
+		if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+			t.Fatalf("%s: Run: %v", tc.name, err)
+		}
+		s := c.StatsMap["db.col"]
+		if s.TotalChecks != 300 || s.MissingInDest != 100 || s.Matches+s.Mismatches != 200 || len(c.DiscrepancyList) != s.Discrepancies() {
+			t.Errorf("%s: got %+v with %d discrepancies listed", tc.name, s, len(c.DiscrepancyList))
+		}
+		if c.pool != nil {
+			t.Errorf("%s: pool still running after the run", tc.name)
+		}
+	}
+}
+
+func TestCheckPacer(t *testing.T) {
+	var waits []time.Duration
+	p := &checkPacer{
+		delay:  10 * time.Millisecond,
+		jitter: 5 * time.Millisecond,
+		randN:  func(n int64) int64 { return n - 1 }, // the largest jitter
+		sleep: func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		},
+	}
+	for i := 0; i < 3; i++ {
+		p.wait(context.Background())
+	}
+	// The first check does not wait; the others wait at most delay+jitter
+	if len(waits) != 2 || waits[0] != 15*time.Millisecond || waits[1] != 15*time.Millisecond {
+		t.Errorf("waits = %v, want [15ms 15ms]", waits)
+	}
+	p.randN = func(n int64) int64 { return 0 }
+	if d := p.next(); d != 10*time.Millisecond {
+		t.Errorf("smallest wait = %v, want 10ms", d)
+	}
+
+	var nilPacer *checkPacer
+	nilPacer.wait(context.Background())
+	if NewChecker(nil, nil).newPacer() != nil {
+		t.Error("a pacer was created without a delay")
+	}
+
+	// A cancelled run does not sit out the delay
+	p = &checkPacer{delay: time.Hour, randN: rand.Int64N, sleep: sleepCtx, started: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	p.wait(ctx)
+	if time.Since(start) > time.Second {
+		t.Error("wait ignored the cancelled context")
+	}
+}
+
+func TestInterCheckDelay(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	var lines []string
+	for i := 0; i < 4; i++ {
+		lines = append(lines, logLine("db.col", primitive.NewObjectID()))
+	}
+	const delay = 20 * time.Millisecond
+
+	for _, workers := range []int{1, 2} {
+		c := NewChecker(&lockedSource{docSource: src}, &lockedSource{docSource: dest})
+		c.Workers = workers
+		c.InterCheckDelay = delay
+		start := time.Now()
+		if err := c.Run(context.Background(), strings.NewReader(logFile(lines...))); err != nil {
+			t.Fatalf("workers %d: Run: %v", workers, err)
+		}
+		// Each worker waits between its own checks: 3 pauses for one
+		// worker, at least 1 for two sharing 4 checks
+		minimum := delay * time.Duration(len(lines)/workers-1)
+		if elapsed := time.Since(start); elapsed < minimum {
+			t.Errorf("workers %d: run took %v, want at least %v", workers, elapsed, minimum)
+		}
+		if s := c.StatsMap["db.col"]; s.TotalChecks != len(lines) {
+			t.Errorf("workers %d: %d checks, want %d", workers, s.TotalChecks, len(lines))
+		}
+	}
+}
+
+// jitterSource delays every lookup by up to a millisecond, so that
+// concurrent checks complete out of order
+type jitterSource struct {
+	docSource
+}
+
+func (j jitterSource) FindOne(ctx context.Context, db, col string, filter interface{}) (bson.Raw, error) {
+	time.Sleep(time.Duration(rand.IntN(1000)) * time.Microsecond)
+	return j.docSource.FindOne(ctx, db, col, filter)
+}
+
+func TestDeterministic(t *testing.T) {
+	src, dest := newFakeSource(), newFakeSource()
+	var lines []string
+	for i := 0; i < 200; i++ {
+		id := primitive.NewObjectID()
+		src.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "n", Value: i}})
+		if i%4 != 0 {
+			dest.insert("db.col", bson.D{{Key: "_id", Value: id}, {Key: "n", Value: i % 3}})
+		}
+		lines = append(lines, logLine("db.col", id))
+	}
+	input := logFile(lines...)
+	run := func(workers int) []CheckResult {
+		c := NewChecker(jitterSource{&lockedSource{docSource: src}}, jitterSource{&lockedSource{docSource: dest}})
+		c.Workers, c.Deterministic = workers, true
+		if err := c.Run(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		return c.DiscrepancyList
+	}
+
+	sequential, concurrent := run(1), run(8)
+	if len(sequential) == 0 || len(concurrent) != len(sequential) {
+		t.Fatalf("%d discrepancies with 8 workers, %d with one", len(concurrent), len(sequential))
+	}
+	for i := range sequential {
+		if concurrent[i].Line != sequential[i].Line || concurrent[i].Status != sequential[i].Status || formatID(concurrent[i].ID) != formatID(sequential[i].ID) {
+			t.Fatalf("discrepancy %d: line %d %s with 8 workers, line %d %s with one", i, concurrent[i].Line, concurrent[i].Status, sequential[i].Line, sequential[i].Status)
+		}
+	}
+}